@@ -25,21 +25,12 @@ type baseControllerResult struct {
 	Msg  string
 }
 
-func (this *BaseController) initCors() {
+// 跨域由web.Basic的Cors组件按照app.toml的cors配置处理
+func (this *BaseController) initCache() {
 	//缓存设置
 	this.Ctx.WriteHeader("Cache-Control", "private, no-store, no-cache, must-revalidate, max-age=0")
 	this.Ctx.WriteHeader("Cache-Control", "post-check=0, pre-check=0")
 	this.Ctx.WriteHeader("Pragma", "no-cache")
-
-	//Access-Control-Allow-Origin设置为*只是用来解决post请求跨域的问题的，cookie是没法跨域的，或者说只能跨2级域名，每个cookie都会有对应的域，写的时候可以指定为允许同一个1级域名下的所有2级域名访问
-	origin := this.Ctx.GetHeader("Origin")
-	if origin == "" {
-		origin = this.Ctx.GetSite()
-	}
-
-	this.Ctx.WriteHeader("Access-Control-Allow-Origin", origin)
-	this.Ctx.WriteHeader("Access-Control-Allow-Credentials", "true")
-	// this.Ctx.WriteHeader("Access-Control-Allow-Headers", "Content-Type")
 }
 
 /*
@@ -98,9 +89,9 @@ func (this *BaseController) jsonRender(result baseControllerResult) {
 	this.Ctx.Write(resultString)
 }
 
-// websocket
+// websocket握手成功后由连接接管输出，这里只输出握手前的错误
 func (this *BaseController) websocketRender(result baseControllerResult) {
-	// TODO
+	this.jsonRender(result)
 }
 
 func (this *BaseController) redirectRender(result baseControllerResult) {
@@ -132,15 +123,9 @@ func (this *BaseController) redirectRender(result baseControllerResult) {
 }
 
 func (this *BaseController) excelRender(result baseControllerResult) {
-	//获取excel的导出配置
-	var excelArgs struct {
-		ViewTitle  string `validate:"_viewTitle"`
-		ViewFormat string `validate:"_viewFormat"`
-	}
-	this.Check(&excelArgs)
-
-	excelTitle := excelArgs.ViewTitle
-	excelFormat, err := DecodeUrl(excelArgs.ViewFormat)
+	//获取excel的导出配置，直接读取参数，避免请求体的错误再次抛出
+	excelTitle := this.Ctx.GetParam("_viewTitle")
+	excelFormat, err := DecodeUrl(this.Ctx.GetParam("_viewFormat"))
 	if err != nil {
 		panic(err)
 	}
@@ -169,11 +154,6 @@ func (this *BaseController) downloadRender(result baseControllerResult) {
 }
 
 func (this *BaseController) AutoRender(returnValue interface{}, renderName string) {
-	if this.Ctx.GetMethod() == "OPTIONS" {
-		this.initCors()
-		return
-	}
-
 	result := baseControllerResult{}
 	resultError, ok := returnValue.(Exception)
 
@@ -188,29 +168,81 @@ func (this *BaseController) AutoRender(returnValue interface{}, renderName strin
 		result.Data = returnValue
 		result.Msg = ""
 	}
-	this.initCors()
+	this.initCache()
 
-	var inputViewName struct {
-		View string `validate:"_view"`
+	//请求体的错误已经由业务中的Check抛出，这里直接读取参数
+	if this.Ctx.GetParam("_view") == "excel" {
+		renderName = "excel"
 	}
-	this.Check(&inputViewName)
-
-	if inputViewName.View == "excel" || renderName == "excel" {
-		this.excelRender(result)
-	} else if renderName == "raw" {
-		this.rawRender(result)
-	} else if renderName == "download" {
-		this.downloadRender(result)
-	} else if renderName == "file" {
-		this.fileRender(result)
-	} else if renderName == "json" {
-		this.jsonRender(result)
-	} else if renderName == "websocket" {
-		this.websocketRender(result)
-	} else if renderName == "redirect" {
-		this.redirectRender(result)
-	} else {
-		panic("不合法的renderName " + renderName)
+
+	Render(this.Basic, renderName, result)
+}
+
+func newBaseRenderer(render func(this *BaseController, result baseControllerResult)) AppRenderer {
+	return func(basic *Basic, data interface{}) {
+		controller := &BaseController{Controller: Controller{Basic: basic}}
+		render(controller, data.(baseControllerResult))
 	}
+}
+
+func csvRender(basic *Basic, data interface{}) {
+	result := data.(baseControllerResult)
+	if result.Code != 0 {
+		basic.Ctx.Write([]byte(result.Msg))
+		return
+	}
+	resultByte, err := EncodeCsv(result.Data.([][]string))
+	if err != nil {
+		panic(err)
+	}
+	basic.Ctx.WriteMimeHeader("csv", "data")
+	basic.Ctx.Write(resultByte)
+}
+
+// 出错时输出一个error事件后结束
+func sseRender(basic *Basic, data interface{}) {
+	result := data.(baseControllerResult)
+	if result.Code != 0 {
+		errorEvent := make(chan SseEvent, 1)
+		errorEvent <- SseEvent{Event: "error", Data: result}
+		close(errorEvent)
+		RenderSse(basic, errorEvent)
+		return
+	}
+	RenderSse(basic, result.Data)
+}
+
+// Crash，404与405使用与AutoRender相同的返回格式，Code为HTTP状态码
+func errorRender(basic *Basic, err AppError) {
+	var data struct {
+		ErrorId    string
+		StackTrace string `json:",omitempty"`
+	}
+	data.ErrorId = err.Id
+	data.StackTrace = err.StackTrace
+	//写入状态码后不能再修改头部，需要先设置Content-Type
+	basic.Ctx.WriteHeader("Content-Type", "text/javascript;charset=utf-8")
+	basic.Ctx.WriteStatus(err.Status)
+	controller := &BaseController{Controller: Controller{Basic: basic}}
+	controller.jsonRender(baseControllerResult{
+		Code: err.Status,
+		Msg:  err.Message,
+		Data: data,
+	})
+}
 
+func init() {
+	SetApiDocEnvelope(baseControllerResult{}, "Data")
+	SetErrorHandler(errorRender)
+
+	//注册渲染器，方法名的视图后缀对应渲染器的名字
+	AddRenderer("json", []string{"application/json", "text/javascript"}, newBaseRenderer((*BaseController).jsonRender))
+	AddRenderer("raw", nil, newBaseRenderer((*BaseController).rawRender))
+	AddRenderer("download", nil, newBaseRenderer((*BaseController).downloadRender))
+	AddRenderer("file", nil, newBaseRenderer((*BaseController).fileRender))
+	AddRenderer("excel", nil, newBaseRenderer((*BaseController).excelRender))
+	AddRenderer("redirect", nil, newBaseRenderer((*BaseController).redirectRender))
+	AddRenderer("websocket", nil, newBaseRenderer((*BaseController).websocketRender))
+	AddRenderer("csv", []string{"text/csv"}, csvRender)
+	AddRenderer("sse", []string{"text/event-stream"}, sseRender)
 }
@@ -9,6 +9,6 @@ type IndexController struct {
 	ConfigAo ConfigAoModel
 }
 
-func (this *IndexController) Test_Json() interface{} {
+func (this *IndexController) Test_Json() string {
 	return this.ConfigAo.Get("test")
 }
@@ -73,6 +73,12 @@ func Throw(code int, message string, args ...interface{}) {
 	panic(exception)
 }
 
+func ThrowWithCause(code int, cause interface{}, message string, args ...interface{}) {
+	exception := newException(2, cause, false, code, message, args...)
+
+	panic(exception)
+}
+
 func CatchCrash(handler func(Exception)) {
 	err := recover()
 	if err != nil {
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"compress/flate"
 	"compress/gzip"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
@@ -50,6 +51,7 @@ type Ajax struct {
 	DataType string
 	Data     interface{}
 	Cookie   interface{}
+	Context  context.Context
 
 	ResponseDataType string
 	ResponseData     interface{}
@@ -59,6 +61,14 @@ type Ajax struct {
 
 var DefaultAjaxPool *AjaxPool
 
+type ajaxHeaderKey struct{}
+
+// 随context转发的请求头，如请求Id与traceparent，Ajax中已经设置的请求头不会被覆盖
+// 只有Ajax.Context为携带这些请求头的context时才会转发，web中使用Basic.Ajax会自动传入请求的context
+func WithAjaxHeader(ctx context.Context, header http.Header) context.Context {
+	return context.WithValue(ctx, ajaxHeaderKey{}, header)
+}
+
 func init() {
 	DefaultAjaxPool = NewAjaxPool(nil)
 }
@@ -348,7 +358,12 @@ func (this *Ajax) createRequest() (*http.Request, error) {
 	} else {
 		dataReader = bytes.NewReader(data)
 	}
-	request, err := http.NewRequest(method, url, dataReader)
+	//传入请求的context时，请求取消后同时中断外部调用
+	ctx := this.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	request, err := http.NewRequestWithContext(ctx, method, url, dataReader)
 	if err != nil {
 		return nil, err
 	}
@@ -361,6 +376,13 @@ func (this *Ajax) createRequest() (*http.Request, error) {
 	if err != nil {
 		return nil, err
 	}
+	if header, ok := ctx.Value(ajaxHeaderKey{}).(http.Header); ok {
+		for key, value := range header {
+			if request.Header.Get(key) == "" {
+				request.Header[key] = value
+			}
+		}
+	}
 
 	err = this.createRequestCookie(request)
 	if err != nil {
@@ -5,6 +5,7 @@ import (
 	"net"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -14,12 +15,24 @@ type Websocket struct {
 	writeLock sync.Mutex
 }
 
-// 创建一个连接
+// 创建一个连接，只允许同源的请求
 func NewWebsocket(resp http.ResponseWriter, req *http.Request, responseHeader http.Header, readBufSize, writeBufSize int) (*Websocket, error) {
+	return NewWebsocketWithCheckOrigin(resp, req, responseHeader, readBufSize, writeBufSize, nil)
+}
+
+// 创建一个连接，checkOrigin为nil时只允许同源的请求，握手失败时不输出，由调用方处理返回的错误
+func NewWebsocketWithCheckOrigin(resp http.ResponseWriter, req *http.Request, responseHeader http.Header, readBufSize, writeBufSize int, checkOrigin func(req *http.Request) bool) (*Websocket, error) {
 	websck := &Websocket{}
 
 	// 建立websocket连接
-	ws, err := websocket.Upgrade(resp, req, responseHeader, readBufSize, writeBufSize)
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  readBufSize,
+		WriteBufferSize: writeBufSize,
+		CheckOrigin:     checkOrigin,
+		Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+		},
+	}
+	ws, err := upgrader.Upgrade(resp, req, responseHeader)
 	if _, ok := err.(websocket.HandshakeError); ok {
 		return nil, errors.New("Not a websocket handshake:" + err.Error())
 	} else if err != nil {
@@ -74,3 +87,41 @@ func (this *Websocket) SetCloseHandler(h func(code int, text string) error) {
 func (this *Websocket) RemoteAddr() net.Addr {
 	return this.conn.RemoteAddr()
 }
+
+// 设置读取消息的最大长度
+func (this *Websocket) SetReadLimit(limit int64) {
+	this.conn.SetReadLimit(limit)
+}
+
+// 设置读超时
+func (this *Websocket) SetReadDeadline(t time.Time) error {
+	return this.conn.SetReadDeadline(t)
+}
+
+// 设置收到pong的处理方法
+func (this *Websocket) SetPongHandler(h func(appData string) error) {
+	this.conn.SetPongHandler(h)
+}
+
+// 写带超时的消息
+func (this *Websocket) WriteMessageWithDeadline(messageType int, data []byte, deadline time.Time) error {
+	if this.conn == nil {
+		return errors.New("还未初始化连接！")
+	}
+	this.writeLock.Lock()
+	defer this.writeLock.Unlock()
+
+	err := this.conn.SetWriteDeadline(deadline)
+	if err != nil {
+		return err
+	}
+	return this.conn.WriteMessage(messageType, data)
+}
+
+// 写ping，close等控制消息
+func (this *Websocket) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	if this.conn == nil {
+		return errors.New("还未初始化连接！")
+	}
+	return this.conn.WriteControl(messageType, data, deadline)
+}
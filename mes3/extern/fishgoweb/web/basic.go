@@ -11,30 +11,44 @@ import (
 )
 
 type Basic struct {
-	Ctx      Context
-	Config   Configure
-	Security Security
-	Session  Session
-	DB       Database
-	DB2      Database
-	DB3      Database
-	DB4      Database
-	DB5      Database
-	MDB      *mongo.Database
-	MDB2     *mongo.Database
-	MDB3     *mongo.Database
-	MDB4     *mongo.Database
-	MDB5     *mongo.Database
-	Log      Log
-	Monitor  Monitor
-	Timer    Timer
-	Queue    Queue
-	Cache    Cache
-	Grace    Grace
+	Ctx         Context
+	Config      Configure
+	Security    Security
+	Cors        Cors
+	Session     Session
+	DB          Database
+	DB2         Database
+	DB3         Database
+	DB4         Database
+	DB5         Database
+	DBs         map[string]Database
+	MDB         *mongo.Database
+	MDB2        *mongo.Database
+	MDB3        *mongo.Database
+	MDB4        *mongo.Database
+	MDB5        *mongo.Database
+	MDBs        map[string]*mongo.Database
+	Log         Log
+	Monitor     Monitor
+	Timer       Timer
+	Queue       Queue
+	Cache       Cache
+	Grace       Grace
+	Websocket   WebsocketHub
+	RateLimiter RateLimiter
+	Ajax        AjaxClient
 }
 
 var globalBasic Basic
 
+var globalAccessLog AccessLog
+
+var globalDebug Debug
+
+var globalHealth Health
+
+var globalMigrate Migrate
+
 func init() {
 	//初始化组件
 	var err error
@@ -46,6 +60,10 @@ func init() {
 	if err != nil {
 		panic(err)
 	}
+	globalTrustedProxies, err = NewTrustedProxiesFromConfig()
+	if err != nil {
+		panic(err)
+	}
 	globalBasic.Monitor, err = NewMonitorFromConfig()
 	if err != nil {
 		panic(err)
@@ -58,6 +76,10 @@ func init() {
 	if err != nil {
 		panic(err)
 	}
+	globalBasic.Cors, err = NewCorsFromConfig()
+	if err != nil {
+		panic(err)
+	}
 	globalBasic.Session, err = NewSessionFromConfig("session")
 	if err != nil {
 		panic(err)
@@ -82,6 +104,10 @@ func init() {
 	if err != nil {
 		panic(err)
 	}
+	globalBasic.DBs, err = NewDatabasesFromConfig()
+	if err != nil {
+		panic(err)
+	}
 	globalBasic.MDB, err = NewMongoDatabaseFromConfig("mdb")
 	if err != nil {
 		panic(err)
@@ -102,6 +128,10 @@ func init() {
 	if err != nil {
 		panic(err)
 	}
+	globalBasic.MDBs, err = NewMongoDatabasesFromConfig()
+	if err != nil {
+		panic(err)
+	}
 	globalBasic.Timer, err = NewTimer()
 	if err != nil {
 		panic(err)
@@ -114,6 +144,37 @@ func init() {
 	if err != nil {
 		panic(err)
 	}
+	globalBasic.Websocket, err = NewWebsocketHubFromConfig()
+	if err != nil {
+		panic(err)
+	}
+	globalBasic.RateLimiter, err = NewRateLimiterFromConfig()
+	if err != nil {
+		panic(err)
+	}
+	globalBasic.Ajax, err = NewAjaxClient(nil)
+	if err != nil {
+		panic(err)
+	}
+	globalAccessLog, err = NewAccessLogFromConfig()
+	if err != nil {
+		panic(err)
+	}
+	globalDebug, err = NewDebugFromConfig()
+	if err != nil {
+		panic(err)
+	}
+	globalHealth, err = NewHealthFromConfig()
+	if err != nil {
+		panic(err)
+	}
+	globalMigrate, err = NewMigrateFromConfig()
+	if err != nil {
+		panic(err)
+	}
+	if globalBasic.Monitor != nil {
+		globalMonitorMetric = newMonitorBasicMetric(globalBasic.Monitor)
+	}
 
 	//初始化随机数
 	rand.Seed(time.Now().Unix())
@@ -157,6 +218,23 @@ func initBasic(request *http.Request, response http.ResponseWriter, t *testing.T
 	if result.Session != nil {
 		result.Session = result.Session.WithContext(result.Ctx)
 	}
+	if result.Security != nil {
+		result.Security = result.Security.WithSessionAndContext(result.Session, result.Ctx)
+	}
+	//数据库，缓存，队列与外部调用跟随请求的context取消
+	ctx := result.Ctx.GetContext()
+	for _, db := range []*Database{&result.DB, &result.DB2, &result.DB3, &result.DB4, &result.DB5} {
+		if *db != nil {
+			*db = (*db).WithContext(ctx)
+		}
+	}
+	if len(result.DBs) != 0 {
+		dbs := make(map[string]Database, len(result.DBs))
+		for name, db := range result.DBs {
+			dbs[name] = db.WithContext(ctx)
+		}
+		result.DBs = dbs
+	}
 	if result.Timer != nil {
 		result.Timer = result.Timer.WithLog(result.Log)
 	}
@@ -164,7 +242,13 @@ func initBasic(request *http.Request, response http.ResponseWriter, t *testing.T
 		result.Queue = result.Queue.WithLogAndContext(result.Log, result.Ctx)
 	}
 	if result.Cache != nil {
-		result.Cache = result.Cache.WithLog(result.Log)
+		result.Cache = result.Cache.WithLog(result.Log).WithContext(ctx)
+	}
+	if result.RateLimiter != nil {
+		result.RateLimiter = result.RateLimiter.WithLog(result.Log)
+	}
+	if result.Ajax != nil {
+		result.Ajax = result.Ajax.WithContext(ctx)
 	}
 	return &result
 }
@@ -176,9 +260,77 @@ func destroyBasic() {
 	if globalBasic.Timer != nil {
 		globalBasic.Timer.Close()
 	}
+	if globalBasic.Websocket != nil {
+		globalBasic.Websocket.Close()
+	}
 	if globalBasic.Queue != nil {
 		globalBasic.Queue.Close()
 	}
+	if globalBasic.RateLimiter != nil {
+		globalBasic.RateLimiter.Close()
+	}
+	if globalAccessLog != nil {
+		globalAccessLog.Close()
+	}
+}
+
+// 所有已配置的数据库，包括db到db5与具名连接
+func (this *Basic) getDatabases() map[string]Database {
+	result := map[string]Database{}
+	for name, db := range this.DBs {
+		result[name] = db
+	}
+	defaultDatabases := map[string]Database{
+		"db":  this.DB,
+		"db2": this.DB2,
+		"db3": this.DB3,
+		"db4": this.DB4,
+		"db5": this.DB5,
+	}
+	for name, db := range defaultDatabases {
+		if db != nil {
+			result[name] = db
+		}
+	}
+	return result
+}
+
+func (this *Basic) getMongoDatabases() map[string]*mongo.Database {
+	result := map[string]*mongo.Database{}
+	for name, db := range this.MDBs {
+		result[name] = db
+	}
+	defaultDatabases := map[string]*mongo.Database{
+		"mdb":  this.MDB,
+		"mdb2": this.MDB2,
+		"mdb3": this.MDB3,
+		"mdb4": this.MDB4,
+		"mdb5": this.MDB5,
+	}
+	for name, db := range defaultDatabases {
+		if db != nil {
+			result[name] = db
+		}
+	}
+	return result
+}
+
+// 按名称获取数据库，db到db5对应默认连接，其余对应[xxx.db.name]，未配置时panic
+func (this *Basic) GetDB(name string) Database {
+	db, isExist := this.getDatabases()[name]
+	if isExist == false {
+		panic("unknown database " + name)
+	}
+	return db
+}
+
+// 按名称获取mongo数据库，mdb到mdb5对应默认连接，其余对应[xxx.mdb.name]，未配置时panic
+func (this *Basic) GetMDB(name string) *mongo.Database {
+	db, isExist := this.getMongoDatabases()[name]
+	if isExist == false {
+		panic("unknown mongo database " + name)
+	}
+	return db
 }
 
 func GetAppBasic() Basic {
@@ -16,6 +16,16 @@ The commands are:
 	test 			Test a go application
 		--watch		AutoTest a go application when dictory file change
 		--benchmark	Benchmark a go application when dictory file change
+	migrate	up		Run pending migrations of a go application
+		--db [name]	Database name, default db
+		--step [n]	Only run n migrations
+	migrate	down		Revert the latest migration
+		--db [name]	Database name, default db
+		--step [n]	Revert n migrations
+	migrate	status		Show migrations status
+		--db [name]	Database name, default db
+	migrate	new [name]	Create empty up and down sql migration files
+		--db [name]	Database name, default db
 	version			FishCmd version
 	help			FishCmd help
 
@@ -0,0 +1,41 @@
+package command
+
+import (
+	"errors"
+	"fishcmd/modules"
+	"os"
+	"path"
+)
+
+func Migrate(argv []string) (string, error) {
+	//读取参数
+	if len(argv) == 0 {
+		return "", errors.New("lack of migrate command, support up, down, status, new")
+	}
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	appName := path.Base(workingDir)
+
+	//读取配置
+	err = modules.InitConfig()
+	if err != nil {
+		return "", err
+	}
+
+	//迁移由应用自身执行，才能包含应用中注册的Go迁移
+	err = generate()
+	if err != nil {
+		return "", err
+	}
+	err = build(appName)
+	if err != nil {
+		return "", err
+	}
+	err = modules.MigratePackage(appName, argv)
+	if err != nil {
+		return "", err
+	}
+	return "", nil
+}
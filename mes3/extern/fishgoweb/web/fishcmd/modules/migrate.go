@@ -0,0 +1,6 @@
+package modules
+
+func MigratePackage(packageName string, args []string) error {
+	_, err := runCmdSyncAndStdOutput("./"+packageName, append([]string{"migrate"}, args...)...)
+	return err
+}
@@ -4,18 +4,39 @@ import (
 	"reflect"
 	"sync"
 	"unsafe"
+
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 var (
 	iocMutex          sync.RWMutex
-	iocType           = map[reflect.Type][]uintptr{}
+	iocType           = map[reflect.Type][]iocTypeField{}
 	iocTypeIndexMutex sync.RWMutex
 	iocTypeIndex      = map[reflect.Type]*iocTypeIndexInfo{}
 	iocBasicType      = reflect.TypeOf(&Basic{})
+	iocDatabaseType   = reflect.TypeOf((*Database)(nil)).Elem()
+	iocMongoType      = reflect.TypeOf(&mongo.Database{})
+)
+
+const (
+	iocKindBasic = iota
+	iocKindDatabase
+	iocKindMongo
 )
 
+// 注入的字段，*Basic，带db标签的Database与带mdb标签的*mongo.Database
+type iocTypeField struct {
+	offset   uintptr
+	kind     int
+	name     string
+	database func(basic *Basic) Database
+	mongo    func(basic *Basic) *mongo.Database
+}
+
 type iocTypeIndexInfoField struct {
 	index    int
+	kind     int
+	name     string
 	children *iocTypeIndexInfo
 }
 
@@ -37,9 +58,22 @@ func getIocTypeIndexInner(modelType reflect.Type) *iocTypeIndexInfo {
 	numField := modelType.NumField()
 	for i := 0; i != numField; i++ {
 		singleFiled := modelType.Field(i)
+		kind := -1
+		name := ""
 		if singleFiled.Type == iocBasicType {
+			kind = iocKindBasic
+		} else if singleFiled.Type == iocDatabaseType && singleFiled.Tag.Get("db") != "" {
+			kind = iocKindDatabase
+			name = singleFiled.Tag.Get("db")
+		} else if singleFiled.Type == iocMongoType && singleFiled.Tag.Get("mdb") != "" {
+			kind = iocKindMongo
+			name = singleFiled.Tag.Get("mdb")
+		}
+		if kind != -1 {
 			result.fields = append(result.fields, iocTypeIndexInfoField{
 				index:    i,
+				kind:     kind,
+				name:     name,
 				children: nil,
 			})
 			if result.maxDepth < 1 {
@@ -69,18 +103,18 @@ func getIocTypeIndexInner(modelType reflect.Type) *iocTypeIndexInfo {
 	return result
 }
 
-func walkIocTypeIndexInfoDfs(info *iocTypeIndexInfo, currentIndex []int, currentPlace int, handler func([]int)) {
+func walkIocTypeIndexInfoDfs(info *iocTypeIndexInfo, currentIndex []int, currentPlace int, handler func([]int, iocTypeIndexInfoField)) {
 	for _, field := range info.fields {
 		currentIndex[currentPlace] = field.index
 		if field.children == nil {
-			handler(currentIndex[0 : currentPlace+1])
+			handler(currentIndex[0:currentPlace+1], field)
 		} else {
 			walkIocTypeIndexInfoDfs(field.children, currentIndex, currentPlace+1, handler)
 		}
 	}
 }
 
-func getIocTypeIndex(target reflect.Type) []uintptr {
+func getIocTypeIndex(target reflect.Type) []iocTypeField {
 	iocMutex.RLock()
 	result, ok := iocType[target]
 	iocMutex.RUnlock()
@@ -91,13 +125,22 @@ func getIocTypeIndex(target reflect.Type) []uintptr {
 	info := getIocTypeIndexInner(target)
 	newData := reflect.New(target).Elem()
 	newDataBasicAddr := newData.UnsafeAddr()
-	result = make([]uintptr, info.count, info.count)
+	result = make([]iocTypeField, info.count, info.count)
 	resultIndex := 0
 	currentIndex := make([]int, info.maxDepth, info.maxDepth)
-	walkIocTypeIndexInfoDfs(info, currentIndex, 0, func(singleIndex []int) {
+	walkIocTypeIndexInfoDfs(info, currentIndex, 0, func(singleIndex []int, field iocTypeIndexInfoField) {
 		singleNewData := newData.FieldByIndex(singleIndex)
 		singleNewDataAddr := singleNewData.UnsafeAddr()
-		result[resultIndex] = singleNewDataAddr - newDataBasicAddr
+		result[resultIndex] = iocTypeField{
+			offset: singleNewDataAddr - newDataBasicAddr,
+			kind:   field.kind,
+			name:   field.name,
+		}
+		if field.kind == iocKindDatabase {
+			result[resultIndex].database = getIocDatabaseGetter(field.name)
+		} else if field.kind == iocKindMongo {
+			result[resultIndex].mongo = getIocMongoDatabaseGetter(field.name)
+		}
 		resultIndex++
 	})
 
@@ -113,9 +156,68 @@ func injectIoc(target reflect.Value, basic *Basic) {
 		target = target.Elem()
 	}
 	typeIndex := getIocTypeIndex(target.Type())
-	targetAddr := target.UnsafeAddr()
+	targetPointer := unsafe.Pointer(target.UnsafeAddr())
 	for _, singleIndex := range typeIndex {
-		var pointer **Basic = (**Basic)(unsafe.Pointer(targetAddr + singleIndex))
-		*pointer = basic
+		switch singleIndex.kind {
+		case iocKindBasic:
+			var pointer **Basic = (**Basic)(unsafe.Pointer(uintptr(targetPointer) + singleIndex.offset))
+			*pointer = basic
+		case iocKindDatabase:
+			var pointer *Database = (*Database)(unsafe.Pointer(uintptr(targetPointer) + singleIndex.offset))
+			*pointer = getIocDatabase(basic, singleIndex)
+		case iocKindMongo:
+			var pointer **mongo.Database = (**mongo.Database)(unsafe.Pointer(uintptr(targetPointer) + singleIndex.offset))
+			*pointer = getIocMongoDatabase(basic, singleIndex)
+		}
+	}
+}
+
+// 按名称找到Basic中对应的连接，只在建立类型索引时查找一次
+func getIocDatabaseGetter(name string) func(basic *Basic) Database {
+	switch name {
+	case "db":
+		return func(basic *Basic) Database { return basic.DB }
+	case "db2":
+		return func(basic *Basic) Database { return basic.DB2 }
+	case "db3":
+		return func(basic *Basic) Database { return basic.DB3 }
+	case "db4":
+		return func(basic *Basic) Database { return basic.DB4 }
+	case "db5":
+		return func(basic *Basic) Database { return basic.DB5 }
+	}
+	return func(basic *Basic) Database { return basic.DBs[name] }
+}
+
+func getIocMongoDatabaseGetter(name string) func(basic *Basic) *mongo.Database {
+	switch name {
+	case "mdb":
+		return func(basic *Basic) *mongo.Database { return basic.MDB }
+	case "mdb2":
+		return func(basic *Basic) *mongo.Database { return basic.MDB2 }
+	case "mdb3":
+		return func(basic *Basic) *mongo.Database { return basic.MDB3 }
+	case "mdb4":
+		return func(basic *Basic) *mongo.Database { return basic.MDB4 }
+	case "mdb5":
+		return func(basic *Basic) *mongo.Database { return basic.MDB5 }
+	}
+	return func(basic *Basic) *mongo.Database { return basic.MDBs[name] }
+}
+
+// 预热时basic为nil，只检查连接是否已配置
+func getIocDatabase(basic *Basic, field iocTypeField) Database {
+	if basic == nil {
+		globalBasic.GetDB(field.name)
+		return nil
+	}
+	return field.database(basic)
+}
+
+func getIocMongoDatabase(basic *Basic, field iocTypeField) *mongo.Database {
+	if basic == nil {
+		globalBasic.GetMDB(field.name)
+		return nil
 	}
+	return field.mongo(basic)
 }
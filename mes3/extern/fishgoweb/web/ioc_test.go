@@ -0,0 +1,130 @@
+package web
+
+import (
+	"context"
+	"github.com/milkbobo/fishgoweb/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+type iocTestDatabase struct {
+	Database
+	name string
+	ctx  context.Context
+}
+
+func (this *iocTestDatabase) WithContext(ctx context.Context) Database {
+	return &iocTestDatabase{name: this.name, ctx: ctx}
+}
+
+type iocTestModel struct {
+	Model
+	Orders  Database `db:"orders"`
+	Default Database `db:"db"`
+	Plain   Database
+}
+
+type iocTestController struct {
+	Controller
+	OrderModel iocTestModel
+}
+
+func (this *iocTestController) Get_Json() interface{} {
+	orders := this.OrderModel.Orders.(*iocTestDatabase)
+	result := orders.name
+	if orders.ctx == this.Ctx.GetContext() {
+		result += ",ctx"
+	}
+	if this.OrderModel.Default == this.DB && this.OrderModel.Plain == nil {
+		result += ",default"
+	}
+	return result
+}
+
+func (this *iocTestController) AutoRender(data interface{}, viewName string) {
+	this.Ctx.Write([]byte(data.(string)))
+}
+
+func TestIocNamedDatabaseConfig(t *testing.T) {
+	file, err := ioutil.TempFile("", "ioc_test_*.toml")
+	assert.AssertEqual(t, err, nil)
+	defer os.Remove(file.Name())
+	file.WriteString(`
+[dev.db]
+driver = "mysql"
+host = "127.0.0.1"
+
+[dev.db.orders]
+driver = "mysql"
+host = "10.0.0.1"
+port = 3306
+database = "orders"
+
+[dev.db.analytics]
+driver = "mysql"
+database = "analytics"
+
+[dev.mdb.logs]
+host = "10.0.0.2"
+database = "logs"
+
+[prod.db.orders]
+driver = "mysql"
+host = "10.0.0.3"
+`)
+	file.Close()
+
+	dbs, mdbs, err := getAppConfigNamedDatabase(file.Name(), "dev")
+	assert.AssertEqual(t, err, nil)
+	assert.AssertEqual(t, dbs, map[string]AppConfigInfoDB{
+		"orders":    {Driver: "mysql", Host: "10.0.0.1", Port: 3306, Database: "orders"},
+		"analytics": {Driver: "mysql", Database: "analytics"},
+	})
+	assert.AssertEqual(t, mdbs, map[string]AppConfigInfoMongoDB{
+		"logs": {Host: "10.0.0.2", Database: "logs"},
+	})
+	dbs, mdbs, err = getAppConfigNamedDatabase(file.Name(), "test")
+	assert.AssertEqual(t, err, nil)
+	assert.AssertEqual(t, len(dbs), 0)
+	assert.AssertEqual(t, len(mdbs), 0)
+}
+
+func TestIocNamedDatabase(t *testing.T) {
+	oldDB := globalBasic.DB
+	oldDBs := globalBasic.DBs
+	oldRouteTree := handler.routeTree
+	defer func() {
+		globalBasic.DB = oldDB
+		globalBasic.DBs = oldDBs
+		handler.routeTree = oldRouteTree
+	}()
+	handler.routeTree = nil
+
+	//未配置的连接在注册路由时就会报错
+	globalBasic.DBs = nil
+	globalBasic.DB = &iocTestDatabase{name: "db"}
+	assert.AssertEqual(t, func() (result interface{}) {
+		defer func() {
+			result = recover()
+		}()
+		handler.addRoute("/ioctest", &iocTestController{}, 0)
+		return nil
+	}(), "unknown database orders")
+
+	globalBasic.DBs = map[string]Database{
+		"orders": &iocTestDatabase{name: "orders"},
+	}
+	handler.routeTree = nil
+	handler.addRoute("/ioctest", &iocTestController{}, 0)
+	server := httptest.NewServer(http.HandlerFunc(handler.innerServeHTTP))
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/ioctest/get")
+	assert.AssertEqual(t, err, nil)
+	defer response.Body.Close()
+	body, _ := ioutil.ReadAll(response.Body)
+	assert.AssertEqual(t, string(body), "orders,ctx,default")
+}
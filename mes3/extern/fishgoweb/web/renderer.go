@@ -0,0 +1,192 @@
+package web
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/milkbobo/fishgoweb/encoding"
+)
+
+// 渲染器，data为AutoRender整理后的返回数据
+type AppRenderer func(basic *Basic, data interface{})
+
+type rendererInfo struct {
+	name      string
+	mimeTypes []string
+	renderer  AppRenderer
+}
+
+type rendererAccept struct {
+	mimeType string
+	quality  float64
+}
+
+var (
+	renderers         []rendererInfo
+	rendererJsonpName = regexp.MustCompile(`^[a-zA-Z_$][0-9a-zA-Z_$.]*$`)
+)
+
+// 注册渲染器，name对应业务方法的视图后缀，如List_Csv对应csv
+// mimeTypes用于Accept头的内容协商，同名的渲染器会被覆盖
+func AddRenderer(name string, mimeTypes []string, renderer AppRenderer) {
+	name = strings.ToLower(name)
+	single := rendererInfo{
+		name:      name,
+		mimeTypes: mimeTypes,
+		renderer:  renderer,
+	}
+	for i := range renderers {
+		if renderers[i].name == name {
+			renderers[i] = single
+			return
+		}
+	}
+	renderers = append(renderers, single)
+}
+
+func GetRenderer(name string) (AppRenderer, bool) {
+	name = strings.ToLower(name)
+	for _, single := range renderers {
+		if single.name == name {
+			return single.renderer, true
+		}
+	}
+	return nil, false
+}
+
+func parseRendererAccept(accept string) []rendererAccept {
+	result := []rendererAccept{}
+	for _, single := range strings.Split(accept, ",") {
+		parts := strings.Split(single, ";")
+		mimeType := strings.ToLower(strings.TrimSpace(parts[0]))
+		if mimeType == "" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				number, err := strconv.ParseFloat(param[2:], 64)
+				if err == nil {
+					quality = number
+				}
+			}
+		}
+		if quality <= 0 {
+			continue
+		}
+		result = append(result, rendererAccept{mimeType: mimeType, quality: quality})
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].quality > result[j].quality
+	})
+	return result
+}
+
+func isRendererMimeMatch(accept string, mimeType string) bool {
+	if accept == "*/*" || accept == mimeType {
+		return true
+	}
+	if strings.HasSuffix(accept, "/*") {
+		return strings.HasPrefix(mimeType, accept[:len(accept)-1])
+	}
+	return false
+}
+
+// 按照Accept头选择渲染器，返回渲染器的名字
+func NegotiateRenderer(accept string) (string, bool) {
+	for _, singleAccept := range parseRendererAccept(accept) {
+		for _, single := range renderers {
+			for _, mimeType := range single.mimeTypes {
+				if isRendererMimeMatch(singleAccept.mimeType, mimeType) {
+					return single.name, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// 按照Accept头协商的视图名，如业务方法Get_Auto
+const RendererAutoName = "auto"
+
+// 按视图名渲染数据，视图名为auto或为空时按照Accept头协商，没有Accept头时使用第一个渲染器
+// 视图名没有对应的渲染器时直接panic，不回退到协商，避免拼写错误被掩盖
+func Render(basic *Basic, viewName string, data interface{}) {
+	if viewName == "" || viewName == RendererAutoName {
+		accept := basic.Ctx.GetHeader("Accept")
+		if accept == "" {
+			accept = "*/*"
+		}
+		name, isAccept := NegotiateRenderer(accept)
+		if isAccept == false {
+			panic("没有与Accept匹配的渲染器 " + accept)
+		}
+		viewName = name
+	}
+	renderer, isExist := GetRenderer(viewName)
+	if isExist == false {
+		panic("不合法的renderName " + viewName)
+	}
+	renderer(basic, data)
+}
+
+func jsonRender(basic *Basic, data interface{}) {
+	result, err := json.Marshal(data)
+	if err != nil {
+		panic(err)
+	}
+	basic.Ctx.WriteHeader("Content-Type", "application/json; charset=utf-8")
+	basic.Ctx.Write(result)
+}
+
+func jsonpRender(basic *Basic, data interface{}) {
+	callback := basic.Ctx.GetParam("callback")
+	if callback == "" {
+		callback = "callback"
+	}
+	if rendererJsonpName.MatchString(callback) == false {
+		panic(fmt.Sprintf("不合法的jsonp回调函数名 %v", callback))
+	}
+	result, err := encoding.EncodeJsonp(callback, data)
+	if err != nil {
+		panic(err)
+	}
+	basic.Ctx.WriteHeader("Content-Type", "application/javascript; charset=utf-8")
+	basic.Ctx.Write(result)
+}
+
+func xmlRender(basic *Basic, data interface{}) {
+	result, err := xml.Marshal(data)
+	if err != nil {
+		panic(err)
+	}
+	basic.Ctx.WriteHeader("Content-Type", "application/xml; charset=utf-8")
+	basic.Ctx.Write([]byte(xml.Header))
+	basic.Ctx.Write(result)
+}
+
+func csvRender(basic *Basic, data interface{}) {
+	table, ok := data.([][]string)
+	if ok == false {
+		panic(fmt.Sprintf("csv渲染器的数据必须为[][]string，其类型为[%T]", data))
+	}
+	result, err := encoding.EncodeCsv(table)
+	if err != nil {
+		panic(err)
+	}
+	basic.Ctx.WriteHeader("Content-Type", "text/csv; charset=utf-8")
+	basic.Ctx.Write(result)
+}
+
+func init() {
+	AddRenderer("json", []string{"application/json"}, jsonRender)
+	AddRenderer("jsonp", []string{"application/javascript"}, jsonpRender)
+	AddRenderer("xml", []string{"application/xml", "text/xml"}, xmlRender)
+	AddRenderer("csv", []string{"text/csv"}, csvRender)
+}
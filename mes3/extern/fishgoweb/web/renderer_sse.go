@@ -0,0 +1,169 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Server-Sent Events的单个事件，Data为string与[]byte时原样输出，其他类型输出json
+type SseEvent struct {
+	Id    string
+	Event string
+	Data  interface{}
+	Retry int
+}
+
+// 事件迭代器，返回false时结束输出
+type SseIterator func() (SseEvent, bool)
+
+// 默认的心跳间隔，可以通过app.toml中sse的heartbeat修改
+const sseDefaultHeartbeat = 15 * time.Second
+
+// 客户端重连时带上的最后一个事件Id，兼容不能设置请求头的客户端时也读取lastEventId参数
+func GetSseLastEventId(ctx Context) string {
+	lastEventId := ctx.GetHeader("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = ctx.GetParam("lastEventId")
+	}
+	return lastEventId
+}
+
+func encodeSseEvent(event SseEvent) ([]byte, error) {
+	var data string
+	switch single := event.Data.(type) {
+	case nil:
+		data = ""
+	case string:
+		data = single
+	case []byte:
+		data = string(single)
+	default:
+		result, err := json.Marshal(single)
+		if err != nil {
+			return nil, err
+		}
+		data = string(result)
+	}
+	buffer := bytes.NewBuffer(nil)
+	if event.Id != "" {
+		buffer.WriteString("id: " + strings.Replace(event.Id, "\n", "", -1) + "\n")
+	}
+	if event.Event != "" {
+		buffer.WriteString("event: " + strings.Replace(event.Event, "\n", "", -1) + "\n")
+	}
+	if event.Retry > 0 {
+		buffer.WriteString(fmt.Sprintf("retry: %d\n", event.Retry))
+	}
+	for _, line := range strings.Split(strings.Replace(data, "\r\n", "\n", -1), "\n") {
+		buffer.WriteString("data: " + line + "\n")
+	}
+	buffer.WriteString("\n")
+	return buffer.Bytes(), nil
+}
+
+func getSseHeartbeat() time.Duration {
+	if globalBasic.Config != nil && globalBasic.Config.Get().Sse.Heartbeat > 0 {
+		return time.Duration(globalBasic.Config.Get().Sse.Heartbeat) * time.Second
+	}
+	return sseDefaultHeartbeat
+}
+
+// 把迭代器转为channel，客户端断开后不再取下一个事件
+func getSseIteratorChannel(iterator SseIterator, done <-chan struct{}) <-chan SseEvent {
+	result := make(chan SseEvent)
+	go func() {
+		defer close(result)
+		for {
+			event, isContinue := iterator()
+			if isContinue == false {
+				return
+			}
+			select {
+			case result <- event:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return result
+}
+
+// 以Server-Sent Events输出data，data为channel或者SseIterator
+// channel的元素不是SseEvent时作为事件的Data输出，channel关闭或者客户端断开时结束
+func RenderSse(basic *Basic, data interface{}) {
+	request := basic.Ctx.GetRawRequest().(*http.Request)
+	response := basic.Ctx.GetRawResponseWriter().(http.ResponseWriter)
+	flusher, ok := response.(http.Flusher)
+	if ok == false {
+		panic("response writer does not support flush")
+	}
+	done := request.Context().Done()
+
+	var channel reflect.Value
+	if iterator, ok := data.(SseIterator); ok {
+		channel = reflect.ValueOf(getSseIteratorChannel(iterator, done))
+	} else if iterator, ok := data.(func() (SseEvent, bool)); ok {
+		channel = reflect.ValueOf(getSseIteratorChannel(iterator, done))
+	} else if channel = reflect.ValueOf(data); channel.Kind() != reflect.Chan ||
+		channel.Type().ChanDir()&reflect.RecvDir == 0 {
+		panic(fmt.Sprintf("sse渲染器的数据必须为channel或者SseIterator，其类型为[%T]", data))
+	}
+
+	header := response.Header()
+	header.Set("Content-Type", "text/event-stream; charset=utf-8")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	response.WriteHeader(200)
+	if globalBasic.Config != nil && globalBasic.Config.Get().Sse.Retry > 0 {
+		response.Write([]byte(fmt.Sprintf("retry: %d\n\n", globalBasic.Config.Get().Sse.Retry)))
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(getSseHeartbeat())
+	defer heartbeat.Stop()
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(heartbeat.C)},
+		{Dir: reflect.SelectRecv, Chan: channel},
+	}
+	for {
+		chosen, value, isOpen := reflect.Select(cases)
+		if chosen == 0 {
+			//客户端断开
+			return
+		} else if chosen == 1 {
+			//心跳注释，避免代理因空闲断开连接
+			_, err := response.Write([]byte(": ping\n\n"))
+			if err != nil {
+				return
+			}
+		} else {
+			if isOpen == false {
+				return
+			}
+			event, ok := value.Interface().(SseEvent)
+			if ok == false {
+				event = SseEvent{Data: value.Interface()}
+			}
+			result, err := encodeSseEvent(event)
+			if err != nil {
+				panic(err)
+			}
+			_, err = response.Write(result)
+			if err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func init() {
+	AddRenderer("sse", []string{"text/event-stream"}, RenderSse)
+}
@@ -0,0 +1,96 @@
+package web
+
+import (
+	"github.com/milkbobo/fishgoweb/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type sseTestController struct {
+	Controller
+}
+
+var sseTestDone = make(chan bool, 1)
+
+func (this *sseTestController) Channel_Sse() interface{} {
+	result := make(chan interface{}, 3)
+	result <- SseEvent{Id: "1", Event: "progress", Data: map[string]int{"finish": 1}}
+	result <- "line1\nline2"
+	close(result)
+	return result
+}
+
+func (this *sseTestController) Iterator_Sse() interface{} {
+	index, _ := strconv.Atoi(GetSseLastEventId(this.Ctx))
+	return SseIterator(func() (SseEvent, bool) {
+		index++
+		if index > 3 {
+			return SseEvent{}, false
+		}
+		return SseEvent{Id: strconv.Itoa(index), Data: index}, true
+	})
+}
+
+func (this *sseTestController) Forever_Sse() interface{} {
+	return make(chan SseEvent)
+}
+
+func (this *sseTestController) AutoRender(data interface{}, viewName string) {
+	Render(this.Basic, viewName, data)
+	if viewName == "sse" && this.Ctx.GetUrl().Path == "/sse/forever" {
+		sseTestDone <- true
+	}
+}
+
+func TestSse(t *testing.T) {
+	oldRouteTree := handler.routeTree
+	defer func() {
+		handler.routeTree = oldRouteTree
+	}()
+	handler.routeTree = nil
+	handler.addRoute("/sse", &sseTestController{}, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		handler.handleRequest(request, response)
+	}))
+	defer server.Close()
+
+	testCase := []struct {
+		url         string
+		lastEventId string
+		output      string
+	}{
+		{"/sse/channel", "", "id: 1\nevent: progress\ndata: {\"finish\":1}\n\ndata: line1\ndata: line2\n\n"},
+		{"/sse/iterator", "", "id: 1\ndata: 1\n\nid: 2\ndata: 2\n\nid: 3\ndata: 3\n\n"},
+		{"/sse/iterator", "2", "id: 3\ndata: 3\n\n"},
+		{"/sse/iterator?lastEventId=3", "", ""},
+	}
+	for singleIndex, singleTestCase := range testCase {
+		request, _ := http.NewRequest("GET", server.URL+singleTestCase.url, nil)
+		if singleTestCase.lastEventId != "" {
+			request.Header.Set("Last-Event-ID", singleTestCase.lastEventId)
+		}
+		response, err := http.DefaultClient.Do(request)
+		assert.AssertEqual(t, err, nil, singleIndex)
+		body, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		assert.AssertEqual(t, response.Header.Get("Content-Type"), "text/event-stream; charset=utf-8", singleIndex)
+		assert.AssertEqual(t, string(body), singleTestCase.output, singleIndex)
+	}
+
+	//客户端断开后结束输出
+	client := &http.Client{Timeout: 200 * time.Millisecond}
+	response, err := client.Get(server.URL + "/sse/forever")
+	assert.AssertEqual(t, err, nil)
+	_, err = ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	assert.AssertEqual(t, err != nil, true)
+	select {
+	case <-sseTestDone:
+	case <-time.After(2 * time.Second):
+		t.Error("sse does not stop after client disconnect")
+	}
+}
@@ -0,0 +1,133 @@
+package web
+
+import (
+	"github.com/milkbobo/fishgoweb/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiateRenderer(t *testing.T) {
+	testCase := []struct {
+		accept string
+		name   string
+		ok     bool
+	}{
+		{"application/json", "json", true},
+		{"text/html,application/xml;q=0.9,*/*;q=0.8", "xml", true},
+		{"text/csv;q=0.5, application/javascript", "jsonp", true},
+		{"text/*", "xml", true},
+		{"*/*", "json", true},
+		{"application/json;q=0", "", false},
+		{"text/html", "", false},
+		{"", "", false},
+	}
+	for singleIndex, singleTestCase := range testCase {
+		name, ok := NegotiateRenderer(singleTestCase.accept)
+		assert.AssertEqual(t, name, singleTestCase.name, singleIndex)
+		assert.AssertEqual(t, ok, singleTestCase.ok, singleIndex)
+	}
+}
+
+func TestRender(t *testing.T) {
+	oldRenderers := renderers
+	defer func() {
+		renderers = append([]rendererInfo{}, oldRenderers...)
+	}()
+	renderers = append([]rendererInfo{}, renderers...)
+	AddRenderer("Text", []string{"text/plain"}, func(basic *Basic, data interface{}) {
+		basic.Ctx.Write([]byte(data.(string)))
+	})
+
+	testCase := []struct {
+		url      string
+		accept   string
+		viewName string
+		data     interface{}
+		output   string
+	}{
+		{"/", "", "json", map[string]int{"a": 1}, `{"a":1}`},
+		{"/?callback=fn", "", "jsonp", map[string]int{"a": 1}, `fn({"a":1})`},
+		{"/", "", "csv", [][]string{{"a", "b"}, {"1", "2"}}, "\xEF\xBB\xBFa,b\n1,2\n"},
+		{"/", "", "text", "hello", "hello"},
+		{"/", "text/plain", "", "hello", "hello"},
+		{"/", "application/json", "", "hello", `"hello"`},
+		{"/", "", "", "hello", `"hello"`},
+		{"/", "application/json", "text", "hello", "hello"},
+	}
+	for singleIndex, singleTestCase := range testCase {
+		request, _ := http.NewRequest("GET", singleTestCase.url, nil)
+		request.Header.Set("Accept", singleTestCase.accept)
+		response := &memoryResponseWriter{}
+		basic := initBasic(request, response, t)
+		Render(basic, singleTestCase.viewName, singleTestCase.data)
+		assert.AssertEqual(t, string(response.data), singleTestCase.output, singleIndex)
+	}
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	basic := initBasic(request, &memoryResponseWriter{}, t)
+	assert.AssertError(t, "不合法的renderName unknown", func() {
+		Render(basic, "unknown", nil)
+	})
+
+	//未知的视图名不回退到协商
+	request.Header.Set("Accept", "application/json")
+	assert.AssertError(t, "不合法的renderName unknown", func() {
+		Render(basic, "unknown", nil)
+	})
+	request.Header.Set("Accept", "text/html")
+	assert.AssertError(t, "没有与Accept匹配的渲染器 text/html", func() {
+		Render(basic, "", nil)
+	})
+}
+
+type rendererTestController struct {
+	Controller
+}
+
+func (this *rendererTestController) Get_Auto() interface{} {
+	return "hello"
+}
+
+func (this *rendererTestController) List_Json() interface{} {
+	return "hello"
+}
+
+func (this *rendererTestController) AutoRender(data interface{}, viewName string) {
+	Render(this.Basic, viewName, data)
+}
+
+func TestRenderAuto(t *testing.T) {
+	oldRouteTree := handler.routeTree
+	defer func() {
+		handler.routeTree = oldRouteTree
+	}()
+	handler.routeTree = nil
+	handler.addRoute("/renderertest", &rendererTestController{}, 0)
+	server := httptest.NewServer(http.HandlerFunc(handler.innerServeHTTP))
+	defer server.Close()
+
+	//_Auto的业务方法按照Accept头协商，指定视图的业务方法不协商
+	testCase := []struct {
+		url         string
+		accept      string
+		contentType string
+		output      string
+	}{
+		{"/renderertest/get", "", "application/json; charset=utf-8", `"hello"`},
+		{"/renderertest/get", "application/xml", "application/xml; charset=utf-8", "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<string>hello</string>"},
+		{"/renderertest/get", "text/html,application/json;q=0.9", "application/json; charset=utf-8", `"hello"`},
+		{"/renderertest/list", "application/xml", "application/json; charset=utf-8", `"hello"`},
+	}
+	for singleIndex, singleTestCase := range testCase {
+		request, _ := http.NewRequest("GET", server.URL+singleTestCase.url, nil)
+		request.Header.Set("Accept", singleTestCase.accept)
+		response, err := http.DefaultClient.Do(request)
+		assert.AssertEqual(t, err, nil)
+		body, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		assert.AssertEqual(t, response.Header.Get("Content-Type"), singleTestCase.contentType, singleIndex)
+		assert.AssertEqual(t, string(body), singleTestCase.output, singleIndex)
+	}
+}
@@ -1,9 +1,11 @@
 package web
 
 import (
+	"context"
 	"flag"
 	"github.com/milkbobo/fishgoweb/language"
 	"net/http"
+	"os"
 	"reflect"
 	"strings"
 	"sync/atomic"
@@ -18,11 +20,19 @@ type methodInfo struct {
 	viewName       string
 	controllerType reflect.Type
 	methodType     reflect.Method
+	httpMethods    []string
+	isWebsocket    bool
 }
 
+var (
+	routeWebsocketConnType  = reflect.TypeOf((*WebsocketConn)(nil)).Elem()
+	routeHttpMethods        = []string{"GET", "POST", "PUT", "DELETE", "PATCH", "HEAD", "OPTIONS"}
+	routeDefaultHttpMethods = []string{"GET", "POST", "PUT", "DELETE", "PATCH"}
+)
+
 type handlerType struct {
-	routerControllerMethod map[string]methodInfo
-	handlerFunc            http.HandlerFunc
+	routeTree   *routeTree
+	handlerFunc http.HandlerFunc
 }
 
 func (this *handlerType) initMiddlewares(middlewars []AppRouterMiddlware) {
@@ -39,14 +49,48 @@ func (this *handlerType) ServeHTTP(response http.ResponseWriter, request *http.R
 }
 
 func (this *handlerType) innerServeHTTP(response http.ResponseWriter, request *http.Request) {
+	if monitorHandler := getMonitorHandler(request); monitorHandler != nil {
+		monitorHandler.ServeHTTP(response, request)
+		return
+	}
+	if debugHandler := getDebugHandler(request); debugHandler != nil {
+		debugHandler.ServeHTTP(response, request)
+		return
+	}
+	if healthHandler := getHealthHandler(request); healthHandler != nil {
+		healthHandler.ServeHTTP(response, request)
+		return
+	}
+
 	requestId := atomic.AddInt64(&oldestStayRequestId, 1)
 
 	oldestStay.Push(requestId, request)
 
-	beginTime := time.Now().UnixNano()
-	this.handleRequest(request, response)
-	endTime := time.Now().UnixNano()
-	globalBasic.Log.Debug("%s %s : %s", request.Method, request.URL.String(), time.Duration(endTime-beginTime).String())
+	beginTime := time.Now()
+	var statusResponse *statusResponseWriter
+	if globalAccessLog != nil || globalMonitorMetric != nil {
+		//访问日志与业务使用同一个请求Id
+		request, _ = withContextTrace(request)
+		statusResponse = &statusResponseWriter{ResponseWriter: response}
+		response = statusResponse
+	}
+	if globalMonitorMetric != nil {
+		globalMonitorMetric.requestInFlight.Inc()
+	}
+	if apiDocHandler := getApiDocHandler(request); apiDocHandler != nil {
+		apiDocHandler.ServeHTTP(response, request)
+	} else {
+		this.handleRequest(request, response)
+	}
+	if globalMonitorMetric != nil {
+		globalMonitorMetric.requestInFlight.Dec()
+		globalMonitorMetric.observeRequest(request.Method, statusResponse, time.Since(beginTime))
+	}
+	if globalAccessLog != nil {
+		globalAccessLog.Write(newAccessLogItem(request, statusResponse, beginTime))
+	} else {
+		globalBasic.Log.Debug("%s %s : %s", request.Method, request.URL.String(), time.Since(beginTime).String())
+	}
 
 	oldestStay.Pop(requestId)
 }
@@ -68,12 +112,32 @@ func (this *handlerType) isPublic(name string) bool {
 	}
 }
 
-func (this *handlerType) addRoute(namespace string, target ControllerInterface) {
-	if this.routerControllerMethod == nil {
-		this.routerControllerMethod = map[string]methodInfo{}
+// 解析方法名后缀中的HTTP Method，如Save_Json_Post只响应POST请求
+// 没有后缀时响应GET，POST，PUT，DELETE与PATCH请求，后缀不是HTTP Method时直接panic，避免拼写错误时响应所有请求
+func (this *handlerType) parseHttpMethods(controllerType reflect.Type, methodName string, suffix []string) ([]string, bool) {
+	result := []string{}
+	for _, single := range suffix {
+		httpMethod := strings.ToUpper(single)
+		if language.ArrayIn(routeHttpMethods, httpMethod) == -1 {
+			panic("invalid http method " + single + " in " + controllerType.String() + "." + methodName)
+		}
+		result = append(result, httpMethod)
+	}
+	if len(result) == 0 {
+		return routeDefaultHttpMethods, false
+	}
+	return result, true
+}
+
+func (this *handlerType) addRoute(namespace string, target ControllerInterface, priority int) {
+	if this.routeTree == nil {
+		this.routeTree = newRouteTree()
 	}
+	namespace = strings.Trim(namespace, "/")
 	controllerType := reflect.TypeOf(target)
 	numMethod := controllerType.NumMethod()
+	defaultMethods := []methodInfo{}
+	explicitMethods := []methodInfo{}
 	for i := 0; i != numMethod; i++ {
 		singleMethod := controllerType.Method(i)
 		singleMethodName := singleMethod.Name
@@ -84,72 +148,209 @@ func (this *handlerType) addRoute(namespace string, target ControllerInterface)
 		if len(methodName) < 2 {
 			continue
 		}
-		namespace := strings.Trim(namespace, "/")
-		methodName[0] = strings.Trim(methodName[0], "/")
-		var url string
-		if namespace != "" {
-			url = strings.ToLower(namespace + "/" + methodName[0])
-		} else {
-			url = strings.ToLower(methodName[0])
-		}
-		this.routerControllerMethod[url] = methodInfo{
+		httpMethods, isExplicit := this.parseHttpMethods(controllerType.Elem(), singleMethodName, methodName[2:])
+		method := methodInfo{
 			viewName:       this.firstLowerName(methodName[1]),
 			controllerType: controllerType.Elem(),
 			methodType:     singleMethod,
+			httpMethods:    httpMethods,
+			isWebsocket: singleMethod.Type.NumIn() == 2 &&
+				singleMethod.Type.In(1) == routeWebsocketConnType,
+		}
+		if isExplicit {
+			explicitMethods = append(explicitMethods, method)
+		} else {
+			defaultMethods = append(defaultMethods, method)
+		}
+	}
+	//显式声明HTTP Method的方法覆盖默认的方法
+	for _, method := range append(defaultMethods, explicitMethods...) {
+		methodName := strings.Trim(language.Explode(method.methodType.Name, "_")[0], "/")
+		var url string
+		if namespace != "" {
+			url = namespace + "/" + methodName
+		} else {
+			url = methodName
 		}
+		this.addRouteUrl(url, priority, method)
 	}
 	//预热ioc
 	injectIoc(reflect.ValueOf(target), nil)
 }
 
+func (this *handlerType) addRouteUrl(url string, priority int, method methodInfo) {
+	err := this.routeTree.Add(url, priority, method.httpMethods, method)
+	if err != nil {
+		panic(err)
+	}
+}
+
 func (this *handlerType) handleRequest(request *http.Request, response http.ResponseWriter) {
+	//生成请求Id，并返回给调用方
+	request, trace := withContextTrace(request)
+	response.Header().Set(TraceRequestIdHeader, trace.requestId)
+
 	//查找路由
-	url := request.URL.Path
-	url = strings.ToLower(strings.Trim(url, "/"))
-	method, isExist := this.routerControllerMethod[url]
-	if isExist == false {
-		globalBasic.Log.Error("file not found : %s", url)
-		response.WriteHeader(404)
-		response.Write([]byte("file not found"))
+	var route *routeInfo
+	var params map[string]string
+	if this.routeTree != nil {
+		route, params = this.routeTree.Find(request.URL.Path)
+	}
+	if route == nil {
+		basic := initBasic(request, response, nil)
+		writeRequestHeader(basic)
+		appError := newAppError(404, "file not found", "")
+		basic.Log.Error("file not found : %s ErrorId:[%s]", request.URL.Path, appError.Id)
+		writeAppError(basic, appError)
+		return
+	}
+	setResponseRoute(response, route.pattern)
+
+	//检查HTTP Method
+	allowMethods := route.getAllowMethods()
+	method, isExist := route.getMethod(request.Method)
+	if isExist == false && request.Method == "OPTIONS" {
+		//没有绑定OPTIONS时，直接响应预检请求
+		basic := initBasic(request, response, nil)
+		if basic.Security != nil {
+			basic.Security.WriteHeader()
+		}
+		if isAllowRequestIp(basic, route.pattern) == false {
+			return
+		}
+		response.Header().Set("Allow", strings.Join(allowMethods, ", "))
+		if basic.Cors != nil {
+			basic.Cors.WritePreflightHeader(basic.Ctx, allowMethods)
+		}
+		response.WriteHeader(204)
+		return
+	} else if isExist == false {
+		basic := initBasic(request, response, nil)
+		writeRequestHeader(basic)
+		if isAllowRequestIp(basic, route.pattern) == false {
+			return
+		}
+		appError := newAppError(405, "method not allowed", "")
+		basic.Log.Error("method not allowed : %s %s ErrorId:[%s]", request.Method, request.URL.Path, appError.Id)
+		response.Header().Set("Allow", strings.Join(allowMethods, ", "))
+		writeAppError(basic, appError)
 		return
 	}
 
 	//执行路由
 	controller := reflect.New(method.controllerType)
-	this.runRequest(controller, method, request, response)
+	this.runRequest(controller, route.pattern, method, params, request, response)
 }
 
-func (this *handlerType) runRequest(controller reflect.Value, method methodInfo, request *http.Request, response http.ResponseWriter) {
-	urlMethod := request.Method
+func (this *handlerType) runRequest(controller reflect.Value, pattern string, method methodInfo, params map[string]string, request *http.Request, response http.ResponseWriter) {
+	routerMethod := method.toAppRouterMethodInfo(pattern)
+	timeout := getRouteTimeout(routerMethod, method.isWebsocket || method.viewName == "sse")
+	if timeout > 0 {
+		ctx, cancel := context.WithTimeout(request.Context(), timeout)
+		defer cancel()
+		request = request.WithContext(ctx)
+	}
 	basic := initBasic(request, response, nil)
+	for key, value := range params {
+		basic.Ctx.SetParam(key, value)
+	}
 	target := controller.Interface().(ControllerInterface)
 	injectIoc(controller, basic)
 	defer language.CatchCrash(func(exception language.Exception) {
-		basic.Log.Critical("Buiness Crash Code:[%d] Message:[%s]\nStackTrace:[%s]", exception.GetCode(), exception.GetMessage(), exception.GetStackTrace())
-		response.WriteHeader(500)
-		response.Write([]byte("server internal error"))
+		appError := newAppError(500, "server internal error", exception.GetMessage()+"\n"+exception.GetStackTrace())
+		basic.Log.Critical("Buiness Crash ErrorId:[%s] Code:[%d] Message:[%s]\nStackTrace:[%s]", appError.Id, exception.GetCode(), exception.GetMessage(), exception.GetStackTrace())
+		writeAppError(basic, appError)
 	})
+	writeRequestHeader(basic)
+	if isAllowRequestIp(basic, pattern) == false {
+		return
+	}
+	if basic.Security != nil && basic.Security.IsValidCsrf(pattern) == false {
+		appError := newAppError(403, "invalid csrf token", "")
+		basic.Log.Warning("invalid csrf token : %s %s ErrorId:[%s]", request.Method, request.URL.Path, appError.Id)
+		writeAppError(basic, appError)
+		return
+	}
 	var controllerResult interface{}
-	if urlMethod == "GET" || urlMethod == "POST" ||
-		urlMethod == "DELETE" || urlMethod == "PUT" {
-		result := this.runRequestBusiness(target, method.methodType.Func, []reflect.Value{controller}, basic)
-		if len(result) >= 1 {
-			controllerResult = result[0].Interface()
-		} else {
-			controllerResult = nil
-		}
+	isFinish := true
+	isUpgrade := false
+	result := this.runRequestBusiness(basic, func() []reflect.Value {
+		var result []reflect.Value
+		isFinish = runRouteMiddlewares(getRouteMiddlewares(routerMethod), basic, routerMethod, func() {
+			if method.isWebsocket {
+				result = this.runWebsocket(controller, method, basic, request, response, &isUpgrade)
+			} else {
+				result = method.methodType.Func.Call([]reflect.Value{controller})
+			}
+		})
+		return result
+	})
+	if isFinish == false && len(result) == 0 {
+		//中间件中断了请求
+		return
+	}
+	if isUpgrade {
+		//websocket握手后连接已被接管，不再输出
+		return
+	}
+	if len(result) >= 1 {
+		controllerResult = result[0].Interface()
 	} else {
 		controllerResult = nil
 	}
+	if exception, ok := controllerResult.(language.Exception); ok {
+		//RateLimiter.Check超过限制时，与限流中间件一样输出429
+		if rateLimit, ok := getRateLimitExceed(exception); ok {
+			writeRateLimitError(basic, pattern, rateLimit.key, rateLimit.retryAfter)
+			return
+		}
+	}
 	target.AutoRender(controllerResult, method.viewName)
 }
 
-func (this *handlerType) runRequestBusiness(target ControllerInterface, method reflect.Value, arguments []reflect.Value, basic *Basic) (result []reflect.Value) {
+func (this *handlerType) runWebsocket(controller reflect.Value, method methodInfo, basic *Basic, request *http.Request, response http.ResponseWriter, isUpgrade *bool) []reflect.Value {
+	hub, ok := basic.Websocket.(*websocketHubImplement)
+	if ok == false {
+		language.Throw(1, "websocket hub is not init")
+	}
+	conn, err := hub.newConn(request, response, basic.Cors)
+	if err != nil {
+		language.Throw(1, err.Error())
+	}
+	*isUpgrade = true
+	defer conn.Close()
+	return method.methodType.Func.Call([]reflect.Value{controller, reflect.ValueOf(conn)})
+}
+
+// 错误响应同样需要Cors头，跨域的调用方才能读取错误信息
+func writeRequestHeader(basic *Basic) {
+	if basic.Cors != nil {
+		basic.Cors.WriteHeader(basic.Ctx)
+	}
+	if basic.Security != nil {
+		basic.Security.WriteHeader()
+	}
+}
+
+// 检查namespace的ip规则，不允许时输出403
+func isAllowRequestIp(basic *Basic, pattern string) bool {
+	if basic.Security == nil || basic.Security.IsAllowIp(pattern) {
+		return true
+	}
+	appError := newAppError(403, "forbidden", "")
+	basic.Log.Warning("ip forbidden : %s %s ErrorId:[%s]", basic.Ctx.GetClientIP(), basic.Ctx.GetUrl().Path, appError.Id)
+	writeAppError(basic, appError)
+	return false
+}
+
+func (this *handlerType) runRequestBusiness(basic *Basic, handler func() []reflect.Value) (result []reflect.Value) {
 	defer language.Catch(func(exception language.Exception) {
-		basic.Log.Error("Buiness Error Code:[%d] Message:[%s]\nStackTrace:[%s]", exception.GetCode(), exception.GetMessage(), exception.GetStackTrace())
+		if _, ok := getRateLimitExceed(exception); ok == false {
+			basic.Log.Error("Buiness Error Code:[%d] Message:[%s]\nStackTrace:[%s]", exception.GetCode(), exception.GetMessage(), exception.GetStackTrace())
+		}
 		result = []reflect.Value{reflect.ValueOf(exception)}
 	})
-	result = method.Call(arguments)
+	result = handler()
 	return
 }
 
@@ -163,8 +364,14 @@ var middlewares []AppRouterMiddlware
 
 type AppRouterMiddlware func(http.HandlerFunc) http.HandlerFunc
 
+// namespace支持{name}或:name命名参数，*name通配参数，参数可通过Ctx.GetParam获取
 func InitRoute(namespace string, target ControllerInterface) {
-	handler.addRoute(namespace, target)
+	handler.addRoute(namespace, target, 0)
+}
+
+// 多个路由同时匹配时，priority大的优先
+func InitRouteWithPriority(namespace string, target ControllerInterface, priority int) {
+	handler.addRoute(namespace, target, priority)
 }
 
 func runServer(httpHandler http.Handler) error {
@@ -189,7 +396,21 @@ func runServer(httpHandler http.Handler) error {
 	return nil
 }
 
+// 第一个参数为migrate时执行数据库迁移后退出，如./mes3 migrate up
 func Run() error {
+	if len(os.Args) >= 2 && os.Args[1] == "migrate" {
+		err := runMigrateCommand(os.Args[2:])
+		if err != nil {
+			globalBasic.Log.Error("migrate fail! " + err.Error())
+		}
+		destroyBasic()
+		return err
+	}
+	err := checkMigrateOnStart()
+	if err != nil {
+		globalBasic.Log.Critical("migrate check fail! " + err.Error())
+		return err
+	}
 	handler.initMiddlewares(middlewares)
 	return runServer(&handler)
 }
@@ -0,0 +1,469 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/milkbobo/fishgoweb/language"
+)
+
+// 接口文档的描述，Input为Check使用的参数结构体，Output为业务方法返回的数据
+// Output为空时使用业务方法的返回类型，返回类型为interface{}时不生成数据的schema
+type AppRouterApiDoc struct {
+	Summary     string
+	Description string
+	Tags        []string
+	Input       interface{}
+	Output      interface{}
+}
+
+type routeApiDocMethod struct {
+	controllerType reflect.Type
+	methodName     string
+	doc            AppRouterApiDoc
+}
+
+type apiDocEnvelope struct {
+	dataType  reflect.Type
+	dataField string
+}
+
+var (
+	routeApiDocMethods  []routeApiDocMethod
+	routeApiDocEnvelope *apiDocEnvelope
+)
+
+type apiDocBuilder struct {
+	schemas     map[string]interface{}
+	schemaNames map[reflect.Type]string
+}
+
+// 单个控制器方法的接口文档，如AddMethodApiDoc(&IndexController{}, "Test_Json", doc)
+func AddMethodApiDoc(target ControllerInterface, methodName string, doc AppRouterApiDoc) {
+	controllerType := reflect.TypeOf(target)
+	if _, isExist := controllerType.MethodByName(methodName); isExist == false {
+		panic("invalid controller method " + controllerType.String() + "." + methodName)
+	}
+	routeApiDocMethods = append(routeApiDocMethods, routeApiDocMethod{
+		controllerType: controllerType.Elem(),
+		methodName:     methodName,
+		doc:            doc,
+	})
+}
+
+// json视图外层的返回结构，dataField为存放业务数据的字段，如SetApiDocEnvelope(baseControllerResult{}, "Data")
+func SetApiDocEnvelope(envelope interface{}, dataField string) {
+	dataType := reflect.TypeOf(envelope)
+	for dataType.Kind() == reflect.Ptr {
+		dataType = dataType.Elem()
+	}
+	if _, isExist := dataType.FieldByName(dataField); isExist == false {
+		panic("invalid envelope field " + dataType.String() + "." + dataField)
+	}
+	routeApiDocEnvelope = &apiDocEnvelope{
+		dataType:  dataType,
+		dataField: dataField,
+	}
+}
+
+func getApiDocMethod(method methodInfo) AppRouterApiDoc {
+	for _, single := range routeApiDocMethods {
+		if single.controllerType == method.controllerType &&
+			single.methodName == method.methodType.Name {
+			return single.doc
+		}
+	}
+	return AppRouterApiDoc{}
+}
+
+func getApiDocFieldName(field reflect.StructField, nameTag string) (string, bool) {
+	if nameTag == "json" {
+		//与encoding/json的字段名一致
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			return "", false
+		}
+		if name == "" {
+			name = field.Name
+		}
+		return name, true
+	}
+	return getValidateNameMapper(field, nameTag), true
+}
+
+func (this *apiDocBuilder) getSchemaName(dataType reflect.Type) string {
+	name, isExist := this.schemaNames[dataType]
+	if isExist {
+		return name
+	}
+	name = dataType.Name()
+	for _, single := range this.schemaNames {
+		if single == name {
+			name = strings.Replace(dataType.String(), ".", "_", -1)
+			break
+		}
+	}
+	this.schemaNames[dataType] = name
+	return name
+}
+
+func (this *apiDocBuilder) setValidateSchema(schema map[string]interface{}, dataType reflect.Type, rules []validateRule) {
+	for dataType.Kind() == reflect.Ptr {
+		dataType = dataType.Elem()
+	}
+	isString := dataType.Kind() == reflect.String
+	isArray := dataType.Kind() == reflect.Slice || dataType.Kind() == reflect.Array
+	minName, maxName := "minimum", "maximum"
+	if isString {
+		minName, maxName = "minLength", "maxLength"
+	} else if isArray {
+		minName, maxName = "minItems", "maxItems"
+	}
+	for _, rule := range rules {
+		switch rule.name {
+		case "min":
+			schema[minName] = rule.min
+		case "max":
+			schema[maxName] = rule.max
+		case "length":
+			if isArray {
+				minName, maxName = "minItems", "maxItems"
+			} else {
+				minName, maxName = "minLength", "maxLength"
+			}
+			if rule.hasMin {
+				schema[minName] = rule.min
+			}
+			if rule.hasMax {
+				schema[maxName] = rule.max
+			}
+		case "regex", "mobile":
+			schema["pattern"] = rule.regexp.String()
+		case "email":
+			schema["format"] = "email"
+		case "enum":
+			enum := []interface{}{}
+			for _, single := range getValidateEnum(rule.argument) {
+				if isString {
+					enum = append(enum, single)
+				} else if number, err := strconv.ParseFloat(single, 64); err == nil {
+					enum = append(enum, number)
+				}
+			}
+			schema["enum"] = enum
+		}
+	}
+}
+
+func (this *apiDocBuilder) getStructSchema(dataType reflect.Type, nameTag string, skipFields []string) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	var walk func(dataType reflect.Type)
+	walk = func(dataType reflect.Type) {
+		for i := 0; i != dataType.NumField(); i++ {
+			field := dataType.Field(i)
+			if field.PkgPath != "" && field.Anonymous == false {
+				continue
+			}
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				walk(field.Type)
+				continue
+			}
+			name, isExport := getApiDocFieldName(field, nameTag)
+			if isExport == false || language.ArrayIn(skipFields, name) != -1 {
+				continue
+			}
+			isRequired, rules, err := parseValidateTag(field.Tag.Get("validate"))
+			if err != nil {
+				panic(dataType.String() + "." + field.Name + " " + err.Error())
+			}
+			schema := this.getSchema(field.Type, nameTag)
+			if len(rules) != 0 {
+				//带校验规则的字段不能直接使用$ref
+				if _, isRef := schema["$ref"]; isRef {
+					schema = map[string]interface{}{"allOf": []interface{}{schema}}
+				}
+				this.setValidateSchema(schema, field.Type, rules)
+			}
+			properties[name] = schema
+			if isRequired {
+				required = append(required, name)
+			}
+		}
+	}
+	walk(dataType)
+	result := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) != 0 {
+		result["required"] = required
+	}
+	return result
+}
+
+func (this *apiDocBuilder) getSchema(dataType reflect.Type, nameTag string) map[string]interface{} {
+	for dataType.Kind() == reflect.Ptr {
+		dataType = dataType.Elem()
+	}
+	if dataType == reflect.TypeOf(language.Decimal("")) {
+		return map[string]interface{}{"type": "string", "format": "decimal"}
+	} else if dataType == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch dataType.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Float32:
+		return map[string]interface{}{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if dataType.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{
+			"type":  "array",
+			"items": this.getSchema(dataType.Elem(), nameTag),
+		}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": this.getSchema(dataType.Elem(), nameTag),
+		}
+	case reflect.Struct:
+		if dataType.Name() == "" {
+			return this.getStructSchema(dataType, nameTag, nil)
+		}
+		//具名结构体放到components中复用，输入参数与返回数据的字段名规则不同
+		name := this.getSchemaName(dataType)
+		if nameTag != "json" {
+			name += "Input"
+		}
+		if _, isExist := this.schemas[name]; isExist == false {
+			this.schemas[name] = map[string]interface{}{}
+			this.schemas[name] = this.getStructSchema(dataType, nameTag, nil)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+func (this *apiDocBuilder) getOutputSchema(output reflect.Type) map[string]interface{} {
+	var dataSchema map[string]interface{}
+	if output != nil {
+		dataSchema = this.getSchema(output, "json")
+	} else {
+		dataSchema = map[string]interface{}{}
+	}
+	if routeApiDocEnvelope == nil {
+		return dataSchema
+	}
+	dataField, _ := routeApiDocEnvelope.dataType.FieldByName(routeApiDocEnvelope.dataField)
+	dataName, _ := getApiDocFieldName(dataField, "json")
+	result := this.getStructSchema(routeApiDocEnvelope.dataType, "json", nil)
+	result["properties"].(map[string]interface{})[dataName] = dataSchema
+	return result
+}
+
+func (this *apiDocBuilder) getOperation(route *routeInfo, httpMethod string, method methodInfo) map[string]interface{} {
+	doc := getApiDocMethod(method)
+	controllerName := method.controllerType.Name()
+	result := map[string]interface{}{
+		"operationId": controllerName + "_" + method.methodType.Name + "_" + httpMethod,
+	}
+	if len(doc.Tags) != 0 {
+		result["tags"] = doc.Tags
+	} else {
+		result["tags"] = []string{controllerName}
+	}
+	if doc.Summary != "" {
+		result["summary"] = doc.Summary
+	}
+	if doc.Description != "" {
+		result["description"] = doc.Description
+	}
+
+	//路径参数
+	parameters := []interface{}{}
+	for _, name := range route.paramNames {
+		parameters = append(parameters, map[string]interface{}{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]interface{}{"type": "string"},
+		})
+	}
+
+	//输入参数，GET，HEAD与DELETE放在url中，其他放在请求体中
+	if doc.Input != nil {
+		inputType := reflect.TypeOf(doc.Input)
+		for inputType.Kind() == reflect.Ptr {
+			inputType = inputType.Elem()
+		}
+		inputSchema := this.getStructSchema(inputType, "url", route.paramNames)
+		if httpMethod == "GET" || httpMethod == "HEAD" || httpMethod == "DELETE" {
+			required, _ := inputSchema["required"].([]string)
+			properties := inputSchema["properties"].(map[string]interface{})
+			names := []string{}
+			for name := range properties {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				parameters = append(parameters, map[string]interface{}{
+					"name":     name,
+					"in":       "query",
+					"required": language.ArrayIn(required, name) != -1,
+					"schema":   properties[name],
+				})
+			}
+		} else {
+			result["requestBody"] = map[string]interface{}{
+				"content": map[string]interface{}{
+					"application/json":                  map[string]interface{}{"schema": inputSchema},
+					"application/x-www-form-urlencoded": map[string]interface{}{"schema": inputSchema},
+				},
+			}
+		}
+	}
+	if len(parameters) != 0 {
+		result["parameters"] = parameters
+	}
+
+	//返回数据
+	response := map[string]interface{}{
+		"description": "OK",
+	}
+	if method.viewName == "json" || method.viewName == RendererAutoName {
+		var outputType reflect.Type
+		if doc.Output != nil {
+			outputType = reflect.TypeOf(doc.Output)
+		} else if methodType := method.methodType.Type; methodType.NumOut() != 0 &&
+			methodType.Out(0).Kind() != reflect.Interface {
+			outputType = methodType.Out(0)
+		}
+		response["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{
+				"schema": this.getOutputSchema(outputType),
+			},
+		}
+	}
+	result["responses"] = map[string]interface{}{
+		"200": response,
+	}
+	return result
+}
+
+// 从InitRoute注册的路由生成OpenAPI 3文档
+func GetApiDoc(title string, version string) ([]byte, error) {
+	builder := &apiDocBuilder{
+		schemas:     map[string]interface{}{},
+		schemaNames: map[reflect.Type]string{},
+	}
+	paths := map[string]interface{}{}
+	if handler.routeTree != nil {
+		for _, route := range handler.routeTree.Routes() {
+			path := strings.Replace(route.pattern, "...}", "}", -1)
+			operations := map[string]interface{}{}
+			for httpMethod, method := range route.methods {
+				if httpMethod == "HEAD" || httpMethod == "OPTIONS" {
+					continue
+				}
+				operations[strings.ToLower(httpMethod)] = builder.getOperation(route, httpMethod, method)
+			}
+			paths[path] = operations
+		}
+	}
+
+	//同一个控制器注册在多个namespace下时，operationId需要唯一
+	pathNames := []string{}
+	for path := range paths {
+		pathNames = append(pathNames, path)
+	}
+	sort.Strings(pathNames)
+	operationIds := map[string]bool{}
+	for _, path := range pathNames {
+		for _, operation := range paths[path].(map[string]interface{}) {
+			operationMap := operation.(map[string]interface{})
+			operationId := operationMap["operationId"].(string)
+			for i := 2; operationIds[operationId]; i++ {
+				operationId = operationMap["operationId"].(string) + "_" + strconv.Itoa(i)
+			}
+			operationMap["operationId"] = operationId
+			operationIds[operationId] = true
+		}
+	}
+
+	result := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   title,
+			"version": version,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": builder.schemas,
+		},
+	}
+	return json.MarshalIndent(result, "", "  ")
+}
+
+type apiDocRoute struct {
+	url     string
+	version string
+}
+
+var globalApiDoc *apiDocRoute
+
+// 在url上输出OpenAPI文档，如InitApiDocRoute("/openapi.json", "1.0.0")
+// 非prod环境直接输出，prod环境需要配置[debug]，并且只允许debug的ipwhite访问
+func InitApiDocRoute(url string, version string) {
+	globalApiDoc = &apiDocRoute{
+		url:     url,
+		version: version,
+	}
+}
+
+func getApiDocHandler(request *http.Request) http.Handler {
+	if globalApiDoc == nil || request.URL.Path != globalApiDoc.url {
+		return nil
+	}
+	if globalBasic.Config.GetRunMode() == "prod" && globalDebug == nil {
+		return nil
+	}
+	return globalApiDoc
+}
+
+func (this *apiDocRoute) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	if globalBasic.Config.GetRunMode() == "prod" &&
+		globalDebug.IsAllowIp(request) == false {
+		response.WriteHeader(403)
+		response.Write([]byte("forbidden"))
+		return
+	}
+	title := globalBasic.Config.Get().Appname
+	if title == "" {
+		title = "api"
+	}
+	data, err := GetApiDoc(title, this.version)
+	if err != nil {
+		globalBasic.Log.Error("api doc fail : %v", err.Error())
+		response.WriteHeader(500)
+		response.Write([]byte("server internal error"))
+		return
+	}
+	response.Header().Set("Content-Type", "application/json; charset=utf-8")
+	response.Write(data)
+}
@@ -0,0 +1,167 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/milkbobo/fishgoweb/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type apiDocTestResult struct {
+	Code int
+	Data interface{}
+	Msg  string
+}
+
+type apiDocTestInput struct {
+	Id    int
+	Name  string `validate:",required,length=2~10"`
+	Email string `url:"mail" validate:",email"`
+}
+
+type apiDocTestOutput struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type apiDocTestController struct {
+	Controller
+}
+
+func (this *apiDocTestController) Get_Json_Get() apiDocTestOutput {
+	return apiDocTestOutput{}
+}
+
+func (this *apiDocTestController) Save_Json_Post() interface{} {
+	return nil
+}
+
+func (this *apiDocTestController) AutoRender(data interface{}, viewName string) {
+}
+
+func TestApiDoc(t *testing.T) {
+	oldRouteTree := handler.routeTree
+	oldRouteApiDocMethods := routeApiDocMethods
+	oldRouteApiDocEnvelope := routeApiDocEnvelope
+	defer func() {
+		handler.routeTree = oldRouteTree
+		routeApiDocMethods = oldRouteApiDocMethods
+		routeApiDocEnvelope = oldRouteApiDocEnvelope
+	}()
+
+	handler.routeTree = nil
+	handler.addRoute("/user/{id}", &apiDocTestController{}, 0)
+	SetApiDocEnvelope(apiDocTestResult{}, "Data")
+	AddMethodApiDoc(&apiDocTestController{}, "Get_Json_Get", AppRouterApiDoc{
+		Summary: "获取用户",
+		Input:   apiDocTestInput{},
+	})
+	AddMethodApiDoc(&apiDocTestController{}, "Save_Json_Post", AppRouterApiDoc{
+		Tags:  []string{"user"},
+		Input: &apiDocTestInput{},
+	})
+
+	data, err := GetApiDoc("test", "1.0.0")
+	assert.AssertEqual(t, err, nil)
+	var doc struct {
+		Openapi string
+		Paths   map[string]map[string]struct {
+			OperationId string
+			Tags        []string
+			Summary     string
+			Parameters  []struct {
+				Name     string
+				In       string
+				Required bool
+			}
+			RequestBody struct {
+				Content map[string]struct {
+					Schema struct {
+						Required   []string
+						Properties map[string]map[string]interface{}
+					}
+				}
+			}
+			Responses map[string]struct {
+				Content map[string]struct {
+					Schema struct {
+						Properties map[string]map[string]interface{}
+					}
+				}
+			}
+		}
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]interface{}
+			}
+		}
+	}
+	err = json.Unmarshal(data, &doc)
+	assert.AssertEqual(t, err, nil)
+	assert.AssertEqual(t, doc.Openapi, "3.0.3")
+
+	getOperation := doc.Paths["/user/{id}/get"]["get"]
+	assert.AssertEqual(t, getOperation.OperationId, "apiDocTestController_Get_Json_Get_GET")
+	assert.AssertEqual(t, getOperation.Tags, []string{"apiDocTestController"})
+	assert.AssertEqual(t, getOperation.Summary, "获取用户")
+	parameters := []string{}
+	for _, single := range getOperation.Parameters {
+		parameters = append(parameters, single.In+":"+single.Name)
+		if single.Name == "name" || single.Name == "id" {
+			assert.AssertEqual(t, single.Required, true)
+		}
+	}
+	assert.AssertEqual(t, parameters, []string{"path:id", "query:mail", "query:name"})
+	getData := getOperation.Responses["200"].Content["application/json"].Schema.Properties["Data"]
+	assert.AssertEqual(t, getData["$ref"], "#/components/schemas/apiDocTestOutput")
+	assert.AssertEqual(t, len(doc.Components.Schemas["apiDocTestOutput"].Properties), 2)
+
+	saveOperation := doc.Paths["/user/{id}/save"]["post"]
+	assert.AssertEqual(t, saveOperation.Tags, []string{"user"})
+	saveSchema := saveOperation.RequestBody.Content["application/json"].Schema
+	assert.AssertEqual(t, saveSchema.Required, []string{"name"})
+	assert.AssertEqual(t, saveSchema.Properties["name"]["minLength"], 2.0)
+	assert.AssertEqual(t, saveSchema.Properties["mail"]["format"], "email")
+	_, isExist := saveSchema.Properties["id"]
+	assert.AssertEqual(t, isExist, false)
+	_, isExist = doc.Paths["/user/{id}/save"]["get"]
+	assert.AssertEqual(t, isExist, false)
+}
+
+func TestApiDocRoute(t *testing.T) {
+	oldApiDoc := globalApiDoc
+	oldDebug := globalDebug
+	oldConfig := globalBasic.Config
+	defer func() {
+		globalApiDoc = oldApiDoc
+		globalDebug = oldDebug
+		globalBasic.Config = oldConfig
+	}()
+	InitApiDocRoute("/openapi.json", "1.0.0")
+	server := httptest.NewServer(http.HandlerFunc(handler.innerServeHTTP))
+	defer server.Close()
+	get := func(proxy string) int {
+		request, _ := http.NewRequest("GET", server.URL+"/openapi.json", nil)
+		if proxy != "" {
+			request.Header.Set("X-Forwarded-For", proxy)
+		}
+		response, err := http.DefaultClient.Do(request)
+		assert.AssertEqual(t, err, nil)
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	//非prod环境直接输出
+	assert.AssertEqual(t, get(""), 200)
+
+	//prod环境没有配置debug时不输出，配置后只允许ipwhite访问
+	globalBasic.Config = &configureImplement{runMode: "prod", configer: oldConfig.Get()}
+	globalDebug = nil
+	assert.AssertEqual(t, get(""), 404)
+	globalDebug, _ = NewDebug(DebugConfig{Path: "/debug", IpWhite: []string{"10.0.0.1"}})
+	assert.AssertEqual(t, get(""), 403)
+	assert.AssertEqual(t, get("10.0.0.1"), 403)
+	globalDebug, _ = NewDebug(DebugConfig{Path: "/debug", IpWhite: []string{"127.0.0.1"}})
+	assert.AssertEqual(t, get(""), 200)
+}
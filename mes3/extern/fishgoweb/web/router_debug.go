@@ -0,0 +1,279 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	runtimePprof "runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/milkbobo/fishgoweb/language"
+)
+
+type DebugConfig struct {
+	Path    string
+	IpWhite []string
+}
+
+type Debug interface {
+	http.Handler
+	GetPath() string
+	IsAllowIp(request *http.Request) bool
+}
+
+type debugImplement struct {
+	config   DebugConfig
+	ipWhites []*net.IPNet
+}
+
+type debugSlowItem struct {
+	RequestTime string  `json:"requestTime"`
+	Duration    float64 `json:"duration"`
+	Method      string  `json:"method"`
+	Url         string  `json:"url"`
+	RemoteIp    string  `json:"remoteIp"`
+	RequestId   string  `json:"requestId"`
+}
+
+type debugRouteItem struct {
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+	Handler string `json:"handler"`
+}
+
+type debugDatabaseItem struct {
+	Name              string  `json:"name"`
+	MaxOpen           int     `json:"maxOpen"`
+	Open              int     `json:"open"`
+	InUse             int     `json:"inUse"`
+	Idle              int     `json:"idle"`
+	WaitCount         int64   `json:"waitCount"`
+	WaitDuration      float64 `json:"waitDuration"`
+	MaxIdleClosed     int64   `json:"maxIdleClosed"`
+	MaxLifetimeClosed int64   `json:"maxLifetimeClosed"`
+}
+
+// 调试接口默认关闭，需要同时配置path与ipwhite，ipwhite支持ip与CIDR
+func NewDebug(config DebugConfig) (Debug, error) {
+	if config.Path == "" {
+		return nil, nil
+	}
+	config.Path = "/" + strings.Trim(config.Path, "/")
+	if len(config.IpWhite) == 0 {
+		return nil, errors.New("debug ipwhite can not be empty")
+	}
+	result := &debugImplement{
+		config: config,
+	}
+	for _, single := range config.IpWhite {
+		ipNet, err := parseSecurityIpNet(single)
+		if err != nil {
+			return nil, errors.New("invalid debug ipwhite " + single)
+		}
+		result.ipWhites = append(result.ipWhites, ipNet)
+	}
+	return result, nil
+}
+
+func NewDebugFromConfig() (Debug, error) {
+	debugConfig := DebugConfig{}
+	debugConfig.Path = globalBasic.Config.Get().Debug.Path
+	debugConfig.IpWhite = Explode(globalBasic.Config.Get().Debug.IpWhite, ",")
+	return NewDebug(debugConfig)
+}
+
+// 返回停留时间最长的topSize个请求，按请求时间从早到晚排序
+func GetSlowRequests(topSize int) []AppRouterSlowItem {
+	now := time.Now()
+	result := []AppRouterSlowItem{}
+	for _, single := range oldestStay.OldestStay(topSize) {
+		requestTime := time.Unix(0, single.Timestamp)
+		result = append(result, AppRouterSlowItem{
+			RequestTime: requestTime,
+			Duration:    now.Sub(requestTime),
+			Request:     single.Value.(*http.Request),
+		})
+	}
+	return result
+}
+
+func getDebugHandler(request *http.Request) http.Handler {
+	if globalDebug == nil {
+		return nil
+	}
+	path := request.URL.Path
+	if path != globalDebug.GetPath() && strings.HasPrefix(path, globalDebug.GetPath()+"/") == false {
+		return nil
+	}
+	return globalDebug
+}
+
+func (this *debugImplement) GetPath() string {
+	return this.config.Path
+}
+
+// 只有直连的对端是可信代理时才使用X-Forwarded-For，避免伪造请求头绕过白名单
+func (this *debugImplement) IsAllowIp(request *http.Request) bool {
+	ip := getRequestClientIp(request, globalTrustedProxies)
+	if ip == nil {
+		return false
+	}
+	return isSecurityIpIn(this.ipWhites, ip)
+}
+
+func (this *debugImplement) writeJson(response http.ResponseWriter, data interface{}) {
+	result, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		response.WriteHeader(500)
+		response.Write([]byte(err.Error()))
+		return
+	}
+	response.Header().Set("Content-Type", "application/json; charset=utf-8")
+	response.Write(result)
+}
+
+func (this *debugImplement) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	if this.IsAllowIp(request) == false {
+		response.WriteHeader(403)
+		response.Write([]byte("forbidden"))
+		return
+	}
+	path := strings.TrimPrefix(request.URL.Path, this.config.Path)
+	path = strings.Trim(path, "/")
+	switch {
+	case path == "":
+		this.serveIndex(response)
+	case path == "slow":
+		this.serveSlow(response, request)
+	case path == "goroutine":
+		this.serveGoroutine(response)
+	case path == "db":
+		this.serveDatabase(response)
+	case path == "routes":
+		this.serveRoutes(response)
+	case path == "pprof" || strings.HasPrefix(path, "pprof/"):
+		this.servePprof(response, request, strings.TrimPrefix(strings.TrimPrefix(path, "pprof"), "/"))
+	default:
+		response.WriteHeader(404)
+		response.Write([]byte("not found"))
+	}
+}
+
+func (this *debugImplement) serveIndex(response http.ResponseWriter) {
+	result := []string{
+		this.config.Path + "/slow?top=10",
+		this.config.Path + "/goroutine",
+		this.config.Path + "/db",
+		this.config.Path + "/routes",
+		this.config.Path + "/pprof/",
+	}
+	response.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	response.Write([]byte(strings.Join(result, "\n") + "\n"))
+}
+
+func (this *debugImplement) serveSlow(response http.ResponseWriter, request *http.Request) {
+	topSize, err := strconv.Atoi(request.URL.Query().Get("top"))
+	if err != nil || topSize <= 0 {
+		topSize = 10
+	}
+	result := []debugSlowItem{}
+	for _, single := range GetSlowRequests(topSize) {
+		ctx := &contextImplement{request: single.Request}
+		result = append(result, debugSlowItem{
+			RequestTime: single.RequestTime.Format(time.RFC3339Nano),
+			Duration:    float64(single.Duration) / float64(time.Millisecond),
+			Method:      single.Request.Method,
+			Url:         single.Request.URL.RequestURI(),
+			RemoteIp:    strings.TrimSpace(ctx.GetRemoteIP()),
+			RequestId:   single.Request.Header.Get(TraceRequestIdHeader),
+		})
+	}
+	this.writeJson(response, result)
+}
+
+func (this *debugImplement) serveGoroutine(response http.ResponseWriter) {
+	response.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	runtimePprof.Lookup("goroutine").WriteTo(response, 2)
+}
+
+func (this *debugImplement) serveDatabase(response http.ResponseWriter) {
+	result := []debugDatabaseItem{}
+	for name, db := range globalBasic.getDatabases() {
+		stats := db.GetStats()
+		result = append(result, debugDatabaseItem{
+			Name:              name,
+			MaxOpen:           stats.MaxOpenConnections,
+			Open:              stats.OpenConnections,
+			InUse:             stats.InUse,
+			Idle:              stats.Idle,
+			WaitCount:         stats.WaitCount,
+			WaitDuration:      stats.WaitDuration.Seconds(),
+			MaxIdleClosed:     stats.MaxIdleClosed,
+			MaxLifetimeClosed: stats.MaxLifetimeClosed,
+		})
+	}
+	sort.Slice(result, func(i int, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	this.writeJson(response, result)
+}
+
+func (this *debugImplement) serveRoutes(response http.ResponseWriter) {
+	result := []debugRouteItem{}
+	if handler.routeTree != nil {
+		for _, route := range handler.routeTree.Routes() {
+			for httpMethod, method := range route.methods {
+				result = append(result, debugRouteItem{
+					Method:  httpMethod,
+					Path:    route.pattern,
+					Handler: method.controllerType.String() + "." + method.methodType.Name,
+				})
+			}
+		}
+	}
+	sort.Slice(result, func(i int, j int) bool {
+		if result[i].Path != result[j].Path {
+			return result[i].Path < result[j].Path
+		}
+		return result[i].Method < result[j].Method
+	})
+	this.writeJson(response, result)
+}
+
+// pprof.Index只识别/debug/pprof/前缀，这里按名称分发到对应的profile
+func (this *debugImplement) servePprof(response http.ResponseWriter, request *http.Request, name string) {
+	switch name {
+	case "":
+		result := []string{}
+		for _, single := range runtimePprof.Profiles() {
+			result = append(result, this.config.Path+"/pprof/"+single.Name()+"?debug=1")
+		}
+		sort.Strings(result)
+		result = append(result,
+			this.config.Path+"/pprof/profile?seconds=30",
+			this.config.Path+"/pprof/trace?seconds=5",
+		)
+		response.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		response.Write([]byte(strings.Join(result, "\n") + "\n"))
+	case "cmdline":
+		pprof.Cmdline(response, request)
+	case "profile":
+		pprof.Profile(response, request)
+	case "symbol":
+		pprof.Symbol(response, request)
+	case "trace":
+		pprof.Trace(response, request)
+	default:
+		if runtimePprof.Lookup(name) == nil {
+			response.WriteHeader(404)
+			response.Write([]byte("unknown profile " + name))
+			return
+		}
+		pprof.Handler(name).ServeHTTP(response, request)
+	}
+}
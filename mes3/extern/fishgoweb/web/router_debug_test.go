@@ -0,0 +1,160 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/milkbobo/fishgoweb/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type debugTestController struct {
+	Controller
+}
+
+var debugTestWait = make(chan bool)
+
+func (this *debugTestController) Wait_Json() interface{} {
+	<-debugTestWait
+	return nil
+}
+
+func (this *debugTestController) AutoRender(data interface{}, viewName string) {
+	this.Ctx.Write([]byte("ok"))
+}
+
+func TestDebugConfig(t *testing.T) {
+	debug, err := NewDebug(DebugConfig{})
+	assert.AssertEqual(t, debug, nil)
+	assert.AssertEqual(t, err, nil)
+	_, err = NewDebug(DebugConfig{Path: "/debug"})
+	assert.AssertEqual(t, err.Error(), "debug ipwhite can not be empty")
+	_, err = NewDebug(DebugConfig{Path: "/debug", IpWhite: []string{"10.0.0.0/33"}})
+	assert.AssertEqual(t, err.Error(), "invalid debug ipwhite 10.0.0.0/33")
+
+	debug, err = NewDebug(DebugConfig{Path: "debug/", IpWhite: []string{"127.0.0.1", "10.0.0.0/8", "::1"}})
+	assert.AssertEqual(t, err, nil)
+	assert.AssertEqual(t, debug.GetPath(), "/debug")
+	oldTrustedProxies := globalTrustedProxies
+	defer func() {
+		globalTrustedProxies = oldTrustedProxies
+	}()
+	testCase := []struct {
+		remoteAddr     string
+		proxy          string
+		trustedProxies []string
+		isAllow        bool
+	}{
+		{"127.0.0.1:1234", "", nil, true},
+		{"[::1]:1234", "", nil, true},
+		{"192.168.1.1:1234", "", nil, false},
+		//对端不是可信代理时忽略X-Forwarded-For
+		{"192.168.1.1:1234", "127.0.0.1", nil, false},
+		{"127.0.0.1:1234", "192.168.1.1", nil, true},
+		//可信代理从右往左取第一个不可信的地址
+		{"192.168.1.1:1234", "10.2.3.4", []string{"192.168.0.0/16"}, true},
+		{"192.168.1.1:1234", "10.2.3.4, 172.16.0.1", []string{"192.168.0.0/16"}, false},
+		{"192.168.1.1:1234", "127.0.0.1, 172.16.0.1, 192.168.1.2", []string{"192.168.0.0/16"}, false},
+		{"[fd00::1]:1234", "10.2.3.4", []string{"fd00::/8"}, true},
+	}
+	for singleIndex, singleTestCase := range testCase {
+		globalTrustedProxies, err = NewTrustedProxies(singleTestCase.trustedProxies)
+		assert.AssertEqual(t, err, nil, singleIndex)
+		request, _ := http.NewRequest("GET", "/debug", nil)
+		request.RemoteAddr = singleTestCase.remoteAddr
+		if singleTestCase.proxy != "" {
+			request.Header.Set("X-Forwarded-For", singleTestCase.proxy)
+		}
+		assert.AssertEqual(t, debug.IsAllowIp(request), singleTestCase.isAllow, singleIndex)
+	}
+	_, err = NewTrustedProxies([]string{"10.0.0.0/33"})
+	assert.AssertEqual(t, err.Error(), "invalid trusted proxy 10.0.0.0/33")
+}
+
+func TestDebugHandler(t *testing.T) {
+	debug, err := NewDebug(DebugConfig{Path: "/debug", IpWhite: []string{"127.0.0.1"}})
+	assert.AssertEqual(t, err, nil)
+	oldDebug := globalDebug
+	oldRouteTree := handler.routeTree
+	oldTrustedProxies := globalTrustedProxies
+	defer func() {
+		globalDebug = oldDebug
+		handler.routeTree = oldRouteTree
+		globalTrustedProxies = oldTrustedProxies
+	}()
+	globalDebug = debug
+	handler.routeTree = nil
+	handler.addRoute("/debugtest", &debugTestController{}, 0)
+	server := httptest.NewServer(http.HandlerFunc(handler.innerServeHTTP))
+	defer server.Close()
+
+	get := func(url string, proxy string) (int, string) {
+		request, _ := http.NewRequest("GET", server.URL+url, nil)
+		if proxy != "" {
+			request.Header.Set("X-Forwarded-For", proxy)
+		}
+		response, err := http.DefaultClient.Do(request)
+		assert.AssertEqual(t, err, nil)
+		defer response.Body.Close()
+		body, _ := ioutil.ReadAll(response.Body)
+		return response.StatusCode, string(body)
+	}
+
+	//阻塞一个请求，使其出现在最慢的请求中
+	done := make(chan bool)
+	go func() {
+		request, _ := http.NewRequest("GET", server.URL+"/debugtest/wait?a=1", nil)
+		request.Header.Set("X-Request-Id", "debug-1")
+		response, err := http.DefaultClient.Do(request)
+		if err == nil {
+			response.Body.Close()
+		}
+		done <- true
+	}()
+	for i := 0; i != 100 && len(GetSlowRequests(10)) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	status, body := get("/debug/slow?top=5", "")
+	debugTestWait <- true
+	<-done
+	assert.AssertEqual(t, status, 200)
+	var slow []map[string]interface{}
+	assert.AssertEqual(t, json.Unmarshal([]byte(body), &slow), nil)
+	assert.AssertEqual(t, len(slow), 1)
+	assert.AssertEqual(t, slow[0]["method"], "GET")
+	assert.AssertEqual(t, slow[0]["url"], "/debugtest/wait?a=1")
+	assert.AssertEqual(t, slow[0]["requestId"], "debug-1")
+	assert.AssertEqual(t, slow[0]["duration"].(float64) > 0, true)
+
+	status, body = get("/debug/routes", "")
+	assert.AssertEqual(t, status, 200)
+	assert.AssertEqual(t, strings.Contains(body, `"path": "/debugtest/wait"`), true)
+	assert.AssertEqual(t, strings.Contains(body, `"handler": "web.debugTestController.Wait_Json"`), true)
+
+	status, body = get("/debug/goroutine", "")
+	assert.AssertEqual(t, status, 200)
+	assert.AssertEqual(t, strings.Contains(body, "goroutine "), true)
+
+	status, body = get("/debug/pprof/", "")
+	assert.AssertEqual(t, status, 200)
+	assert.AssertEqual(t, strings.Contains(body, "/debug/pprof/heap?debug=1"), true)
+	status, _ = get("/debug/pprof/heap?debug=1", "")
+	assert.AssertEqual(t, status, 200)
+	status, _ = get("/debug/pprof/unknown", "")
+	assert.AssertEqual(t, status, 404)
+
+	status, body = get("/debug/db", "")
+	assert.AssertEqual(t, status, 200)
+	assert.AssertEqual(t, body, "[]")
+
+	status, _ = get("/debug/slow", "192.168.1.1")
+	assert.AssertEqual(t, status, 200)
+	globalTrustedProxies, _ = NewTrustedProxies([]string{"127.0.0.1"})
+	status, _ = get("/debug/slow", "192.168.1.1")
+	assert.AssertEqual(t, status, 403)
+	status, _ = get("/debugtest/notFound", "")
+	assert.AssertEqual(t, status, 404)
+}
@@ -0,0 +1,56 @@
+package web
+
+import (
+	"github.com/milkbobo/fishgoweb/language"
+)
+
+const ErrorIdHeader = "X-Error-Id"
+
+// 框架输出的错误，Id同时写入日志与响应头，用于排查问题
+type AppError struct {
+	Id         string
+	Status     int
+	Message    string
+	StackTrace string
+}
+
+// 错误处理器，用于Crash，404与405的输出
+type AppErrorHandler func(basic *Basic, err AppError)
+
+var errorHandler AppErrorHandler = defaultErrorHandler
+
+// 设置错误处理器，通常与AutoRender使用相同的返回格式
+func SetErrorHandler(handler AppErrorHandler) {
+	if handler == nil {
+		handler = defaultErrorHandler
+	}
+	errorHandler = handler
+}
+
+func defaultErrorHandler(basic *Basic, err AppError) {
+	basic.Ctx.WriteStatus(err.Status)
+	basic.Ctx.Write([]byte(err.Message))
+}
+
+// 堆栈只在dev环境下返回给调用方
+func newAppError(status int, message string, stackTrace string) AppError {
+	result := AppError{
+		Id:      newTraceId(8),
+		Status:  status,
+		Message: message,
+	}
+	if globalBasic.Config.GetRunMode() == "dev" {
+		result.StackTrace = stackTrace
+	}
+	return result
+}
+
+// 错误处理器本身崩溃时，退回到纯文本输出
+func writeAppError(basic *Basic, err AppError) {
+	defer language.CatchCrash(func(exception language.Exception) {
+		basic.Log.Critical("Error Handler Crash ErrorId:[%s] Code:[%d] Message:[%s]\nStackTrace:[%s]", err.Id, exception.GetCode(), exception.GetMessage(), exception.GetStackTrace())
+		defaultErrorHandler(basic, err)
+	})
+	basic.Ctx.WriteHeader(ErrorIdHeader, err.Id)
+	errorHandler(basic, err)
+}
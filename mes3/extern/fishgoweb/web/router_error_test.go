@@ -0,0 +1,119 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/milkbobo/fishgoweb/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type errorTestController struct {
+	Controller
+}
+
+func (this *errorTestController) Crash_Json() interface{} {
+	panic("crash in business")
+}
+
+func (this *errorTestController) Add_Json_Post() interface{} {
+	return nil
+}
+
+func (this *errorTestController) AutoRender(data interface{}, viewName string) {
+	this.Ctx.Write([]byte("ok"))
+}
+
+type errorTestConfigure struct {
+	Configure
+	runMode string
+}
+
+func (this *errorTestConfigure) GetRunMode() string {
+	return this.runMode
+}
+
+func TestErrorHandler(t *testing.T) {
+	oldConfig := globalBasic.Config
+	oldRouteTree := handler.routeTree
+	defer func() {
+		globalBasic.Config = oldConfig
+		handler.routeTree = oldRouteTree
+		SetErrorHandler(nil)
+	}()
+	config := &errorTestConfigure{Configure: oldConfig, runMode: "prod"}
+	globalBasic.Config = config
+	handler.routeTree = nil
+	handler.addRoute("/errortest", &errorTestController{}, 0)
+	server := httptest.NewServer(http.HandlerFunc(handler.innerServeHTTP))
+	defer server.Close()
+
+	get := func(method string, url string) (*http.Response, string) {
+		request, _ := http.NewRequest(method, server.URL+url, nil)
+		response, err := http.DefaultClient.Do(request)
+		assert.AssertEqual(t, err, nil)
+		defer response.Body.Close()
+		body, _ := ioutil.ReadAll(response.Body)
+		return response, string(body)
+	}
+
+	//默认输出纯文本
+	response, body := get("GET", "/errortest/notFound")
+	assert.AssertEqual(t, response.StatusCode, 404)
+	assert.AssertEqual(t, body, "file not found")
+	assert.AssertEqual(t, len(response.Header.Get(ErrorIdHeader)), 16)
+	response, body = get("GET", "/errortest/crash")
+	assert.AssertEqual(t, response.StatusCode, 500)
+	assert.AssertEqual(t, body, "server internal error")
+
+	//自定义的错误处理器
+	SetErrorHandler(func(basic *Basic, err AppError) {
+		data, _ := json.Marshal(map[string]interface{}{
+			"Code":       err.Status,
+			"Msg":        err.Message,
+			"ErrorId":    err.Id,
+			"StackTrace": err.StackTrace,
+		})
+		basic.Ctx.WriteHeader("Content-Type", "application/json; charset=utf-8")
+		basic.Ctx.WriteStatus(err.Status)
+		basic.Ctx.Write(data)
+	})
+	testCase := []struct {
+		method  string
+		url     string
+		runMode string
+		status  int
+		msg     string
+		stack   string
+	}{
+		{"GET", "/errortest/crash", "prod", 500, "server internal error", ""},
+		{"GET", "/errortest/crash", "dev", 500, "server internal error", "crash in business"},
+		{"GET", "/errortest/notFound", "dev", 404, "file not found", ""},
+		{"GET", "/errortest/add", "prod", 405, "method not allowed", ""},
+	}
+	for singleIndex, singleTestCase := range testCase {
+		config.runMode = singleTestCase.runMode
+		response, body := get(singleTestCase.method, singleTestCase.url)
+		var result map[string]interface{}
+		assert.AssertEqual(t, json.Unmarshal([]byte(body), &result), nil, singleIndex)
+		assert.AssertEqual(t, response.StatusCode, singleTestCase.status, singleIndex)
+		assert.AssertEqual(t, response.Header.Get("Content-Type"), "application/json; charset=utf-8", singleIndex)
+		assert.AssertEqual(t, result["Code"], float64(singleTestCase.status), singleIndex)
+		assert.AssertEqual(t, result["Msg"], singleTestCase.msg, singleIndex)
+		assert.AssertEqual(t, result["ErrorId"], response.Header.Get(ErrorIdHeader), singleIndex)
+		assert.AssertEqual(t, strings.HasPrefix(result["StackTrace"].(string), singleTestCase.stack), true, singleIndex)
+		assert.AssertEqual(t, singleTestCase.stack == "" || strings.Contains(result["StackTrace"].(string), "router_error_test.go"), true, singleIndex)
+	}
+	response, _ = get("GET", "/errortest/add")
+	assert.AssertEqual(t, response.Header.Get("Allow"), "OPTIONS, POST")
+
+	//错误处理器崩溃时退回纯文本
+	SetErrorHandler(func(basic *Basic, err AppError) {
+		panic("crash in handler")
+	})
+	response, body = get("GET", "/errortest/notFound")
+	assert.AssertEqual(t, response.StatusCode, 404)
+	assert.AssertEqual(t, body, "file not found")
+}
@@ -0,0 +1,218 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+type HealthCheck func(ctx context.Context) error
+
+type HealthConfig struct {
+	Healthz string
+	Readyz  string
+	Timeout time.Duration
+}
+
+type Health interface {
+	http.Handler
+	IsMatch(path string) bool
+}
+
+type healthImplement struct {
+	config HealthConfig
+}
+
+type healthCheckItem struct {
+	name  string
+	check HealthCheck
+}
+
+type healthCheckResult struct {
+	Name     string  `json:"name"`
+	Status   string  `json:"status"`
+	Duration float64 `json:"duration"`
+	Error    string  `json:"error,omitempty"`
+}
+
+type healthResult struct {
+	Status   string              `json:"status"`
+	Shutdown bool                `json:"shutdown,omitempty"`
+	Checks   []healthCheckResult `json:"checks"`
+}
+
+var (
+	healthChecks     []healthCheckItem
+	healthChecksLock sync.Mutex
+)
+
+// 注册自定义的检查项，与内置的组件检查一起在/readyz中执行
+func AddHealthCheck(name string, check HealthCheck) {
+	healthChecksLock.Lock()
+	defer healthChecksLock.Unlock()
+	healthChecks = append(healthChecks, healthCheckItem{name: name, check: check})
+}
+
+// 默认路径为/healthz与/readyz，/healthz只表示进程存活，/readyz检查依赖的组件，每个检查项默认超时3秒
+func NewHealth(config HealthConfig) (Health, error) {
+	if config.Healthz == "" {
+		config.Healthz = "/healthz"
+	}
+	if config.Readyz == "" {
+		config.Readyz = "/readyz"
+	}
+	if config.Healthz == config.Readyz {
+		return nil, errors.New("health healthz and readyz can not be the same " + config.Healthz)
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 3 * time.Second
+	}
+	return &healthImplement{
+		config: config,
+	}, nil
+}
+
+func NewHealthFromConfig() (Health, error) {
+	healthConfig := HealthConfig{}
+	healthConfig.Healthz = globalBasic.Config.Get().Health.Healthz
+	healthConfig.Readyz = globalBasic.Config.Get().Health.Readyz
+	healthConfig.Timeout = time.Duration(globalBasic.Config.Get().Health.Timeout) * time.Second
+	return NewHealth(healthConfig)
+}
+
+func getHealthHandler(request *http.Request) http.Handler {
+	if globalHealth == nil || globalHealth.IsMatch(request.URL.Path) == false {
+		return nil
+	}
+	return globalHealth
+}
+
+func (this *healthImplement) IsMatch(path string) bool {
+	return path == this.config.Healthz || path == this.config.Readyz
+}
+
+// 检查Basic中已配置的组件，每次执行时读取，保证与当前的组件一致
+func (this *healthImplement) getChecks() []healthCheckItem {
+	result := []healthCheckItem{}
+	for name, db := range globalBasic.getDatabases() {
+		result = append(result, healthCheckItem{name: name, check: db.Ping})
+	}
+	for name, db := range globalBasic.getMongoDatabases() {
+		client := db.Client()
+		result = append(result, healthCheckItem{name: name, check: func(ctx context.Context) error {
+			return client.Ping(ctx, readpref.Primary())
+		}})
+	}
+	//数据库按名称排序，保证输出稳定
+	sort.Slice(result, func(i int, j int) bool {
+		return result[i].name < result[j].name
+	})
+	if queue, ok := globalBasic.Queue.(*queueImplement); ok {
+		result = append(result, healthCheckItem{name: "queue", check: func(ctx context.Context) error {
+			return queue.ping()
+		}})
+	}
+	if cache, ok := globalBasic.Cache.(*cacheImplement); ok {
+		result = append(result, healthCheckItem{name: "cache", check: func(ctx context.Context) error {
+			return cache.ping()
+		}})
+	}
+	if session, ok := globalBasic.Session.(*sessionImplement); ok {
+		result = append(result, healthCheckItem{name: "session", check: func(ctx context.Context) error {
+			return session.ping()
+		}})
+	}
+	healthChecksLock.Lock()
+	result = append(result, healthChecks...)
+	healthChecksLock.Unlock()
+	return result
+}
+
+// 检查项可能不响应context，超时后直接返回，不再等待检查项结束
+func (this *healthImplement) runCheck(item healthCheckItem) healthCheckResult {
+	beginTime := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), this.config.Timeout)
+	defer cancel()
+
+	errorEvent := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errorEvent <- errors.New("health check crash")
+			}
+		}()
+		errorEvent <- item.check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-errorEvent:
+	case <-ctx.Done():
+		err = errors.New("timeout after " + this.config.Timeout.String())
+	}
+	result := healthCheckResult{
+		Name:     item.name,
+		Status:   "up",
+		Duration: float64(time.Since(beginTime)) / float64(time.Millisecond),
+	}
+	if err != nil {
+		result.Status = "down"
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func (this *healthImplement) runChecks() healthResult {
+	checks := this.getChecks()
+	result := healthResult{
+		Status: "up",
+		Checks: make([]healthCheckResult, len(checks)),
+	}
+	var wg sync.WaitGroup
+	for i, single := range checks {
+		wg.Add(1)
+		go func(i int, single healthCheckItem) {
+			defer wg.Done()
+			result.Checks[i] = this.runCheck(single)
+		}(i, single)
+	}
+	wg.Wait()
+	for _, single := range result.Checks {
+		if single.Status != "up" {
+			result.Status = "down"
+		}
+	}
+	return result
+}
+
+// healthz不检查依赖，避免数据库等故障时存活探针重启所有实例
+// 优雅关闭开始后，readyz直接返回未就绪，让负载均衡先摘除流量
+func (this *healthImplement) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	var result healthResult
+	if request.URL.Path == this.config.Healthz {
+		result = healthResult{
+			Status: "up",
+			Checks: []healthCheckResult{},
+		}
+	} else if globalBasic.Grace != nil && globalBasic.Grace.IsShutdown() {
+		result = healthResult{
+			Status:   "down",
+			Shutdown: true,
+			Checks:   []healthCheckResult{},
+		}
+	} else {
+		result = this.runChecks()
+	}
+	data, _ := json.Marshal(result)
+	response.Header().Set("Content-Type", "application/json; charset=utf-8")
+	response.Header().Set("Cache-Control", "no-store")
+	if result.Status != "up" {
+		response.WriteHeader(http.StatusServiceUnavailable)
+	}
+	response.Write(data)
+}
@@ -0,0 +1,103 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/milkbobo/fishgoweb/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type healthTestGrace struct {
+	Grace
+	isShutdown bool
+}
+
+func (this *healthTestGrace) IsShutdown() bool {
+	return this.isShutdown
+}
+
+func TestHealth(t *testing.T) {
+	_, err := NewHealth(HealthConfig{Healthz: "/check", Readyz: "/check"})
+	assert.AssertEqual(t, err.Error(), "health healthz and readyz can not be the same /check")
+
+	health, err := NewHealth(HealthConfig{Timeout: 50 * time.Millisecond})
+	assert.AssertEqual(t, err, nil)
+	oldHealth := globalHealth
+	oldHealthChecks := healthChecks
+	oldGrace := globalBasic.Grace
+	defer func() {
+		globalHealth = oldHealth
+		healthChecks = oldHealthChecks
+		globalBasic.Grace = oldGrace
+	}()
+	globalHealth = health
+	healthChecks = nil
+	grace := &healthTestGrace{}
+	globalBasic.Grace = grace
+	server := httptest.NewServer(http.HandlerFunc(handler.innerServeHTTP))
+	defer server.Close()
+
+	get := func(url string) (int, healthResult) {
+		response, err := http.Get(server.URL + url)
+		assert.AssertEqual(t, err, nil)
+		defer response.Body.Close()
+		body, _ := ioutil.ReadAll(response.Body)
+		var result healthResult
+		assert.AssertEqual(t, json.Unmarshal(body, &result), nil)
+		return response.StatusCode, result
+	}
+	getStatus := func(result healthResult) map[string]string {
+		status := map[string]string{}
+		for _, single := range result.Checks {
+			status[single.Name] = single.Status + single.Error
+		}
+		return status
+	}
+
+	AddHealthCheck("custom", func(ctx context.Context) error {
+		return nil
+	})
+	status, result := get("/readyz")
+	assert.AssertEqual(t, status, 200)
+	assert.AssertEqual(t, result.Status, "up")
+	assert.AssertEqual(t, getStatus(result)["custom"], "up")
+	assert.AssertEqual(t, getStatus(result)["cache"], "up")
+
+	AddHealthCheck("fail", func(ctx context.Context) error {
+		return errors.New("connection refused")
+	})
+	AddHealthCheck("slow", func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	beginTime := time.Now()
+	status, result = get("/readyz")
+	assert.AssertEqual(t, time.Since(beginTime) < 500*time.Millisecond, true)
+	assert.AssertEqual(t, status, 503)
+	assert.AssertEqual(t, result.Status, "down")
+	assert.AssertEqual(t, result.Shutdown, false)
+	assert.AssertEqual(t, getStatus(result)["custom"], "up")
+	assert.AssertEqual(t, getStatus(result)["fail"], "downconnection refused")
+	assert.AssertEqual(t, getStatus(result)["slow"], "downtimeout after 50ms")
+
+	//healthz只表示进程存活，不执行检查项
+	status, result = get("/healthz")
+	assert.AssertEqual(t, status, 200)
+	assert.AssertEqual(t, result.Status, "up")
+	assert.AssertEqual(t, len(result.Checks), 0)
+
+	healthChecks = nil
+	grace.isShutdown = true
+	status, result = get("/readyz")
+	assert.AssertEqual(t, status, 503)
+	assert.AssertEqual(t, result.Shutdown, true)
+	assert.AssertEqual(t, len(result.Checks), 0)
+	status, result = get("/healthz")
+	assert.AssertEqual(t, status, 200)
+	assert.AssertEqual(t, result.Status, "up")
+}
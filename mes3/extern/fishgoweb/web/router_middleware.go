@@ -0,0 +1,130 @@
+package web
+
+import (
+	"reflect"
+	"strings"
+)
+
+type AppRouterMethodInfo struct {
+	Pattern        string
+	ViewName       string
+	HttpMethods    []string
+	ControllerType reflect.Type
+	MethodName     string
+}
+
+// 路由中间件，在路由解析与Basic注入之后执行
+// 调用next继续执行后续中间件与业务方法，不调用next时不再执行AutoRender
+// 中间件中Throw的异常与业务方法的异常一样交由AutoRender输出
+type AppRouterRouteMiddleware func(basic *Basic, method AppRouterMethodInfo, next func())
+
+type routeMiddlewareNamespace struct {
+	segments   []string
+	middleware AppRouterRouteMiddleware
+}
+
+type routeMiddlewareMethod struct {
+	controllerType reflect.Type
+	methodName     string
+	middleware     AppRouterRouteMiddleware
+}
+
+var (
+	routeMiddlewares          []AppRouterRouteMiddleware
+	routeNamespaceMiddlewares []routeMiddlewareNamespace
+	routeMethodMiddlewares    []routeMiddlewareMethod
+)
+
+func (this *methodInfo) toAppRouterMethodInfo(pattern string) AppRouterMethodInfo {
+	return AppRouterMethodInfo{
+		Pattern:        pattern,
+		ViewName:       this.viewName,
+		HttpMethods:    this.httpMethods,
+		ControllerType: this.controllerType,
+		MethodName:     this.methodType.Name,
+	}
+}
+
+// 参数段只比较位置，不比较参数名
+func isRoutePatternPrefix(segments []string, prefix []string) bool {
+	if len(prefix) > len(segments) {
+		return false
+	}
+	for i, single := range prefix {
+		segment := segments[i]
+		if strings.HasPrefix(single, "{") && strings.HasPrefix(segment, "{") {
+			if strings.HasSuffix(single, "...}") != strings.HasSuffix(segment, "...}") {
+				return false
+			}
+		} else if segment != single {
+			return false
+		}
+	}
+	return true
+}
+
+func getRouteMiddlewares(method AppRouterMethodInfo) []AppRouterRouteMiddleware {
+	result := []AppRouterRouteMiddleware{}
+	result = append(result, routeMiddlewares...)
+	segments := getRoutePatternSegments(method.Pattern)
+	for _, single := range routeNamespaceMiddlewares {
+		if isRoutePatternPrefix(segments, single.segments) {
+			result = append(result, single.middleware)
+		}
+	}
+	for _, single := range routeMethodMiddlewares {
+		if single.controllerType == method.ControllerType &&
+			single.methodName == method.MethodName {
+			result = append(result, single.middleware)
+		}
+	}
+	return result
+}
+
+func runRouteMiddlewares(middlewares []AppRouterRouteMiddleware, basic *Basic, method AppRouterMethodInfo, handler func()) bool {
+	isFinish := false
+	var next func(index int)
+	next = func(index int) {
+		if index == len(middlewares) {
+			isFinish = true
+			handler()
+			return
+		}
+		middlewares[index](basic, method, func() {
+			next(index + 1)
+		})
+	}
+	next(0)
+	return isFinish
+}
+
+// http层中间件，在路由解析之前执行，需要在Run之前添加
+func AddMiddleware(middleware AppRouterMiddlware) {
+	middlewares = append(middlewares, middleware)
+}
+
+// 全局的路由中间件
+func AddRouteMiddleware(middleware AppRouterRouteMiddleware) {
+	routeMiddlewares = append(routeMiddlewares, middleware)
+}
+
+// namespace下所有路由的中间件，namespace与InitRoute的写法一致，如/admin
+func AddNamespaceMiddleware(namespace string, middleware AppRouterRouteMiddleware) {
+	routeNamespaceMiddlewares = append(routeNamespaceMiddlewares, routeMiddlewareNamespace{
+		segments:   getRoutePatternSegments(namespace),
+		middleware: middleware,
+	})
+}
+
+// 单个控制器方法的中间件，如AddMethodMiddleware(&IndexController{}, "Test_Json", middleware)
+func AddMethodMiddleware(target ControllerInterface, methodName string, middleware AppRouterRouteMiddleware) {
+	controllerType := reflect.TypeOf(target)
+	if _, isExist := controllerType.MethodByName(methodName); isExist == false {
+		panic("invalid controller method " + controllerType.String() + "." + methodName)
+	}
+	routeMethodMiddlewares = append(routeMethodMiddlewares, routeMiddlewareMethod{
+		controllerType: controllerType.Elem(),
+		methodName:     methodName,
+		middleware:     middleware,
+	})
+}
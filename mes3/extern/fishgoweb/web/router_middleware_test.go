@@ -0,0 +1,77 @@
+package web
+
+import (
+	"github.com/milkbobo/fishgoweb/assert"
+	"reflect"
+	"testing"
+)
+
+type routeMiddlewareTestController struct {
+	Controller
+}
+
+func (this *routeMiddlewareTestController) Test_Json() interface{} {
+	return nil
+}
+
+func (this *routeMiddlewareTestController) AutoRender(data interface{}, viewName string) {
+}
+
+func TestRouteMiddleware(t *testing.T) {
+	oldRouteMiddlewares := routeMiddlewares
+	oldRouteNamespaceMiddlewares := routeNamespaceMiddlewares
+	oldRouteMethodMiddlewares := routeMethodMiddlewares
+	defer func() {
+		routeMiddlewares = oldRouteMiddlewares
+		routeNamespaceMiddlewares = oldRouteNamespaceMiddlewares
+		routeMethodMiddlewares = oldRouteMethodMiddlewares
+	}()
+
+	trace := []string{}
+	newMiddleware := func(name string, isNext bool) AppRouterRouteMiddleware {
+		return func(basic *Basic, method AppRouterMethodInfo, next func()) {
+			trace = append(trace, name)
+			if isNext {
+				next()
+			}
+		}
+	}
+	AddRouteMiddleware(newMiddleware("global", true))
+	AddNamespaceMiddleware("/admin", newMiddleware("admin", true))
+	AddNamespaceMiddleware("/admin/{id}", newMiddleware("adminId", true))
+	AddMethodMiddleware(&routeMiddlewareTestController{}, "Test_Json", newMiddleware("method", true))
+
+	testCase := []struct {
+		pattern    string
+		methodName string
+		trace      []string
+	}{
+		{"/index/test", "Test_Json", []string{"global", "method", "handler"}},
+		{"/admin/test", "Other_Json", []string{"global", "admin", "handler"}},
+		{"/admin/{userId}/test", "Test_Json", []string{"global", "admin", "adminId", "method", "handler"}},
+		{"/administrator", "Other_Json", []string{"global", "handler"}},
+	}
+	for singleIndex, singleTestCase := range testCase {
+		trace = []string{}
+		method := AppRouterMethodInfo{
+			Pattern:        singleTestCase.pattern,
+			ControllerType: reflect.TypeOf(routeMiddlewareTestController{}),
+			MethodName:     singleTestCase.methodName,
+		}
+		isFinish := runRouteMiddlewares(getRouteMiddlewares(method), nil, method, func() {
+			trace = append(trace, "handler")
+		})
+		assert.AssertEqual(t, isFinish, true, singleIndex)
+		assert.AssertEqual(t, trace, singleTestCase.trace, singleIndex)
+	}
+
+	trace = []string{}
+	isFinish := runRouteMiddlewares([]AppRouterRouteMiddleware{
+		newMiddleware("auth", false),
+		newMiddleware("global", true),
+	}, nil, AppRouterMethodInfo{}, func() {
+		trace = append(trace, "handler")
+	})
+	assert.AssertEqual(t, isFinish, false)
+	assert.AssertEqual(t, trace, []string{"auth"})
+}
@@ -0,0 +1,70 @@
+package web
+
+import (
+	"reflect"
+	"time"
+)
+
+type routeTimeoutNamespace struct {
+	segments []string
+	timeout  time.Duration
+}
+
+type routeTimeoutMethod struct {
+	controllerType reflect.Type
+	methodName     string
+	timeout        time.Duration
+}
+
+var (
+	routeNamespaceTimeouts []routeTimeoutNamespace
+	routeMethodTimeouts    []routeTimeoutMethod
+)
+
+// namespace下所有路由的超时时间，namespace与InitRoute的写法一致，多个namespace匹配时最长的优先
+// 超时后请求的context被取消，通过Basic执行的数据库查询，缓存与队列操作随之中断
+func AddNamespaceTimeout(namespace string, timeout time.Duration) {
+	routeNamespaceTimeouts = append(routeNamespaceTimeouts, routeTimeoutNamespace{
+		segments: getRoutePatternSegments(namespace),
+		timeout:  timeout,
+	})
+}
+
+// 单个控制器方法的超时时间，优先于namespace与全局的超时时间，timeout为0时表示不限制
+func AddMethodTimeout(target ControllerInterface, methodName string, timeout time.Duration) {
+	controllerType := reflect.TypeOf(target)
+	if _, isExist := controllerType.MethodByName(methodName); isExist == false {
+		panic("invalid controller method " + controllerType.String() + "." + methodName)
+	}
+	routeMethodTimeouts = append(routeMethodTimeouts, routeTimeoutMethod{
+		controllerType: controllerType.Elem(),
+		methodName:     methodName,
+		timeout:        timeout,
+	})
+}
+
+// 全局的超时时间读取app.toml中的timeout(秒)，websocket与sse这类长连接不使用全局的超时时间
+func getRouteTimeout(method AppRouterMethodInfo, isLongConnection bool) time.Duration {
+	for _, single := range routeMethodTimeouts {
+		if single.controllerType == method.ControllerType &&
+			single.methodName == method.MethodName {
+			return single.timeout
+		}
+	}
+	segments := getRoutePatternSegments(method.Pattern)
+	var result time.Duration
+	matchLength := -1
+	for _, single := range routeNamespaceTimeouts {
+		if len(single.segments) > matchLength && isRoutePatternPrefix(segments, single.segments) {
+			result = single.timeout
+			matchLength = len(single.segments)
+		}
+	}
+	if matchLength != -1 {
+		return result
+	}
+	if isLongConnection || globalBasic.Config == nil {
+		return 0
+	}
+	return time.Duration(globalBasic.Config.Get().Timeout) * time.Second
+}
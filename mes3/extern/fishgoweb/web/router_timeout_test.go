@@ -0,0 +1,97 @@
+package web
+
+import (
+	"context"
+	"github.com/milkbobo/fishgoweb/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type routeTimeoutTestController struct {
+	Controller
+}
+
+func (this *routeTimeoutTestController) Slow_Json() interface{} {
+	this.Cache.Set("routeTimeoutTest", "1", time.Minute)
+	<-this.Ctx.GetContext().Done()
+	//取消后读视为未命中，写入仍然执行
+	this.Cache.Set("routeTimeoutTestAfter", "1", time.Minute)
+	_, isExist := this.Cache.Get("routeTimeoutTest")
+	return []interface{}{this.Ctx.GetContext().Err(), isExist}
+}
+
+func (this *routeTimeoutTestController) Fast_Json() interface{} {
+	return nil
+}
+
+func (this *routeTimeoutTestController) AutoRender(data interface{}, viewName string) {
+	result, ok := data.([]interface{})
+	if ok && result[0] == context.DeadlineExceeded && result[1] == false {
+		this.Ctx.Write([]byte("cancel"))
+	}
+}
+
+func TestRouteTimeout(t *testing.T) {
+	oldRouteNamespaceTimeouts := routeNamespaceTimeouts
+	oldRouteMethodTimeouts := routeMethodTimeouts
+	defer func() {
+		routeNamespaceTimeouts = oldRouteNamespaceTimeouts
+		routeMethodTimeouts = oldRouteMethodTimeouts
+	}()
+
+	AddNamespaceTimeout("/admin", 2*time.Second)
+	AddNamespaceTimeout("/admin/{id}", 3*time.Second)
+	AddMethodTimeout(&routeTimeoutTestController{}, "Slow_Json", 50*time.Millisecond)
+	AddMethodTimeout(&routeTimeoutTestController{}, "Fast_Json", 0)
+
+	testCase := []struct {
+		pattern          string
+		methodName       string
+		isLongConnection bool
+		timeout          time.Duration
+	}{
+		{"/admin/test", "Other_Json", false, 2 * time.Second},
+		{"/admin/{userId}/test", "Other_Json", false, 3 * time.Second},
+		{"/admin/{userId}/test", "Other_Sse", true, 3 * time.Second},
+		{"/admin/{userId}/test", "Slow_Json", false, 50 * time.Millisecond},
+		{"/admin/{userId}/test", "Fast_Json", false, 0},
+		{"/index/test", "Other_Websocket", true, 0},
+	}
+	for singleIndex, singleTestCase := range testCase {
+		method := AppRouterMethodInfo{
+			Pattern:        singleTestCase.pattern,
+			ControllerType: reflect.TypeOf(routeTimeoutTestController{}),
+			MethodName:     singleTestCase.methodName,
+		}
+		assert.AssertEqual(t, getRouteTimeout(method, singleTestCase.isLongConnection), singleTestCase.timeout, singleIndex)
+	}
+
+	//超时后取消请求的context
+	oldRouteTree := handler.routeTree
+	oldCache := globalBasic.Cache
+	defer func() {
+		handler.routeTree = oldRouteTree
+		globalBasic.Cache = oldCache
+	}()
+	cache, err := NewCache(CacheConfig{Driver: "memory", GcInterval: 60})
+	assert.AssertEqual(t, err, nil)
+	globalBasic.Cache = cache
+	handler.routeTree = nil
+	handler.addRoute("/timeout", &routeTimeoutTestController{}, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		handler.handleRequest(request, response)
+	}))
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/timeout/slow")
+	assert.AssertEqual(t, err, nil)
+	body, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	assert.AssertEqual(t, string(body), "cancel")
+	_, isExist := cache.Get("routeTimeoutTestAfter")
+	assert.AssertEqual(t, isExist, true)
+}
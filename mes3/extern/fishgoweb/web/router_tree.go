@@ -0,0 +1,259 @@
+package web
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/milkbobo/fishgoweb/container"
+)
+
+type routeInfo struct {
+	pattern    string
+	priority   int
+	paramNames []string
+	methods    map[string]methodInfo
+}
+
+type routeTreeNode struct {
+	children map[string]*routeTreeNode
+	param    *routeTreeNode
+	wildcard *routeTreeNode
+	route    *routeInfo
+}
+
+type routeTree struct {
+	static  *container.TrieTree
+	pattern *routeTreeNode
+	routes  []*routeInfo
+}
+
+type routeTreeMatch struct {
+	route  *routeInfo
+	values []string
+}
+
+func newRouteTree() *routeTree {
+	return &routeTree{
+		static:  container.NewTrieTree(),
+		pattern: newRouteTreeNode(),
+	}
+}
+
+func newRouteTreeNode() *routeTreeNode {
+	return &routeTreeNode{
+		children: map[string]*routeTreeNode{},
+	}
+}
+
+func splitRoutePath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return []string{}
+	}
+	return strings.Split(path, "/")
+}
+
+// 解析路径段，返回段类型与参数名
+// {name}与:name为命名参数，*name与{name...}为通配参数，只能出现在末尾
+func parseRouteSegment(segment string) (string, string) {
+	if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		name := segment[1 : len(segment)-1]
+		if strings.HasSuffix(name, "...") {
+			return "wildcard", strings.TrimSuffix(name, "...")
+		}
+		return "param", name
+	} else if strings.HasPrefix(segment, ":") {
+		return "param", segment[1:]
+	} else if strings.HasPrefix(segment, "*") {
+		name := segment[1:]
+		if name == "" {
+			name = "*"
+		}
+		return "wildcard", name
+	}
+	return "static", strings.ToLower(segment)
+}
+
+func isRoutePattern(path string) bool {
+	for _, segment := range splitRoutePath(path) {
+		segmentType, _ := parseRouteSegment(segment)
+		if segmentType != "static" {
+			return true
+		}
+	}
+	return false
+}
+
+// 统一路由的写法，静态段转为小写，参数写为{name}，通配参数写为{name...}
+func getRoutePatternSegments(path string) []string {
+	result := []string{}
+	for _, segment := range splitRoutePath(path) {
+		segmentType, name := parseRouteSegment(segment)
+		if segmentType == "static" {
+			result = append(result, name)
+		} else if segmentType == "param" {
+			result = append(result, "{"+name+"}")
+		} else {
+			result = append(result, "{"+name+"...}")
+		}
+	}
+	return result
+}
+
+func (this *routeTree) Add(path string, priority int, httpMethods []string, method methodInfo) error {
+	segments := splitRoutePath(path)
+	patternSegments := getRoutePatternSegments(path)
+	paramNames := []string{}
+	for i, segment := range segments {
+		segmentType, name := parseRouteSegment(segment)
+		if segmentType == "static" {
+			continue
+		}
+		if segmentType == "wildcard" && i != len(segments)-1 {
+			return errors.New("wildcard must be the last segment: " + path)
+		}
+		paramNames = append(paramNames, name)
+	}
+	pattern := "/" + strings.Join(patternSegments, "/")
+
+	//找到路由所在节点
+	var route *routeInfo
+	var setRoute func(*routeInfo)
+	if len(paramNames) == 0 {
+		key := strings.Join(patternSegments, "/")
+		if single := this.static.Get(key); single != nil {
+			route = single.(*routeInfo)
+		}
+		setRoute = func(newRoute *routeInfo) {
+			this.static.Set(key, newRoute)
+		}
+	} else {
+		current := this.pattern
+		for _, segment := range segments {
+			segmentType, name := parseRouteSegment(segment)
+			if segmentType == "static" {
+				next, isExist := current.children[name]
+				if isExist == false {
+					next = newRouteTreeNode()
+					current.children[name] = next
+				}
+				current = next
+			} else if segmentType == "param" {
+				if current.param == nil {
+					current.param = newRouteTreeNode()
+				}
+				current = current.param
+			} else {
+				if current.wildcard == nil {
+					current.wildcard = newRouteTreeNode()
+				}
+				current = current.wildcard
+			}
+		}
+		route = current.route
+		setRoute = func(newRoute *routeInfo) {
+			current.route = newRoute
+		}
+	}
+
+	//合并同一路径下不同Method的路由
+	if route == nil {
+		route = &routeInfo{
+			pattern:    pattern,
+			priority:   priority,
+			paramNames: paramNames,
+			methods:    map[string]methodInfo{},
+		}
+		setRoute(route)
+		this.routes = append(this.routes, route)
+	} else if route.pattern != pattern {
+		return errors.New("route " + pattern + " conflict with " + route.pattern)
+	} else if route.priority < priority {
+		route.priority = priority
+	}
+	for _, httpMethod := range httpMethods {
+		route.methods[httpMethod] = method
+	}
+	return nil
+}
+
+func (this *routeTree) Routes() []*routeInfo {
+	return this.routes
+}
+
+func (this *routeTree) Find(path string) (*routeInfo, map[string]string) {
+	segments := splitRoutePath(path)
+
+	//静态路由
+	var staticRoute *routeInfo
+	staticResult := this.static.Get(strings.ToLower(strings.Join(segments, "/")))
+	if staticResult != nil {
+		staticRoute = staticResult.(*routeInfo)
+	}
+
+	//模式路由，优先级相同时，静态段优先于参数，参数优先于通配
+	var best routeTreeMatch
+	values := make([]string, 0, len(segments))
+	this.findNode(this.pattern, segments, values, &best)
+	if best.route == nil ||
+		(staticRoute != nil && staticRoute.priority >= best.route.priority) {
+		if staticRoute == nil {
+			return nil, nil
+		}
+		return staticRoute, map[string]string{}
+	}
+
+	params := map[string]string{}
+	for i, name := range best.route.paramNames {
+		params[name] = best.values[i]
+	}
+	return best.route, params
+}
+
+func (this *routeTree) findNode(node *routeTreeNode, segments []string, values []string, best *routeTreeMatch) {
+	if len(segments) == 0 {
+		if node.route != nil &&
+			(best.route == nil || node.route.priority > best.route.priority) {
+			best.route = node.route
+			best.values = append([]string{}, values...)
+		}
+		return
+	}
+	segment := segments[0]
+	if next, isExist := node.children[strings.ToLower(segment)]; isExist {
+		this.findNode(next, segments[1:], values, best)
+	}
+	if node.param != nil {
+		this.findNode(node.param, segments[1:], append(values, segment), best)
+	}
+	if node.wildcard != nil {
+		this.findNode(node.wildcard, nil, append(values, strings.Join(segments, "/")), best)
+	}
+}
+
+// 获取HTTP Method对应的方法，HEAD没有单独绑定时使用GET的方法
+func (this *routeInfo) getMethod(httpMethod string) (methodInfo, bool) {
+	method, isExist := this.methods[httpMethod]
+	if isExist == false && httpMethod == "HEAD" {
+		method, isExist = this.methods["GET"]
+	}
+	return method, isExist
+}
+
+func (this *routeInfo) getAllowMethods() []string {
+	result := []string{}
+	for httpMethod := range this.methods {
+		result = append(result, httpMethod)
+	}
+	if _, isExist := this.methods["GET"]; isExist {
+		if _, isExist := this.methods["HEAD"]; isExist == false {
+			result = append(result, "HEAD")
+		}
+	}
+	if _, isExist := this.methods["OPTIONS"]; isExist == false {
+		result = append(result, "OPTIONS")
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,156 @@
+package web
+
+import (
+	"github.com/milkbobo/fishgoweb/assert"
+	"testing"
+)
+
+func TestRouteTree(t *testing.T) {
+	tree := newRouteTree()
+	addRoute := func(path string, priority int, viewName string) {
+		err := tree.Add(path, priority, routeDefaultHttpMethods, methodInfo{viewName: viewName})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	addRoute("index/test", 0, "static")
+	addRoute("config/{id}", 0, "config")
+	addRoute("config/{id}/get", 0, "configGet")
+	addRoute("order/:orderId/items", 0, "orderItems")
+	addRoute("order/new/items", 0, "orderNewItems")
+	addRoute("file/*path", 0, "file")
+	addRoute("file/{name}", 0, "fileName")
+	addRoute("user/{userId}", 0, "user")
+	addRoute("user/*rest", 10, "userRest")
+	addRoute("", 0, "root")
+
+	testCase := []struct {
+		url      string
+		viewName string
+		params   map[string]string
+	}{
+		{"/index/test", "static", map[string]string{}},
+		{"/Index/Test/", "static", map[string]string{}},
+		{"/", "root", map[string]string{}},
+		{"/config/12", "config", map[string]string{"id": "12"}},
+		{"/CONFIG/AbC/get", "configGet", map[string]string{"id": "AbC"}},
+		{"/order/34/items", "orderItems", map[string]string{"orderId": "34"}},
+		{"/order/new/items", "orderNewItems", map[string]string{}},
+		{"/file/a.txt", "fileName", map[string]string{"name": "a.txt"}},
+		{"/file/a/b/c.txt", "file", map[string]string{"path": "a/b/c.txt"}},
+		{"/user/1", "userRest", map[string]string{"rest": "1"}},
+		{"/config", "", nil},
+		{"/config/1/del", "", nil},
+		{"/unknown", "", nil},
+	}
+	for singleIndex, singleTestCase := range testCase {
+		route, params := tree.Find(singleTestCase.url)
+		viewName := ""
+		if route != nil {
+			viewName = route.methods["GET"].viewName
+		}
+		assert.AssertEqual(t, viewName, singleTestCase.viewName, singleIndex)
+		assert.AssertEqual(t, params, singleTestCase.params, singleIndex)
+	}
+
+	err := tree.Add("file/*path/name", 0, routeDefaultHttpMethods, methodInfo{})
+	assert.AssertEqual(t, err != nil, true)
+}
+
+func TestRouteTreeHttpMethod(t *testing.T) {
+	tree := newRouteTree()
+	tree.Add("config/{id}", 0, []string{"GET"}, methodInfo{viewName: "get"})
+	tree.Add("config/:id", 0, []string{"POST", "PUT"}, methodInfo{viewName: "save"})
+	tree.Add("order/{orderId}", 0, []string{"POST"}, methodInfo{viewName: "order"})
+	err := tree.Add("config/{configId}", 0, []string{"DELETE"}, methodInfo{viewName: "del"})
+	assert.AssertEqual(t, err != nil, true)
+
+	route, _ := tree.Find("/config/1")
+	testCase := []struct {
+		httpMethod string
+		viewName   string
+		isExist    bool
+	}{
+		{"GET", "get", true},
+		{"HEAD", "get", true},
+		{"POST", "save", true},
+		{"PUT", "save", true},
+		{"PATCH", "", false},
+		{"DELETE", "", false},
+	}
+	for singleIndex, singleTestCase := range testCase {
+		method, isExist := route.getMethod(singleTestCase.httpMethod)
+		assert.AssertEqual(t, isExist, singleTestCase.isExist, singleIndex)
+		assert.AssertEqual(t, method.viewName, singleTestCase.viewName, singleIndex)
+	}
+	assert.AssertEqual(t, route.getAllowMethods(), []string{"GET", "HEAD", "OPTIONS", "POST", "PUT"})
+
+	route, _ = tree.Find("/order/1")
+	_, isExist := route.getMethod("HEAD")
+	assert.AssertEqual(t, isExist, false)
+	assert.AssertEqual(t, route.getAllowMethods(), []string{"OPTIONS", "POST"})
+}
+
+type routeMethodTestController struct {
+	Controller
+}
+
+func (this *routeMethodTestController) Save_Json_Pots() interface{} {
+	return nil
+}
+
+func (this *routeMethodTestController) AutoRender(data interface{}, viewName string) {
+}
+
+type routeIndexTestController struct {
+	Controller
+}
+
+func (this *routeIndexTestController) Index_Json() interface{} {
+	return nil
+}
+
+func (this *routeIndexTestController) AutoRender(data interface{}, viewName string) {
+}
+
+func TestRouteHttpMethodSuffix(t *testing.T) {
+	testCase := []struct {
+		suffix      []string
+		httpMethods []string
+		isExplicit  bool
+	}{
+		{[]string{}, routeDefaultHttpMethods, false},
+		{[]string{"Post"}, []string{"POST"}, true},
+		{[]string{"Get", "Put"}, []string{"GET", "PUT"}, true},
+	}
+	for singleIndex, singleTestCase := range testCase {
+		httpMethods, isExplicit := handler.parseHttpMethods(nil, "Save_Json", singleTestCase.suffix)
+		assert.AssertEqual(t, httpMethods, singleTestCase.httpMethods, singleIndex)
+		assert.AssertEqual(t, isExplicit, singleTestCase.isExplicit, singleIndex)
+	}
+
+	//拼写错误的后缀直接panic，而不是响应所有请求
+	oldRouteTree := handler.routeTree
+	defer func() {
+		handler.routeTree = oldRouteTree
+	}()
+	handler.routeTree = nil
+	assert.AssertError(t, "invalid http method Pots in web.routeMethodTestController.Save_Json_Pots", func() {
+		handler.addRoute("/method", &routeMethodTestController{}, 0)
+	})
+}
+
+func TestRouteIndex(t *testing.T) {
+	oldRouteTree := handler.routeTree
+	defer func() {
+		handler.routeTree = oldRouteTree
+	}()
+	handler.routeTree = nil
+	handler.addRoute("/home", &routeIndexTestController{}, 0)
+
+	//Index方法只响应自身的路径，不响应namespace本身
+	route, _ := handler.routeTree.Find("/home/index")
+	assert.AssertEqual(t, route != nil, true)
+	route, _ = handler.routeTree.Find("/home")
+	assert.AssertEqual(t, route == nil, true)
+}
@@ -0,0 +1,217 @@
+package web
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type AccessLogItem struct {
+	Time      time.Time
+	RemoteIp  string
+	Method    string
+	Url       string
+	Proto     string
+	Status    int
+	Bytes     int64
+	Latency   time.Duration
+	Referer   string
+	UserAgent string
+	Route     string
+	RequestId string
+}
+
+type AccessLog interface {
+	Write(item AccessLogItem)
+	Close()
+}
+
+type AccessLogConfig struct {
+	Format string
+	File   string
+}
+
+type accessLogImplement struct {
+	format string
+	writer io.Writer
+	file   *os.File
+	lock   sync.Mutex
+}
+
+// format为combined或者json，没有配置file时输出到标准输出
+func NewAccessLog(config AccessLogConfig) (AccessLog, error) {
+	if config.Format == "" {
+		config.Format = "combined"
+	}
+	if config.Format != "combined" && config.Format != "json" {
+		return nil, errors.New("invalid accesslog format " + config.Format)
+	}
+	result := &accessLogImplement{
+		format: config.Format,
+		writer: os.Stdout,
+	}
+	if config.File != "" {
+		file, err := os.OpenFile(config.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0660)
+		if err != nil {
+			return nil, err
+		}
+		result.file = file
+		result.writer = file
+	}
+	return result, nil
+}
+
+// 只有app.toml中的accesslogs为true时才输出访问日志
+func NewAccessLogFromConfig() (AccessLog, error) {
+	if globalBasic.Config.Get().Accesslogs == false {
+		return nil, nil
+	}
+	accessLogConfig := AccessLogConfig{}
+	accessLogConfig.Format = globalBasic.Config.Get().AccessLog.Format
+	accessLogConfig.File = globalBasic.Config.Get().AccessLog.File
+	return NewAccessLog(accessLogConfig)
+}
+
+func (this *accessLogImplement) getAccessLogValue(data string) string {
+	if data == "" {
+		return "-"
+	}
+	return strings.Replace(data, `"`, `\"`, -1)
+}
+
+// 在combined格式后追加耗时(秒)，路由与请求Id
+func (this *accessLogImplement) getCombined(item AccessLogItem) string {
+	return fmt.Sprintf(
+		"%s - - [%s] \"%s %s %s\" %d %d \"%s\" \"%s\" %.3f \"%s\" %s\n",
+		item.RemoteIp,
+		item.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		item.Method,
+		this.getAccessLogValue(item.Url),
+		item.Proto,
+		item.Status,
+		item.Bytes,
+		this.getAccessLogValue(item.Referer),
+		this.getAccessLogValue(item.UserAgent),
+		item.Latency.Seconds(),
+		this.getAccessLogValue(item.Route),
+		this.getAccessLogValue(item.RequestId),
+	)
+}
+
+func (this *accessLogImplement) getJson(item AccessLogItem) string {
+	result, _ := json.Marshal(map[string]interface{}{
+		"time":      item.Time.Format(time.RFC3339Nano),
+		"remoteIp":  item.RemoteIp,
+		"method":    item.Method,
+		"url":       item.Url,
+		"proto":     item.Proto,
+		"status":    item.Status,
+		"bytes":     item.Bytes,
+		"latency":   float64(item.Latency) / float64(time.Millisecond),
+		"referer":   item.Referer,
+		"userAgent": item.UserAgent,
+		"route":     item.Route,
+		"requestId": item.RequestId,
+	})
+	return string(result) + "\n"
+}
+
+func (this *accessLogImplement) Write(item AccessLogItem) {
+	var data string
+	if this.format == "json" {
+		data = this.getJson(item)
+	} else {
+		data = this.getCombined(item)
+	}
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	io.WriteString(this.writer, data)
+}
+
+func (this *accessLogImplement) Close() {
+	if this.file != nil {
+		this.file.Close()
+	}
+}
+
+// 记录响应的状态码与字节数，供访问日志与监控使用，保留Flush与Hijack以支持sse与websocket
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+	route  string
+}
+
+func (this *statusResponseWriter) WriteHeader(status int) {
+	if this.status == 0 {
+		this.status = status
+	}
+	this.ResponseWriter.WriteHeader(status)
+}
+
+func (this *statusResponseWriter) Write(data []byte) (int, error) {
+	if this.status == 0 {
+		this.status = http.StatusOK
+	}
+	n, err := this.ResponseWriter.Write(data)
+	this.bytes += int64(n)
+	return n, err
+}
+
+// 没有输出任何内容时，net/http默认返回200
+func (this *statusResponseWriter) getStatus() int {
+	if this.status == 0 {
+		return http.StatusOK
+	}
+	return this.status
+}
+
+func (this *statusResponseWriter) Flush() {
+	if flusher, ok := this.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (this *statusResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := this.ResponseWriter.(http.Hijacker)
+	if ok == false {
+		return nil, nil, errors.New("response writer does not support hijack")
+	}
+	this.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// 路由解析后记录路由的pattern
+func setResponseRoute(response http.ResponseWriter, route string) {
+	if writer, ok := response.(*statusResponseWriter); ok {
+		writer.route = route
+	}
+}
+
+func newAccessLogItem(request *http.Request, response *statusResponseWriter, beginTime time.Time) AccessLogItem {
+	//不需要解析请求参数，直接使用request创建
+	ctx := &contextImplement{request: request}
+	_, trace := withContextTrace(request)
+	return AccessLogItem{
+		Time:      beginTime,
+		RemoteIp:  strings.TrimSpace(ctx.GetRemoteIP()),
+		Method:    request.Method,
+		Url:       request.URL.RequestURI(),
+		Proto:     request.Proto,
+		Status:    response.getStatus(),
+		Bytes:     response.bytes,
+		Latency:   time.Since(beginTime),
+		Referer:   request.Referer(),
+		UserAgent: request.UserAgent(),
+		Route:     response.route,
+		RequestId: trace.requestId,
+	}
+}
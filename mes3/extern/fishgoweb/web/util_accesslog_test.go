@@ -0,0 +1,98 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/milkbobo/fishgoweb/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+type accessLogTestController struct {
+	Controller
+}
+
+func (this *accessLogTestController) Get_Json() interface{} {
+	return "hello"
+}
+
+func (this *accessLogTestController) AutoRender(data interface{}, viewName string) {
+	this.Ctx.WriteStatus(201)
+	this.Ctx.Write([]byte(data.(string)))
+}
+
+func TestAccessLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "accesslog")
+	assert.AssertEqual(t, err, nil)
+	defer os.RemoveAll(dir)
+	filename := path.Join(dir, "access.log")
+
+	oldAccessLog := globalAccessLog
+	oldRouteTree := handler.routeTree
+	defer func() {
+		globalAccessLog = oldAccessLog
+		handler.routeTree = oldRouteTree
+	}()
+	globalAccessLog, err = NewAccessLog(AccessLogConfig{Format: "json", File: filename})
+	assert.AssertEqual(t, err, nil)
+	handler.routeTree = nil
+	handler.addRoute("/accesslog/{id}", &accessLogTestController{}, 0)
+	server := httptest.NewServer(http.HandlerFunc(handler.innerServeHTTP))
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", server.URL+"/accesslog/1/get?a=1", nil)
+	request.Header.Set("X-Forwarded-For", "10.0.0.1, 10.0.0.2")
+	request.Header.Set("X-Request-Id", "access-1")
+	request.Header.Set("User-Agent", "fish-test")
+	response, err := http.DefaultClient.Do(request)
+	assert.AssertEqual(t, err, nil)
+	response.Body.Close()
+	assert.AssertEqual(t, response.Header.Get("X-Request-Id"), "access-1")
+	response, err = http.Get(server.URL + "/accesslog/notFound")
+	assert.AssertEqual(t, err, nil)
+	response.Body.Close()
+	globalAccessLog.Close()
+
+	data, err := ioutil.ReadFile(filename)
+	assert.AssertEqual(t, err, nil)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.AssertEqual(t, len(lines), 2)
+	var first map[string]interface{}
+	assert.AssertEqual(t, json.Unmarshal([]byte(lines[0]), &first), nil)
+	assert.AssertEqual(t, first["remoteIp"], "10.0.0.1")
+	assert.AssertEqual(t, first["method"], "GET")
+	assert.AssertEqual(t, first["url"], "/accesslog/1/get?a=1")
+	assert.AssertEqual(t, first["status"], float64(201))
+	assert.AssertEqual(t, first["bytes"], float64(5))
+	assert.AssertEqual(t, first["userAgent"], "fish-test")
+	assert.AssertEqual(t, first["route"], "/accesslog/{id}/get")
+	assert.AssertEqual(t, first["requestId"], "access-1")
+	var second map[string]interface{}
+	assert.AssertEqual(t, json.Unmarshal([]byte(lines[1]), &second), nil)
+	assert.AssertEqual(t, second["status"], float64(404))
+	assert.AssertEqual(t, second["route"], "")
+	assert.AssertEqual(t, len(second["requestId"].(string)), 32)
+}
+
+func TestAccessLogCombined(t *testing.T) {
+	accessLog := &accessLogImplement{format: "combined"}
+	data := accessLog.getCombined(AccessLogItem{
+		Time:      time.Date(2020, 1, 2, 3, 4, 5, 0, time.FixedZone("", 8*3600)),
+		RemoteIp:  "10.0.0.1",
+		Method:    "POST",
+		Url:       "/user/add",
+		Proto:     "HTTP/1.1",
+		Status:    200,
+		Bytes:     12,
+		Latency:   1500 * time.Millisecond,
+		UserAgent: `curl "7"`,
+		Route:     "/user/add",
+		RequestId: "abc",
+	})
+	assert.AssertEqual(t, data, "10.0.0.1 - - [02/Jan/2020:03:04:05 +0800] \"POST /user/add HTTP/1.1\" 200 12 \"-\" \"curl \\\"7\\\"\" 1.500 \"/user/add\" abc\n")
+}
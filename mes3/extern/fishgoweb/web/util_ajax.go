@@ -0,0 +1,65 @@
+package web
+
+import (
+	"context"
+
+	"github.com/milkbobo/fishgoweb/util"
+)
+
+type AjaxClient interface {
+	WithContext(ctx context.Context) AjaxClient
+	Do(option *util.Ajax) error
+	Get(option *util.Ajax) error
+	Post(option *util.Ajax) error
+	Del(option *util.Ajax) error
+	Put(option *util.Ajax) error
+}
+
+type ajaxClientImplement struct {
+	pool *util.AjaxPool
+	ctx  context.Context
+}
+
+// 绑定请求的context后，外部调用随请求取消，并自动转发X-Request-Id与traceparent
+func NewAjaxClient(pool *util.AjaxPool) (AjaxClient, error) {
+	if pool == nil {
+		pool = util.DefaultAjaxPool
+	}
+	return &ajaxClientImplement{
+		pool: pool,
+	}, nil
+}
+
+func (this *ajaxClientImplement) WithContext(ctx context.Context) AjaxClient {
+	result := *this
+	result.ctx = ctx
+	return &result
+}
+
+// 调用方已经设置Context时以调用方为准
+func (this *ajaxClientImplement) withContext(option *util.Ajax) *util.Ajax {
+	if option.Context == nil {
+		option.Context = this.ctx
+	}
+	return option
+}
+
+func (this *ajaxClientImplement) Do(option *util.Ajax) error {
+	return this.pool.Do(this.withContext(option))
+}
+
+func (this *ajaxClientImplement) Get(option *util.Ajax) error {
+	return this.pool.Get(this.withContext(option))
+}
+
+func (this *ajaxClientImplement) Post(option *util.Ajax) error {
+	return this.pool.Post(this.withContext(option))
+}
+
+func (this *ajaxClientImplement) Del(option *util.Ajax) error {
+	return this.pool.Del(this.withContext(option))
+}
+
+func (this *ajaxClientImplement) Put(option *util.Ajax) error {
+	return this.pool.Put(this.withContext(option))
+}
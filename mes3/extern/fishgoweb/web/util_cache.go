@@ -1,17 +1,20 @@
 package web
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"github.com/beego/beego/cache"
 	_ "github.com/beego/beego/cache/redis"
 	. "github.com/milkbobo/fishgoweb/language"
+	"github.com/milkbobo/fishgoweb/web/util_queue"
 	"strings"
 	"time"
 )
 
 type Cache interface {
 	WithLog(log Log) Cache
+	WithContext(ctx context.Context) Cache
 	Get(key string) (string, bool)
 	Set(key string, value string, timeout time.Duration)
 	Del(key string)
@@ -27,7 +30,10 @@ type CacheConfig struct {
 type cacheImplement struct {
 	store      cache.Cache
 	saveprefix string
+	driver     string
+	savePath   string
 	log        Log
+	ctx        context.Context
 }
 
 func NewCache(config CacheConfig) (Cache, error) {
@@ -49,6 +55,7 @@ func NewCache(config CacheConfig) (Cache, error) {
 		return &cacheImplement{
 			store:      cacheInner,
 			saveprefix: config.SavePrefix,
+			driver:     config.Driver,
 		}, nil
 	} else if config.Driver == "redis" {
 		var data struct {
@@ -79,6 +86,8 @@ func NewCache(config CacheConfig) (Cache, error) {
 		return &cacheImplement{
 			store:      cacheInner,
 			saveprefix: config.SavePrefix,
+			driver:     config.Driver,
+			savePath:   config.SavePath,
 		}, nil
 	} else {
 		return nil, errors.New("invalid cache config " + config.Driver)
@@ -104,7 +113,25 @@ func (this *cacheImplement) WithLog(log Log) Cache {
 	}
 }
 
+// 绑定context后，context取消时Get视为未命中，Set与Del仍然执行，避免请求已经提交的数据没有写入缓存
+func (this *cacheImplement) WithContext(ctx context.Context) Cache {
+	if this == nil {
+		return nil
+	} else {
+		newCache := *this
+		newCache.ctx = ctx
+		return &newCache
+	}
+}
+
+func (this *cacheImplement) isCancel() bool {
+	return this.ctx != nil && this.ctx.Err() != nil
+}
+
 func (this *cacheImplement) Get(key string) (string, bool) {
+	if this.isCancel() {
+		return "", false
+	}
 	result := this.store.Get(this.saveprefix + key)
 	if result == nil {
 		return "", false
@@ -131,3 +158,11 @@ func (this *cacheImplement) Del(key string) {
 		panic(err)
 	}
 }
+
+// memory驱动不需要检查连通性
+func (this *cacheImplement) ping() error {
+	if this.driver != "redis" {
+		return nil
+	}
+	return util_queue.PingRedis(this.savePath)
+}
@@ -0,0 +1,60 @@
+package web
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	. "github.com/milkbobo/fishgoweb/language"
+)
+
+// 可信的反向代理，只有直连的对端在其中时才使用X-Forwarded-For
+var globalTrustedProxies []*net.IPNet
+
+func NewTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	result := []*net.IPNet{}
+	for _, single := range proxies {
+		if strings.TrimSpace(single) == "" {
+			continue
+		}
+		ipNet, err := parseSecurityIpNet(single)
+		if err != nil {
+			return nil, errors.New("invalid trusted proxy " + single)
+		}
+		result = append(result, ipNet)
+	}
+	return result, nil
+}
+
+func NewTrustedProxiesFromConfig() ([]*net.IPNet, error) {
+	return NewTrustedProxies(Explode(globalBasic.Config.Get().TrustedProxies, ","))
+}
+
+func getRemoteAddrIp(remoteAddr string) net.IP {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	return net.ParseIP(strings.TrimSpace(host))
+}
+
+// 从直连的对端开始，沿X-Forwarded-For从右往左跳过可信代理，第一个不可信的地址即为客户端ip
+func getRequestClientIp(request *http.Request, trustedProxies []*net.IPNet) net.IP {
+	ip := getRemoteAddrIp(request.RemoteAddr)
+	if ip == nil || isSecurityIpIn(trustedProxies, ip) == false {
+		return ip
+	}
+	forwards := strings.Split(strings.Join(request.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwards) - 1; i >= 0; i-- {
+		single := net.ParseIP(strings.TrimSpace(forwards[i]))
+		if single == nil {
+			break
+		}
+		ip = single
+		if isSecurityIpIn(trustedProxies, ip) == false {
+			break
+		}
+	}
+	return ip
+}
@@ -11,15 +11,32 @@ import (
 )
 
 type AppConfigBase struct {
-	Appname    string `toml:"appname"`
-	HttpPort   int    `toml:"httpport"`
-	RunMode    string `toml:"runmode"`
-	Accesslogs bool   `toml:"accesslogs"`
+	Appname     string `toml:"appname"`
+	HttpPort    int    `toml:"httpport"`
+	RunMode     string `toml:"runmode"`
+	Accesslogs  bool   `toml:"accesslogs"`
+	MaxBodySize int64  `toml:"maxbodysize"`
+	Timeout     int    `toml:"timeout"`
 }
 
 type AppConfigInfo struct {
 	SecurityIpWhite string `toml:"securityipwhite"`
-	Log             struct {
+	TrustedProxies  string `toml:"trustedproxies"`
+	Security        struct {
+		Ip []struct {
+			Namespace string `toml:"namespace"`
+			Allow     string `toml:"allow"`
+			Deny      string `toml:"deny"`
+		} `toml:"ip"`
+		Csrf               bool   `toml:"csrf"`
+		CsrfExclude        string `toml:"csrfexclude"`
+		Hsts               string `toml:"hsts"`
+		FrameOptions       string `toml:"frameoptions"`
+		Csp                string `toml:"csp"`
+		ContentTypeOptions string `toml:"contenttypeoptions"`
+		ReferrerPolicy     string `toml:"referrerpolicy"`
+	} `toml:"security"`
+	Log struct {
 		Driver          string `toml:"driver"`
 		File            string `toml:"file"`
 		Maxline         int    `toml:"maxline"`
@@ -39,6 +56,7 @@ type AppConfigInfo struct {
 		Driver string `toml:"driver"`
 		Stop   string `toml:"stop"`
 		Start  string `toml:"start"`
+		Drain  int    `toml:"drain"`
 	} `toml:"grace"`
 	Session struct {
 		Driver          string `toml:"driver"`
@@ -51,24 +69,28 @@ type AppConfigInfo struct {
 		Domain          string `toml:"domain"`
 		SessionIdLength int    `toml:"sessionIdLength"`
 	} `toml:"session"`
-	Mdb     AppConfigInfoMongoDB `toml:"mdb"`
-	Mdb2    AppConfigInfoMongoDB `toml:"mdb2"`
-	Mdb3    AppConfigInfoMongoDB `toml:"mdb3"`
-	Mdb4    AppConfigInfoMongoDB `toml:"mdb4"`
-	Mdb5    AppConfigInfoMongoDB `toml:"mdb5"`
-	Esdb    AppConfigInfoEsDB    `toml:"Esdb"`
-	Esdb2   AppConfigInfoEsDB    `toml:"Esdb2"`
-	Esdb3   AppConfigInfoEsDB    `toml:"Esdb3"`
-	DB      AppConfigInfoDB      `toml:"db"`
-	DB2     AppConfigInfoDB      `toml:"db2"`
-	DB3     AppConfigInfoDB      `toml:"db3"`
-	DB4     AppConfigInfoDB      `toml:"db4"`
-	DB5     AppConfigInfoDB      `toml:"db5"`
+	Mdb     AppConfigInfoMongoDB            `toml:"mdb"`
+	Mdb2    AppConfigInfoMongoDB            `toml:"mdb2"`
+	Mdb3    AppConfigInfoMongoDB            `toml:"mdb3"`
+	Mdb4    AppConfigInfoMongoDB            `toml:"mdb4"`
+	Mdb5    AppConfigInfoMongoDB            `toml:"mdb5"`
+	Esdb    AppConfigInfoEsDB               `toml:"Esdb"`
+	Esdb2   AppConfigInfoEsDB               `toml:"Esdb2"`
+	Esdb3   AppConfigInfoEsDB               `toml:"Esdb3"`
+	DB      AppConfigInfoDB                 `toml:"db"`
+	DB2     AppConfigInfoDB                 `toml:"db2"`
+	DB3     AppConfigInfoDB                 `toml:"db3"`
+	DB4     AppConfigInfoDB                 `toml:"db4"`
+	DB5     AppConfigInfoDB                 `toml:"db5"`
+	DBs     map[string]AppConfigInfoDB      `toml:"-"`
+	MDBs    map[string]AppConfigInfoMongoDB `toml:"-"`
 	Monitor struct {
 		Driver        string `toml:"driver"`
 		AppId         string `toml:"appId"`
 		ErrorCount    string `toml:"errorCount"`
 		CriticalCount string `toml:"criticalCount"`
+		Path          string `toml:"path"`
+		IpWhite       string `toml:"ipwhite"`
 	} `toml:"monitor"`
 	Queue struct {
 		Driver     string `toml:"driver"`
@@ -83,6 +105,55 @@ type AppConfigInfo struct {
 		SavePath   string `toml:"savePath"`
 		GcInterval int    `toml:"gcInterval"`
 	} `toml:"cache"`
+	Websocket struct {
+		ReadBufferSize  int    `toml:"readbuffersize"`
+		WriteBufferSize int    `toml:"writebuffersize"`
+		SendBufferSize  int    `toml:"sendbuffersize"`
+		MaxMessageSize  int64  `toml:"maxmessagesize"`
+		PingInterval    int    `toml:"pinginterval"`
+		PongWait        int    `toml:"pongwait"`
+		WriteWait       int    `toml:"writewait"`
+		Topic           string `toml:"topic"`
+	} `toml:"websocket"`
+	Cors struct {
+		AllowOrigins     string `toml:"allowOrigins"`
+		AllowMethods     string `toml:"allowMethods"`
+		AllowHeaders     string `toml:"allowHeaders"`
+		ExposeHeaders    string `toml:"exposeHeaders"`
+		MaxAge           int    `toml:"maxAge"`
+		AllowCredentials bool   `toml:"allowCredentials"`
+	} `toml:"cors"`
+	Sse struct {
+		Heartbeat int `toml:"heartbeat"`
+		Retry     int `toml:"retry"`
+	} `toml:"sse"`
+	AccessLog struct {
+		Format string `toml:"format"`
+		File   string `toml:"file"`
+	} `toml:"accesslog"`
+	Debug struct {
+		Path    string `toml:"path"`
+		IpWhite string `toml:"ipwhite"`
+	} `toml:"debug"`
+	Health struct {
+		Healthz string `toml:"healthz"`
+		Readyz  string `toml:"readyz"`
+		Timeout int    `toml:"timeout"`
+	} `toml:"health"`
+	RateLimit struct {
+		Driver     string `toml:"driver"`
+		Algorithm  string `toml:"algorithm"`
+		Limit      int    `toml:"limit"`
+		Window     int    `toml:"window"`
+		Key        string `toml:"key"`
+		SessionKey string `toml:"sessionkey"`
+		SavePath   string `toml:"savepath"`
+		SavePrefix string `toml:"saveprefix"`
+	} `toml:"ratelimit"`
+	Migrate struct {
+		Path  string `toml:"path"`
+		Check bool   `toml:"check"`
+	} `toml:"migrate"`
 }
 
 type AppConfigInfoMongoDB struct {
@@ -112,6 +183,10 @@ type AppConfigInfoDB struct {
 	Debug             bool   `toml:"debug"`
 	MaxConnection     int    `toml:"maxConnection"`
 	MaxIdleConnection int    `toml:"maxIdleConnection"`
+	Replicas          string `toml:"replicas"`
+	Balance           string `toml:"balance"`
+	Sticky            int    `toml:"sticky"`
+	ReplicaCheck      int    `toml:"replicaCheck"`
 }
 
 type CheckAppConfig struct {
@@ -121,6 +196,18 @@ type CheckAppConfig struct {
 	Test AppConfigInfo `toml:"test"`
 }
 
+// 具名的数据库连接，如[dev.db.orders]与[dev.mdb.analytics]
+type checkAppConfigNamedInfo struct {
+	DB  map[string]toml.Primitive `toml:"db"`
+	Mdb map[string]toml.Primitive `toml:"mdb"`
+}
+
+type checkAppConfigNamed struct {
+	Prod checkAppConfigNamedInfo `toml:"prod"`
+	Dev  checkAppConfigNamedInfo `toml:"dev"`
+	Test checkAppConfigNamedInfo `toml:"test"`
+}
+
 type AppConfig struct {
 	AppConfigBase
 	AppConfigInfo
@@ -128,6 +215,7 @@ type AppConfig struct {
 
 type Configure interface {
 	Get() AppConfig
+	GetRunMode() string
 }
 
 type configureImplement struct {
@@ -211,12 +299,65 @@ func NewConfig(file string) (Configure, error) {
 		panic("runMode不能为空")
 	}
 
+	ConfigData.DBs, ConfigData.MDBs, err = getAppConfigNamedDatabase(appConfigPath, runMode)
+	if err != nil {
+		return nil, err
+	}
+
 	return &configureImplement{
 		runMode:  runMode,
 		configer: ConfigData,
 	}, nil
 }
 
+// db与mdb下的子表为具名连接，其余的键为默认连接自身的配置
+func getAppConfigNamedDatabase(appConfigPath string, runMode string) (map[string]AppConfigInfoDB, map[string]AppConfigInfoMongoDB, error) {
+	checkAppConfigData := checkAppConfigNamed{}
+	meta, err := toml.DecodeFile(appConfigPath, &checkAppConfigData)
+	if err != nil {
+		return nil, nil, err
+	}
+	var namedInfo checkAppConfigNamedInfo
+	if runMode == "prod" {
+		namedInfo = checkAppConfigData.Prod
+	} else if runMode == "dev" {
+		namedInfo = checkAppConfigData.Dev
+	} else if runMode == "test" {
+		namedInfo = checkAppConfigData.Test
+	}
+
+	dbs := map[string]AppConfigInfoDB{}
+	for name, primitive := range namedInfo.DB {
+		if meta.Type(runMode, "db", name) != "Hash" {
+			continue
+		}
+		single := AppConfigInfoDB{}
+		err := meta.PrimitiveDecode(primitive, &single)
+		if err != nil {
+			return nil, nil, errors.New("invalid db." + name + " config " + err.Error())
+		}
+		dbs[name] = single
+	}
+	mdbs := map[string]AppConfigInfoMongoDB{}
+	for name, primitive := range namedInfo.Mdb {
+		if meta.Type(runMode, "mdb", name) != "Hash" {
+			continue
+		}
+		single := AppConfigInfoMongoDB{}
+		err := meta.PrimitiveDecode(primitive, &single)
+		if err != nil {
+			return nil, nil, errors.New("invalid mdb." + name + " config " + err.Error())
+		}
+		mdbs[name] = single
+	}
+	return dbs, mdbs, nil
+}
+
+// 实际使用的运行环境，依次取自命令行，环境变量与配置文件，测试时为test
+func (this *configureImplement) GetRunMode() string {
+	return this.runMode
+}
+
 func (this *configureImplement) Get() AppConfig {
 	return this.configer
 }
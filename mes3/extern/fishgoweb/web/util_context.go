@@ -2,9 +2,14 @@ package web
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"mime"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -43,12 +48,19 @@ type Context interface {
 	GetRemoteAddr() string
 	GetRemoteIP() string
 	GetRemotePort() int
+	GetClientIP() string
 	GetUserAgent() string
 	SetUserAgent(data string)
 	GetHeader(key string) string
+	GetRequestId() string
+	GetTraceId() string
+	GetTraceParent() string
 	IsUpload() bool
 	IsLocal() bool
 
+	//生命周期
+	GetContext() context.Context
+
 	//输出数据
 	Write(data []byte)
 	WriteHeader(key string, value string)
@@ -70,9 +82,17 @@ type contextImplement struct {
 	responseWriter   http.ResponseWriter
 	testing          *testing.T
 	inputData        map[string]interface{}
+	inputError       error
+	trace            contextTrace
 	serializeRequest *ContextSerializeRequest
 }
 
+// 默认请求体的大小限制，可以通过app.toml中的maxbodysize修改
+const contextDefaultMaxBodySize = 10 << 20
+
+// 请求体不合法或超过大小限制时的错误码
+const InputErrorCode = 400
+
 func NewContext(request interface{}, response interface{}, t interface{}) Context {
 	if t == nil {
 		t = (*testing.T)(nil)
@@ -82,41 +102,96 @@ func NewContext(request interface{}, response interface{}, t interface{}) Contex
 		responseWriter: response.(http.ResponseWriter),
 		testing:        t.(*testing.T),
 	}
+	result.request, result.trace = withContextTrace(result.request)
 	result.parseInput()
 	return &result
 }
 
+func (this *contextImplement) getMaxBodySize() int64 {
+	if globalBasic.Config != nil && globalBasic.Config.Get().MaxBodySize > 0 {
+		return globalBasic.Config.Get().MaxBodySize
+	}
+	return contextDefaultMaxBodySize
+}
+
+func (this *contextImplement) readBody() ([]byte, error) {
+	maxBodySize := this.getMaxBodySize()
+	byteArray, err := ioutil.ReadAll(io.LimitReader(this.request.Body, maxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	this.request.Body = ioutil.NopCloser(bytes.NewReader(byteArray))
+	if int64(len(byteArray)) > maxBodySize {
+		return nil, fmt.Errorf("请求体不能超过%d字节", maxBodySize)
+	}
+	return byteArray, nil
+}
+
+// 参数的优先级为：路由参数 > json或form请求体 > url参数
 func (this *contextImplement) parseInput() {
 	//取出get数据
 	request := this.request
 	queryInput := request.URL.RawQuery
+	this.inputData = map[string]interface{}{}
+	this.inputError = nil
 
 	//取出post数据
 	postInput := ""
+	var jsonInput map[string]interface{}
 	ct := request.Header.Get("Content-Type")
 	if ct == "" {
 		ct = "application/octet-stream"
 	}
 	ct, _, err := mime.ParseMediaType(ct)
-	if ct == "application/x-www-form-urlencoded" &&
+	if (ct == "application/x-www-form-urlencoded" || ct == "application/json") &&
 		this.request.Body != nil {
-		byteArray, err := ioutil.ReadAll(this.request.Body)
+		byteArray, err := this.readBody()
 		if err != nil {
-			panic(err)
+			this.inputError = err
+			return
+		}
+		if ct == "application/json" {
+			jsonInput, err = this.parseJsonInput(byteArray)
+			if err != nil {
+				this.inputError = err
+				return
+			}
+		} else {
+			postInput = string(byteArray)
 		}
-		this.request.Body = ioutil.NopCloser(bytes.NewReader(byteArray))
-		postInput = string(byteArray)
 	}
 
 	//解析数据
 	input := queryInput + "&" + postInput
-	this.inputData = map[string]interface{}{}
 	err = encoding.DecodeUrlQuery([]byte(input), &this.inputData)
 	if err != nil {
-		language.Throw(1, err.Error())
+		this.inputError = err
+		return
+	}
+	for key, value := range jsonInput {
+		this.inputData[key] = value
 	}
 }
 
+func (this *contextImplement) parseJsonInput(data []byte) (map[string]interface{}, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+	//数字保留为json.Number，避免大整数丢失精度
+	var result interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err := decoder.Decode(&result)
+	if err != nil {
+		return nil, errors.New("请求体不是合法的json: " + err.Error())
+	}
+	resultMap, ok := result.(map[string]interface{})
+	if ok == false {
+		return nil, errors.New("json请求体必须为对象")
+	}
+	return resultMap, nil
+}
+
 func (this *contextImplement) GetUrl() *url.URL {
 	return this.request.URL
 }
@@ -143,11 +218,18 @@ func (this *contextImplement) SetParam(key string, data string) {
 }
 
 func (this *contextImplement) GetParamToStruct(requireStruct interface{}) {
+	if this.inputError != nil {
+		language.Throw(InputErrorCode, this.inputError.Error())
+	}
+
 	//导出到struct
 	err := language.MapToArray(this.inputData, requireStruct, "url")
 	if err != nil {
 		language.Throw(1, err.Error())
 	}
+
+	//按照validate标签校验
+	checkValidateInput(requireStruct, this.inputData, "url")
 }
 
 func (this *contextImplement) GetUrlParamToStruct(requireStruct interface{}) {
@@ -247,26 +329,36 @@ func (this *contextImplement) GetRemoteAddr() string {
 
 func (this *contextImplement) GetRemoteIP() string {
 	addr := this.GetRemoteAddr()
-	ip := strings.Split(addr, ":")
-	if len(ip) > 0 {
-		if ip[0] != "" {
-			return ip[0]
-		}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if host != "" {
+		return host
 	}
 	return "127.0.0.1"
 }
 
 func (this *contextImplement) GetRemotePort() int {
 	addr := this.GetRemoteAddr()
-	ip := strings.Split(addr, ":")
-	if len(ip) > 1 {
-		port, err := strconv.Atoi(ip[1])
-		if err != nil {
-			return 80
-		}
-		return port
+	_, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return 80
 	}
-	return 80
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return 80
+	}
+	return port
+}
+
+// 与GetRemoteIP不同，只有直连的对端在trustedproxies中时才使用X-Forwarded-For，用于访问控制与限流
+func (this *contextImplement) GetClientIP() string {
+	ip := getRequestClientIp(this.request, globalTrustedProxies)
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
 }
 
 func (this *contextImplement) GetUserAgent() string {
@@ -281,6 +373,20 @@ func (this *contextImplement) GetHeader(key string) string {
 	return this.request.Header.Get(key)
 }
 
+// 请求头X-Request-Id中的请求Id，没有时使用traceId
+func (this *contextImplement) GetRequestId() string {
+	return this.trace.requestId
+}
+
+func (this *contextImplement) GetTraceId() string {
+	return this.trace.traceId
+}
+
+// 当前请求作为父节点的traceparent，用于调用下游服务
+func (this *contextImplement) GetTraceParent() string {
+	return this.trace.getTraceParent()
+}
+
 func (this *contextImplement) IsUpload() bool {
 	return strings.Contains(this.request.Header.Get("Content-Type"), "multipart/form-data")
 }
@@ -338,6 +444,11 @@ func (this *contextImplement) WriteMimeHeader(mime string, title string) {
 	}
 }
 
+// 请求的context，客户端断开或者超过路由的超时时间后被取消
+func (this *contextImplement) GetContext() context.Context {
+	return this.request.Context()
+}
+
 func (this *contextImplement) GetRawRequest() interface{} {
 	return this.request
 }
@@ -361,7 +472,13 @@ func (this *contextImplement) SerializeRequest() (ContextSerializeRequest, error
 	result := &ContextSerializeRequest{}
 	result.Method = request.Method
 	result.Url = request.URL.String()
-	result.Header = request.Header
+	result.Header = request.Header.Clone()
+	if result.Header == nil {
+		result.Header = http.Header{}
+	}
+	for key, value := range this.trace.getHeader() {
+		result.Header[key] = value
+	}
 	this.serializeRequest = result
 	return *result, nil
 }
@@ -373,8 +490,8 @@ func (this *contextImplement) DeSerializeRequest(data ContextSerializeRequest) e
 		return err
 	}
 	newRequest.Header = data.Header
-	this.request = newRequest
-	this.serializeRequest = &data
+	this.request, this.trace = withContextTrace(newRequest)
+	this.serializeRequest = nil
 	this.parseInput()
 	return nil
 }
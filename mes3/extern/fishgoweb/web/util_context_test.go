@@ -0,0 +1,184 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/milkbobo/fishgoweb/assert"
+	"github.com/milkbobo/fishgoweb/language"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type contextTestItem struct {
+	ItemId int
+	Name   string
+}
+
+type contextTestData struct {
+	UserId int64
+	Name   string
+	Price  float64
+	Enable bool
+	Items  []contextTestItem
+	Page   int
+}
+
+func newContextTestRequest(url string, contentType string, body string) Context {
+	request, err := http.NewRequest("POST", url, bytes.NewReader([]byte(body)))
+	if err != nil {
+		panic(err)
+	}
+	request.Header.Set("Content-Type", contentType)
+	return NewContext(request, &memoryResponseWriter{}, nil)
+}
+
+func TestContextJsonBody(t *testing.T) {
+	ctx := newContextTestRequest(
+		"/test?name=query&page=2",
+		"application/json; charset=utf-8",
+		`{"userId":9007199254740993,"name":"body","price":1.5,"enable":true,"items":[{"itemId":1,"name":"a"},{"itemId":2}]}`,
+	)
+	data := contextTestData{}
+	ctx.GetParamToStruct(&data)
+	assert.AssertEqual(t, data, contextTestData{
+		UserId: 9007199254740993,
+		Name:   "body",
+		Price:  1.5,
+		Enable: true,
+		Items:  []contextTestItem{{1, "a"}, {2, ""}},
+		Page:   2,
+	})
+	assert.AssertEqual(t, ctx.GetParam("name"), "body")
+	assert.AssertEqual(t, ctx.GetParam("userId"), "9007199254740993")
+	body, err := ctx.GetBody()
+	assert.AssertEqual(t, err, nil)
+	assert.AssertEqual(t, strings.HasPrefix(string(body), `{"userId"`), true)
+
+	//路由参数优先
+	ctx.SetParam("name", "route")
+	data = contextTestData{}
+	ctx.GetParamToStruct(&data)
+	assert.AssertEqual(t, data.Name, "route")
+
+	//空请求体
+	ctx = newContextTestRequest("/test?name=query", "application/json", "")
+	data = contextTestData{}
+	ctx.GetParamToStruct(&data)
+	assert.AssertEqual(t, data.Name, "query")
+
+	//form请求体同样覆盖url参数
+	ctx = newContextTestRequest("/test?name=query&page=2", "application/x-www-form-urlencoded", "name=form")
+	data = contextTestData{}
+	ctx.GetParamToStruct(&data)
+	assert.AssertEqual(t, data.Name, "form")
+	assert.AssertEqual(t, data.Page, 2)
+}
+
+func TestContextJsonBodyError(t *testing.T) {
+	testCase := []struct {
+		contentType string
+		body        string
+		message     string
+	}{
+		{"application/json", `{"name":`, "请求体不是合法的json: unexpected EOF"},
+		{"application/json", `[1,2]`, "json请求体必须为对象"},
+		{"application/json", `{"name":"` + strings.Repeat("a", contextDefaultMaxBodySize) + `"}`, "请求体不能超过10485760字节"},
+		{"application/x-www-form-urlencoded", strings.Repeat("a", contextDefaultMaxBodySize+1), "请求体不能超过10485760字节"},
+	}
+	for _, singleTestCase := range testCase {
+		ctx := newContextTestRequest("/test", singleTestCase.contentType, singleTestCase.body)
+		assert.AssertException(t, InputErrorCode, singleTestCase.message, func() {
+			ctx.GetParamToStruct(&contextTestData{})
+		})
+	}
+}
+
+type contextTestController struct {
+	Controller
+}
+
+func (this *contextTestController) Add_Json_Post() interface{} {
+	data := contextTestData{}
+	this.Check(&data)
+	return data.Name
+}
+
+func (this *contextTestController) AutoRender(data interface{}, viewName string) {
+	result := map[string]interface{}{"code": 0, "data": data, "msg": ""}
+	if exception, ok := data.(language.Exception); ok {
+		result = map[string]interface{}{"code": exception.GetCode(), "data": nil, "msg": exception.GetMessage()}
+	}
+	if this.Ctx.GetParam("_view") != "" {
+		result["view"] = this.Ctx.GetParam("_view")
+	}
+	resultByte, _ := json.Marshal(result)
+	this.Ctx.WriteHeader("Content-Type", "application/json; charset=utf-8")
+	this.Write(resultByte)
+}
+
+func TestContextJsonBodyErrorRoute(t *testing.T) {
+	oldRouteTree := handler.routeTree
+	defer func() {
+		handler.routeTree = oldRouteTree
+	}()
+	handler.routeTree = nil
+	handler.addRoute("/contexttest", &contextTestController{}, 0)
+	server := httptest.NewServer(http.HandlerFunc(handler.innerServeHTTP))
+	defer server.Close()
+
+	//请求体的错误只在业务中抛出一次，输出400的业务错误
+	testCase := []struct {
+		body   string
+		result string
+	}{
+		{`{"name":"fish"}`, `{"code":0,"data":"fish","msg":""}`},
+		{`{"name":`, `{"code":400,"data":null,"msg":"请求体不是合法的json: unexpected EOF","view":"json"}`},
+	}
+	for singleIndex, singleTestCase := range testCase {
+		url := server.URL + "/contexttest/add"
+		if singleIndex == 1 {
+			url += "?_view=json"
+		}
+		response, err := http.Post(url, "application/json", strings.NewReader(singleTestCase.body))
+		assert.AssertEqual(t, err, nil)
+		body, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		assert.AssertEqual(t, response.StatusCode, 200, singleIndex)
+		assert.AssertEqual(t, string(body), singleTestCase.result, singleIndex)
+	}
+}
+
+func TestContextRemoteIp(t *testing.T) {
+	oldTrustedProxies := globalTrustedProxies
+	defer func() {
+		globalTrustedProxies = oldTrustedProxies
+	}()
+	globalTrustedProxies, _ = NewTrustedProxies([]string{"10.0.0.1"})
+	testCase := []struct {
+		remoteAddr string
+		proxy      string
+		remoteIp   string
+		remotePort int
+		clientIp   string
+	}{
+		{"192.168.1.1:1234", "", "192.168.1.1", 1234, "192.168.1.1"},
+		{"[fd00::1]:1234", "", "fd00::1", 1234, "fd00::1"},
+		{"192.168.1.1:1234", "172.16.0.1", "172.16.0.1", 80, "192.168.1.1"},
+		{"10.0.0.1:1234", "172.16.0.1", "172.16.0.1", 80, "172.16.0.1"},
+		{"10.0.0.1:1234", "fd00::2", "fd00::2", 80, "fd00::2"},
+	}
+	for singleIndex, singleTestCase := range testCase {
+		request, _ := http.NewRequest("GET", "/", nil)
+		request.RemoteAddr = singleTestCase.remoteAddr
+		if singleTestCase.proxy != "" {
+			request.Header.Set("X-Forwarded-For", singleTestCase.proxy)
+		}
+		ctx := NewContext(request, &memoryResponseWriter{}, nil)
+		assert.AssertEqual(t, ctx.GetRemoteIP(), singleTestCase.remoteIp, singleIndex)
+		assert.AssertEqual(t, ctx.GetRemotePort(), singleTestCase.remotePort, singleIndex)
+		assert.AssertEqual(t, ctx.GetClientIP(), singleTestCase.clientIp, singleIndex)
+	}
+}
@@ -0,0 +1,155 @@
+package web
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	. "github.com/milkbobo/fishgoweb/language"
+)
+
+type Cors interface {
+	IsAllowOrigin(origin string) bool
+	WriteHeader(ctx Context)
+	WritePreflightHeader(ctx Context, allowMethods []string)
+}
+
+type CorsConfig struct {
+	AllowOrigins     []string
+	AllowMethods     []string
+	AllowHeaders     []string
+	ExposeHeaders    []string
+	MaxAge           int
+	AllowCredentials bool
+}
+
+type corsImplement struct {
+	config      CorsConfig
+	isAllowAll  bool
+	origins     []string
+	originRegex []*regexp.Regexp
+}
+
+// origin支持通配符，如https://*.example.com与http://localhost:*，单独的*表示允许所有来源但不允许携带cookie
+func NewCors(config CorsConfig) (Cors, error) {
+	if len(config.AllowOrigins) == 0 {
+		return nil, nil
+	}
+	result := &corsImplement{
+		config: config,
+	}
+	for _, single := range config.AllowOrigins {
+		single = strings.ToLower(strings.TrimSpace(single))
+		if single == "" {
+			continue
+		} else if single == "*" {
+			result.isAllowAll = true
+		} else if strings.Contains(single, "*") {
+			pattern := strings.Replace(regexp.QuoteMeta(single), `\*`, `[^/:]+`, -1)
+			singleRegex, err := regexp.Compile("^" + pattern + "$")
+			if err != nil {
+				return nil, err
+			}
+			result.originRegex = append(result.originRegex, singleRegex)
+		} else {
+			result.origins = append(result.origins, strings.TrimRight(single, "/"))
+		}
+	}
+	result.config.AllowMethods = []string{}
+	for _, single := range config.AllowMethods {
+		result.config.AllowMethods = append(result.config.AllowMethods, strings.ToUpper(single))
+	}
+	return result, nil
+}
+
+func NewCorsFromConfig() (Cors, error) {
+	corsConfig := globalBasic.Config.Get().Cors
+	splitConfig := func(data string) []string {
+		result := []string{}
+		for _, single := range Explode(data, ",") {
+			single = strings.TrimSpace(single)
+			if single != "" {
+				result = append(result, single)
+			}
+		}
+		return result
+	}
+	return NewCors(CorsConfig{
+		AllowOrigins:     splitConfig(corsConfig.AllowOrigins),
+		AllowMethods:     splitConfig(corsConfig.AllowMethods),
+		AllowHeaders:     splitConfig(corsConfig.AllowHeaders),
+		ExposeHeaders:    splitConfig(corsConfig.ExposeHeaders),
+		MaxAge:           corsConfig.MaxAge,
+		AllowCredentials: corsConfig.AllowCredentials,
+	})
+}
+
+func (this *corsImplement) isMatchOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	if ArrayIn(this.origins, origin) != -1 {
+		return true
+	}
+	for _, single := range this.originRegex {
+		if single.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *corsImplement) IsAllowOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	return this.isAllowAll || this.isMatchOrigin(origin)
+}
+
+func (this *corsImplement) writeOriginHeader(ctx Context) bool {
+	origin := ctx.GetHeader("Origin")
+	ctx.WriteHeader("Vary", "Origin")
+	if this.isMatchOrigin(origin) {
+		//只有明确配置的来源才能携带cookie
+		ctx.WriteHeader("Access-Control-Allow-Origin", origin)
+		if this.config.AllowCredentials {
+			ctx.WriteHeader("Access-Control-Allow-Credentials", "true")
+		}
+		return true
+	} else if this.isAllowAll && origin != "" {
+		ctx.WriteHeader("Access-Control-Allow-Origin", "*")
+		return true
+	}
+	return false
+}
+
+func (this *corsImplement) WriteHeader(ctx Context) {
+	if this.writeOriginHeader(ctx) == false {
+		return
+	}
+	if len(this.config.ExposeHeaders) != 0 {
+		ctx.WriteHeader("Access-Control-Expose-Headers", strings.Join(this.config.ExposeHeaders, ", "))
+	}
+}
+
+// 预检请求，没有配置allowMethods时使用路由允许的方法
+func (this *corsImplement) WritePreflightHeader(ctx Context, allowMethods []string) {
+	isAllow := this.writeOriginHeader(ctx)
+	ctx.WriteHeader("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+	if isAllow == false {
+		return
+	}
+	if len(this.config.AllowMethods) != 0 {
+		allowMethods = this.config.AllowMethods
+	}
+	ctx.WriteHeader("Access-Control-Allow-Methods", strings.Join(allowMethods, ", "))
+	requestHeaders := ctx.GetHeader("Access-Control-Request-Headers")
+	if len(this.config.AllowHeaders) == 1 && this.config.AllowHeaders[0] == "*" {
+		if requestHeaders != "" {
+			ctx.WriteHeader("Access-Control-Allow-Headers", requestHeaders)
+		}
+	} else if len(this.config.AllowHeaders) != 0 {
+		ctx.WriteHeader("Access-Control-Allow-Headers", strings.Join(this.config.AllowHeaders, ", "))
+	}
+	if this.config.MaxAge > 0 {
+		ctx.WriteHeader("Access-Control-Max-Age", strconv.Itoa(this.config.MaxAge))
+	}
+}
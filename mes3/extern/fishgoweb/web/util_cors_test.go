@@ -0,0 +1,86 @@
+package web
+
+import (
+	"github.com/milkbobo/fishgoweb/assert"
+	"net/http"
+	"testing"
+)
+
+func TestCors(t *testing.T) {
+	cors, err := NewCors(CorsConfig{
+		AllowOrigins:     []string{"https://app.example.com", "https://*.example.org", "http://localhost:*"},
+		AllowHeaders:     []string{"Content-Type", "X-Request-Id"},
+		ExposeHeaders:    []string{"X-Request-Id"},
+		MaxAge:           600,
+		AllowCredentials: true,
+	})
+	assert.AssertEqual(t, err, nil)
+	allowAllCors, err := NewCors(CorsConfig{
+		AllowOrigins:     []string{"*"},
+		AllowMethods:     []string{"get", "post"},
+		AllowHeaders:     []string{"*"},
+		AllowCredentials: true,
+	})
+	assert.AssertEqual(t, err, nil)
+	emptyCors, err := NewCors(CorsConfig{})
+	assert.AssertEqual(t, err, nil)
+	assert.AssertEqual(t, emptyCors, nil)
+
+	testCase := []struct {
+		cors        Cors
+		origin      string
+		isPreflight bool
+		header      map[string]string
+	}{
+		{cors, "https://app.example.com", false, map[string]string{
+			"Access-Control-Allow-Origin":      "https://app.example.com",
+			"Access-Control-Allow-Credentials": "true",
+			"Access-Control-Expose-Headers":    "X-Request-Id",
+			"Vary":                             "Origin",
+		}},
+		{cors, "https://Admin.Example.org", false, map[string]string{
+			"Access-Control-Allow-Origin":      "https://Admin.Example.org",
+			"Access-Control-Allow-Credentials": "true",
+			"Access-Control-Expose-Headers":    "X-Request-Id",
+			"Vary":                             "Origin",
+		}},
+		{cors, "https://evil.com", false, map[string]string{
+			"Vary": "Origin",
+		}},
+		{cors, "https://example.org.evil.com", false, map[string]string{
+			"Vary": "Origin",
+		}},
+		{cors, "http://localhost:8000", true, map[string]string{
+			"Access-Control-Allow-Origin":      "http://localhost:8000",
+			"Access-Control-Allow-Credentials": "true",
+			"Access-Control-Allow-Methods":     "GET, POST",
+			"Access-Control-Allow-Headers":     "Content-Type, X-Request-Id",
+			"Access-Control-Max-Age":           "600",
+			"Vary":                             "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+		}},
+		{allowAllCors, "https://evil.com", true, map[string]string{
+			"Access-Control-Allow-Origin":  "*",
+			"Access-Control-Allow-Methods": "GET, POST",
+			"Access-Control-Allow-Headers": "X-Token",
+			"Vary":                         "Origin, Access-Control-Request-Method, Access-Control-Request-Headers",
+		}},
+	}
+	for singleIndex, singleTestCase := range testCase {
+		request, _ := http.NewRequest("OPTIONS", "/test", nil)
+		request.Header.Set("Origin", singleTestCase.origin)
+		request.Header.Set("Access-Control-Request-Method", "POST")
+		request.Header.Set("Access-Control-Request-Headers", "X-Token")
+		response := &memoryResponseWriter{}
+		ctx := NewContext(request, response, nil)
+		if singleTestCase.isPreflight {
+			singleTestCase.cors.WritePreflightHeader(ctx, []string{"GET", "POST"})
+		} else {
+			singleTestCase.cors.WriteHeader(ctx)
+		}
+		header := map[string]string{}
+		for key := range response.Header() {
+			header[key] = response.Header().Get(key)
+		}
+		assert.AssertEqual(t, header, singleTestCase.header, singleIndex)
+	}
+}
@@ -1,6 +1,7 @@
 package web
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"reflect"
@@ -8,6 +9,7 @@ import (
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+	. "github.com/milkbobo/fishgoweb/language"
 	"xorm.io/core"
 	"xorm.io/xorm"
 )
@@ -60,13 +62,19 @@ type DatabaseSession interface {
 	Begin() error
 	Commit() error
 	LastSQL() (string, []interface{})
+	Transaction(handler func(sess DatabaseSession))
+	CreateTable(bean interface{}) error
+	DropTable(beanOrTableName interface{}) error
 }
 
 type Database interface {
 	DatabaseCommon
 	Close() error
 	NewSession() DatabaseSession
+	WithContext(ctx context.Context) Database
 	GetStats() sql.DBStats
+	Ping(ctx context.Context) error
+	Transaction(handler func(sess DatabaseSession))
 }
 
 type DatabaseConfig struct {
@@ -81,37 +89,82 @@ type DatabaseConfig struct {
 	Debug             bool
 	MaxConnection     int
 	MaxIdleConnection int
+	Replicas          string
+	Balance           string
+	Sticky            int
+	ReplicaCheck      int
 }
 
 type databaseImplement struct {
 	*xorm.Engine
-	config DatabaseConfig
+	group    *xorm.EngineGroup
+	replicas *databaseReplicaSet
+	config   DatabaseConfig
+	ctx      context.Context
+	sticky   *databaseSticky
 }
 
 type databaseSessionImplement struct {
 	*xorm.Session
+	sticky      *databaseSticky
+	transaction *databaseTransaction
 }
 
 func NewDatabase(config DatabaseConfig) (Database, error) {
 	if config.Driver == "" {
 		return nil, nil
 	}
+	if config.Driver == "sqlite3" && ArrayIn(sql.Drivers(), "sqlite3") == -1 {
+		return nil, fmt.Errorf("sqlite3 driver is not compiled, build with -tags sqlite3")
+	}
 	if config.Charset == "" {
 		config.Charset = "utf8"
 	}
 	if config.Collation == "" {
 		config.Collation = "utf8_general_ci"
 	}
-	dblink := fmt.Sprintf(
-		"%s:%s@tcp(%s:%d)/%s?charset=%v&collation=%v&loc=Local",
-		config.User,
-		config.Password,
-		config.Host,
-		config.Port,
-		config.Database,
-		config.Charset,
-		config.Collation,
-	)
+	tempDb, err := newDatabaseEngine(config, config.Host, config.Port)
+	if err != nil {
+		return nil, err
+	}
+	result := &databaseImplement{
+		Engine: tempDb,
+		config: config,
+	}
+	if config.Replicas != "" {
+		if config.Driver == "sqlite3" {
+			tempDb.Close()
+			return nil, fmt.Errorf("sqlite3 not support replicas")
+		}
+		err := result.initReplicas()
+		if err != nil {
+			tempDb.Close()
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func newDatabaseEngine(config DatabaseConfig, host string, port int) (*xorm.Engine, error) {
+	var dblink string
+	if config.Driver == "sqlite3" {
+		//database为文件路径，为空或者:memory:时使用内存数据库
+		if config.Database == "" {
+			config.Database = ":memory:"
+		}
+		dblink = fmt.Sprintf("%s?_loc=auto&_busy_timeout=5000", config.Database)
+	} else {
+		dblink = fmt.Sprintf(
+			"%s:%s@tcp(%s:%d)/%s?charset=%v&collation=%v&loc=Local",
+			config.User,
+			config.Password,
+			host,
+			port,
+			config.Database,
+			config.Charset,
+			config.Collation,
+		)
+	}
 	tempDb, err := xorm.NewEngine(config.Driver, dblink)
 	if err != nil {
 		return nil, err
@@ -129,11 +182,14 @@ func NewDatabase(config DatabaseConfig) (Database, error) {
 		tempDb.SetMaxIdleConns(config.MaxIdleConnection)
 		tempDb.DB().SetConnMaxLifetime(time.Hour * 3)
 	}
+	if config.Driver == "sqlite3" && config.Database == ":memory:" {
+		//内存数据库每个连接都是独立的库，只能使用单个长连接
+		tempDb.SetMaxOpenConns(1)
+		tempDb.SetMaxIdleConns(1)
+		tempDb.DB().SetConnMaxLifetime(0)
+	}
 	tempDb.Ping()
-	return &databaseImplement{
-		Engine: tempDb,
-		config: config,
-	}, nil
+	return tempDb, nil
 }
 
 func NewDatabaseFromConfig(configName string) (Database, error) {
@@ -154,6 +210,22 @@ func NewDatabaseFromConfig(configName string) (Database, error) {
 	return NewDatabase(config)
 }
 
+// 按[xxx.db.name]创建所有的具名连接
+func NewDatabasesFromConfig() (map[string]Database, error) {
+	result := map[string]Database{}
+	for name, single := range globalBasic.Config.Get().DBs {
+		db, err := NewDatabase(DatabaseConfig(single))
+		if err != nil {
+			return nil, err
+		}
+		if db == nil {
+			continue
+		}
+		result[name] = db
+	}
+	return result, nil
+}
+
 type zeroable interface {
 	IsZero() bool
 }
@@ -162,6 +234,10 @@ func (this *databaseImplement) GetStats() sql.DBStats {
 	return this.Engine.DB().Stats()
 }
 
+func (this *databaseImplement) Ping(ctx context.Context) error {
+	return this.Engine.DB().PingContext(ctx)
+}
+
 func (this *databaseImplement) rValue(bean interface{}) reflect.Value {
 	return reflect.Indirect(reflect.ValueOf(bean))
 }
@@ -263,92 +339,179 @@ func (this *databaseImplement) autoMapType(v reflect.Value) *core.Table {
 	return table
 }
 
-func newDatabaseSession(sess *xorm.Session) DatabaseSession {
-	return &databaseSessionImplement{Session: sess}
+// 全局的数据库没有绑定context，每个session有独立的粘滞状态
+func (this *databaseImplement) newSession(sess *xorm.Session) DatabaseSession {
+	sticky := this.sticky
+	if sticky == nil {
+		sticky = this.newSticky()
+	}
+	return &databaseSessionImplement{Session: sess, sticky: sticky, transaction: &databaseTransaction{}}
+}
+
+// 同一个请求中其他地方写入后，已经创建的session在后续的查询中同样走主库
+func (this *databaseSessionImplement) newSession(sess *xorm.Session) DatabaseSession {
+	if this.sticky.isActive() {
+		pinDatabaseSessionMaster(sess)
+	}
+	return &databaseSessionImplement{Session: sess, sticky: this.sticky, transaction: this.transaction}
+}
+
+// 写入后记录粘滞，并把session固定到主库
+func (this *databaseSessionImplement) markWrite() {
+	this.sticky.markWrite()
+	pinDatabaseSessionMaster(this.Session)
+}
+
+// 绑定context后，所有查询在context取消时中断，initBasic中会绑定请求的context
+// 每个请求，定时任务与队列消费都有独立的读写粘滞状态，全局的数据库不记录写入，避免互相影响
+func (this *databaseImplement) WithContext(ctx context.Context) Database {
+	newDatabase := *this
+	newDatabase.ctx = ctx
+	newDatabase.sticky = this.newSticky()
+	return &newDatabase
+}
+
+func (this *databaseImplement) getContext() context.Context {
+	if this.ctx == nil {
+		return context.Background()
+	}
+	return this.ctx
+}
+
+// 与xorm.Engine的链式方法一致，执行一次后自动关闭
+func (this *databaseImplement) autoCloseSession() *xorm.Session {
+	if this.isReadReplica() {
+		return this.group.Context(this.getContext())
+	}
+	return this.Engine.Context(this.getContext())
 }
 
 func (this *databaseImplement) NewSession() DatabaseSession {
-	return newDatabaseSession(this.Engine.NewSession())
+	if this.isReadReplica() {
+		return this.newSession(this.group.NewSession().Context(this.getContext()))
+	}
+	return this.newSession(this.Engine.NewSession().Context(this.getContext()))
+}
+
+func (this *databaseImplement) Exec(args ...interface{}) (sql.Result, error) {
+	defer this.sticky.markWrite()
+	return this.autoCloseSession().Exec(args...)
+}
+
+func (this *databaseImplement) Query(args ...interface{}) (resultsSlice []map[string][]byte, err error) {
+	return this.autoCloseSession().Query(args...)
+}
+
+func (this *databaseImplement) Insert(beans ...interface{}) (int64, error) {
+	defer this.sticky.markWrite()
+	return this.autoCloseSession().Insert(beans...)
+}
+
+func (this *databaseImplement) InsertOne(bean interface{}) (int64, error) {
+	defer this.sticky.markWrite()
+	return this.autoCloseSession().InsertOne(bean)
+}
+
+func (this *databaseImplement) Update(bean interface{}, condiBeans ...interface{}) (int64, error) {
+	defer this.sticky.markWrite()
+	return this.autoCloseSession().Update(bean, condiBeans...)
+}
+
+func (this *databaseImplement) Delete(bean ...interface{}) (int64, error) {
+	defer this.sticky.markWrite()
+	return this.autoCloseSession().Delete(bean...)
+}
+
+func (this *databaseImplement) Get(bean ...interface{}) (bool, error) {
+	return this.autoCloseSession().Get(bean...)
+}
+
+func (this *databaseImplement) Find(beans interface{}, condiBeans ...interface{}) error {
+	return this.autoCloseSession().Find(beans, condiBeans...)
+}
+
+func (this *databaseImplement) Count(bean ...interface{}) (int64, error) {
+	return this.autoCloseSession().Count(bean...)
 }
 
 func (this *databaseImplement) SQL(querystring string, args ...interface{}) DatabaseSession {
-	return newDatabaseSession(this.Engine.SQL(querystring, args...))
+	return this.newSession(this.autoCloseSession().SQL(querystring, args...))
 }
 
 func (this *databaseImplement) NoAutoTime() DatabaseSession {
-	return newDatabaseSession(this.Engine.NoAutoTime())
+	return this.newSession(this.autoCloseSession().NoAutoTime())
 }
 
 func (this *databaseImplement) NoAutoCondition(no ...bool) DatabaseSession {
-	return newDatabaseSession(this.Engine.NoAutoCondition(no...))
+	return this.newSession(this.autoCloseSession().NoAutoCondition(no...))
 }
 
 func (this *databaseImplement) Cascade(trueOrFalse ...bool) DatabaseSession {
-	return newDatabaseSession(this.Engine.Cascade(trueOrFalse...))
+	return this.newSession(this.autoCloseSession().Cascade(trueOrFalse...))
 }
 
 func (this *databaseImplement) Where(querystring string, args ...interface{}) DatabaseSession {
-	return newDatabaseSession(this.Engine.Where(querystring, args...))
+	return this.newSession(this.autoCloseSession().Where(querystring, args...))
 }
 
 func (this *databaseImplement) ID(id interface{}) DatabaseSession {
-	return newDatabaseSession(this.Engine.ID(id))
+	return this.newSession(this.autoCloseSession().ID(id))
 }
 
 func (this *databaseImplement) Distinct(columns ...string) DatabaseSession {
-	return newDatabaseSession(this.Engine.Distinct(columns...))
+	return this.newSession(this.autoCloseSession().Distinct(columns...))
 }
 
 func (this *databaseImplement) Select(str string) DatabaseSession {
-	return newDatabaseSession(this.Engine.Select(str))
+	return this.newSession(this.autoCloseSession().Select(str))
 }
 
 func (this *databaseImplement) Cols(columns ...string) DatabaseSession {
-	return newDatabaseSession(this.Engine.Cols(columns...))
+	return this.newSession(this.autoCloseSession().Cols(columns...))
 }
 
 func (this *databaseImplement) AllCols() DatabaseSession {
-	return newDatabaseSession(this.Engine.AllCols())
+	return this.newSession(this.autoCloseSession().AllCols())
 }
 
 func (this *databaseImplement) MustCols(columns ...string) DatabaseSession {
-	return newDatabaseSession(this.Engine.MustCols(columns...))
+	return this.newSession(this.autoCloseSession().MustCols(columns...))
 }
 
 func (this *databaseImplement) UseBool(columns ...string) DatabaseSession {
-	return newDatabaseSession(this.Engine.UseBool(columns...))
+	return this.newSession(this.autoCloseSession().UseBool(columns...))
 }
 
 func (this *databaseImplement) Omit(columns ...string) DatabaseSession {
-	return newDatabaseSession(this.Engine.Omit(columns...))
+	return this.newSession(this.autoCloseSession().Omit(columns...))
 }
 
 func (this *databaseImplement) Nullable(columns ...string) DatabaseSession {
-	return newDatabaseSession(this.Engine.Nullable(columns...))
+	return this.newSession(this.autoCloseSession().Nullable(columns...))
 }
 
 func (this *databaseImplement) In(column string, args ...interface{}) DatabaseSession {
-	return newDatabaseSession(this.Engine.In(column, args...))
+	return this.newSession(this.autoCloseSession().In(column, args...))
 }
 
 func (this *databaseImplement) Incr(column string, args ...interface{}) DatabaseSession {
-	return newDatabaseSession(this.Engine.Incr(column, args...))
+	return this.newSession(this.autoCloseSession().Incr(column, args...))
 }
 
 func (this *databaseImplement) Decr(column string, args ...interface{}) DatabaseSession {
-	return newDatabaseSession(this.Engine.Decr(column, args...))
+	return this.newSession(this.autoCloseSession().Decr(column, args...))
 }
 
 func (this *databaseImplement) SetExpr(column string, expression string) DatabaseSession {
-	return newDatabaseSession(this.Engine.SetExpr(column, expression))
+	return this.newSession(this.autoCloseSession().SetExpr(column, expression))
 }
 
 func (this *databaseImplement) Table(tableNameOrBean interface{}) DatabaseSession {
-	return newDatabaseSession(this.Engine.Table(tableNameOrBean))
+	return this.newSession(this.autoCloseSession().Table(tableNameOrBean))
 }
 
 func (this *databaseImplement) Alias(alias string) DatabaseSession {
-	return newDatabaseSession(this.Engine.Alias(alias))
+	return this.newSession(this.autoCloseSession().Alias(alias))
 }
 
 func (this *databaseImplement) Limit(limit int, start ...int) DatabaseSession {
@@ -356,31 +519,31 @@ func (this *databaseImplement) Limit(limit int, start ...int) DatabaseSession {
 	if limit == 0 {
 		start = []int{1}
 	}
-	return newDatabaseSession(this.Engine.Limit(limit, start...))
+	return this.newSession(this.autoCloseSession().Limit(limit, start...))
 }
 
 func (this *databaseImplement) Desc(colNames ...string) DatabaseSession {
-	return newDatabaseSession(this.Engine.Desc(colNames...))
+	return this.newSession(this.autoCloseSession().Desc(colNames...))
 }
 
 func (this *databaseImplement) Asc(colNames ...string) DatabaseSession {
-	return newDatabaseSession(this.Engine.Asc(colNames...))
+	return this.newSession(this.autoCloseSession().Asc(colNames...))
 }
 
 func (this *databaseImplement) OrderBy(order string) DatabaseSession {
-	return newDatabaseSession(this.Engine.OrderBy(order))
+	return this.newSession(this.autoCloseSession().OrderBy(order))
 }
 
 func (this *databaseImplement) Join(join_operator string, tablename interface{}, condition string, args ...interface{}) DatabaseSession {
-	return newDatabaseSession(this.Engine.Join(join_operator, tablename, condition, args...))
+	return this.newSession(this.autoCloseSession().Join(join_operator, tablename, condition, args...))
 }
 
 func (this *databaseImplement) GroupBy(keys string) DatabaseSession {
-	return newDatabaseSession(this.Engine.GroupBy(keys))
+	return this.newSession(this.autoCloseSession().GroupBy(keys))
 }
 
 func (this *databaseImplement) Having(conditions string) DatabaseSession {
-	return newDatabaseSession(this.Engine.Having(conditions))
+	return this.newSession(this.autoCloseSession().Having(conditions))
 }
 
 type tableMapper struct {
@@ -417,83 +580,83 @@ func (this *columnMapper) Table2Obj(in string) string {
 }
 
 func (this *databaseSessionImplement) SQL(querystring string, args ...interface{}) DatabaseSession {
-	return newDatabaseSession(this.Session.SQL(querystring, args...))
+	return this.newSession(this.Session.SQL(querystring, args...))
 }
 
 func (this *databaseSessionImplement) NoAutoTime() DatabaseSession {
-	return newDatabaseSession(this.Session.NoAutoTime())
+	return this.newSession(this.Session.NoAutoTime())
 }
 
 func (this *databaseSessionImplement) NoAutoCondition(no ...bool) DatabaseSession {
-	return newDatabaseSession(this.Session.NoAutoCondition(no...))
+	return this.newSession(this.Session.NoAutoCondition(no...))
 }
 
 func (this *databaseSessionImplement) Cascade(trueOrFalse ...bool) DatabaseSession {
-	return newDatabaseSession(this.Session.Cascade(trueOrFalse...))
+	return this.newSession(this.Session.Cascade(trueOrFalse...))
 }
 
 func (this *databaseSessionImplement) Where(querystring string, args ...interface{}) DatabaseSession {
-	return newDatabaseSession(this.Session.Where(querystring, args...))
+	return this.newSession(this.Session.Where(querystring, args...))
 }
 
 func (this *databaseSessionImplement) ID(id interface{}) DatabaseSession {
-	return newDatabaseSession(this.Session.ID(id))
+	return this.newSession(this.Session.ID(id))
 }
 
 func (this *databaseSessionImplement) Distinct(columns ...string) DatabaseSession {
-	return newDatabaseSession(this.Session.Distinct(columns...))
+	return this.newSession(this.Session.Distinct(columns...))
 }
 
 func (this *databaseSessionImplement) Select(str string) DatabaseSession {
-	return newDatabaseSession(this.Session.Select(str))
+	return this.newSession(this.Session.Select(str))
 }
 
 func (this *databaseSessionImplement) Cols(columns ...string) DatabaseSession {
-	return newDatabaseSession(this.Session.Cols(columns...))
+	return this.newSession(this.Session.Cols(columns...))
 }
 
 func (this *databaseSessionImplement) AllCols() DatabaseSession {
-	return newDatabaseSession(this.Session.AllCols())
+	return this.newSession(this.Session.AllCols())
 }
 
 func (this *databaseSessionImplement) MustCols(columns ...string) DatabaseSession {
-	return newDatabaseSession(this.Session.MustCols(columns...))
+	return this.newSession(this.Session.MustCols(columns...))
 }
 
 func (this *databaseSessionImplement) UseBool(columns ...string) DatabaseSession {
-	return newDatabaseSession(this.Session.UseBool(columns...))
+	return this.newSession(this.Session.UseBool(columns...))
 }
 
 func (this *databaseSessionImplement) Omit(columns ...string) DatabaseSession {
-	return newDatabaseSession(this.Session.Omit(columns...))
+	return this.newSession(this.Session.Omit(columns...))
 }
 
 func (this *databaseSessionImplement) Nullable(columns ...string) DatabaseSession {
-	return newDatabaseSession(this.Session.Nullable(columns...))
+	return this.newSession(this.Session.Nullable(columns...))
 }
 
 func (this *databaseSessionImplement) In(column string, args ...interface{}) DatabaseSession {
-	return newDatabaseSession(this.Session.In(column, args...))
+	return this.newSession(this.Session.In(column, args...))
 }
 
 func (this *databaseSessionImplement) Incr(column string, args ...interface{}) DatabaseSession {
-	return newDatabaseSession(this.Session.Incr(column, args...))
+	return this.newSession(this.Session.Incr(column, args...))
 }
 
 func (this *databaseSessionImplement) Decr(column string, args ...interface{}) DatabaseSession {
-	return newDatabaseSession(this.Session.Decr(column, args...))
+	return this.newSession(this.Session.Decr(column, args...))
 }
 
 func (this *databaseSessionImplement) SetExpr(column string, expression string) DatabaseSession {
-	return newDatabaseSession(this.Session.SetExpr(column, expression))
+	return this.newSession(this.Session.SetExpr(column, expression))
 }
 
 func (this *databaseSessionImplement) Table(tableNameOrBean interface{}) DatabaseSession {
-	return newDatabaseSession(this.Session.Table(tableNameOrBean))
+	return this.newSession(this.Session.Table(tableNameOrBean))
 }
 
 func (this *databaseSessionImplement) Alias(alias string) DatabaseSession {
-	return newDatabaseSession(this.Session.Alias(alias))
+	return this.newSession(this.Session.Alias(alias))
 }
 
 func (this *databaseSessionImplement) Limit(limit int, start ...int) DatabaseSession {
@@ -501,41 +664,66 @@ func (this *databaseSessionImplement) Limit(limit int, start ...int) DatabaseSes
 	if limit == 0 {
 		start = []int{1}
 	}
-	return newDatabaseSession(this.Session.Limit(limit, start...))
+	return this.newSession(this.Session.Limit(limit, start...))
 }
 
 func (this *databaseSessionImplement) Desc(colNames ...string) DatabaseSession {
-	return newDatabaseSession(this.Session.Desc(colNames...))
+	return this.newSession(this.Session.Desc(colNames...))
 }
 
 func (this *databaseSessionImplement) Asc(colNames ...string) DatabaseSession {
-	return newDatabaseSession(this.Session.Asc(colNames...))
+	return this.newSession(this.Session.Asc(colNames...))
 }
 
 func (this *databaseSessionImplement) OrderBy(order string) DatabaseSession {
-	return newDatabaseSession(this.Session.OrderBy(order))
+	return this.newSession(this.Session.OrderBy(order))
 }
 
 func (this *databaseSessionImplement) Join(join_operator string, tablename interface{}, condition string, args ...interface{}) DatabaseSession {
-	return newDatabaseSession(this.Session.Join(join_operator, tablename, condition, args...))
+	return this.newSession(this.Session.Join(join_operator, tablename, condition, args...))
 }
 
 func (this *databaseSessionImplement) GroupBy(keys string) DatabaseSession {
-	return newDatabaseSession(this.Session.GroupBy(keys))
+	return this.newSession(this.Session.GroupBy(keys))
 }
 
 func (this *databaseSessionImplement) Having(conditions string) DatabaseSession {
-	return newDatabaseSession(this.Session.Having(conditions))
+	return this.newSession(this.Session.Having(conditions))
 }
 
 func (this *databaseSessionImplement) And(querystring string, args ...interface{}) DatabaseSession {
-	return newDatabaseSession(this.Session.And(querystring, args...))
+	return this.newSession(this.Session.And(querystring, args...))
 }
 
 func (this *databaseSessionImplement) Or(querystring string, args ...interface{}) DatabaseSession {
-	return newDatabaseSession(this.Session.Or(querystring, args...))
+	return this.newSession(this.Session.Or(querystring, args...))
 }
 
 func (this *databaseSessionImplement) ForUpdate() DatabaseSession {
-	return newDatabaseSession(this.Session.ForUpdate())
+	return this.newSession(this.Session.ForUpdate())
+}
+
+func (this *databaseSessionImplement) Exec(args ...interface{}) (sql.Result, error) {
+	defer this.markWrite()
+	return this.Session.Exec(args...)
+}
+
+func (this *databaseSessionImplement) Insert(beans ...interface{}) (int64, error) {
+	defer this.markWrite()
+	return this.Session.Insert(beans...)
+}
+
+func (this *databaseSessionImplement) InsertOne(bean interface{}) (int64, error) {
+	defer this.markWrite()
+	return this.Session.InsertOne(bean)
+}
+
+func (this *databaseSessionImplement) Update(bean interface{}, condiBeans ...interface{}) (int64, error) {
+	defer this.markWrite()
+	return this.Session.Update(bean, condiBeans...)
+}
+
+func (this *databaseSessionImplement) Delete(bean ...interface{}) (int64, error) {
+	defer this.markWrite()
+	return this.Session.Delete(bean...)
 }
@@ -0,0 +1,219 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	. "github.com/milkbobo/fishgoweb/language"
+	"xorm.io/xorm"
+)
+
+// 写入后的window内读请求走主库，保证读到自己的写入，为nil时不粘滞
+type databaseSticky struct {
+	lastWrite int64
+	window    time.Duration
+}
+
+type databaseReplica struct {
+	engine *xorm.Engine
+	host   string
+	isDown int32
+}
+
+// 实现xorm.GroupPolicy，只在健康的从库中选择，全部不可用时退回主库
+type databaseReplicaSet struct {
+	balance  string
+	replicas []*databaseReplica
+	position uint32
+	closeCh   chan bool
+	closeWg   sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// xorm.Session的sessionType字段，group session在自动提交时把SELECT发往从库
+var databaseSessionTypeField, _ = reflect.TypeOf(xorm.Session{}).FieldByName("sessionType")
+
+func (this *databaseSticky) markWrite() {
+	if this == nil {
+		return
+	}
+	atomic.StoreInt64(&this.lastWrite, time.Now().UnixNano())
+}
+
+func (this *databaseSticky) isActive() bool {
+	if this == nil || this.window <= 0 {
+		return false
+	}
+	lastWrite := atomic.LoadInt64(&this.lastWrite)
+	if lastWrite == 0 {
+		return false
+	}
+	return time.Since(time.Unix(0, lastWrite)) < this.window
+}
+
+// session创建时可能还没有写入，xorm没有提供切换的方法，粘滞后把group session改为普通session，之后的读都走主库
+func pinDatabaseSessionMaster(sess *xorm.Session) {
+	reflect.NewAt(databaseSessionTypeField.Type, unsafe.Pointer(uintptr(unsafe.Pointer(sess))+databaseSessionTypeField.Offset)).Elem().SetBool(false)
+}
+
+func (this *databaseImplement) newSticky() *databaseSticky {
+	return &databaseSticky{window: time.Duration(this.config.Sticky) * time.Second}
+}
+
+// replicas为逗号分隔的host:port，与主库使用相同的用户，密码与数据库
+func (this *databaseImplement) initReplicas() error {
+	if this.config.Balance == "" {
+		this.config.Balance = "roundrobin"
+	}
+	if this.config.Balance != "roundrobin" && this.config.Balance != "leastconn" {
+		return errors.New("invalid database balance " + this.config.Balance)
+	}
+	if this.config.ReplicaCheck <= 0 {
+		this.config.ReplicaCheck = 5
+	}
+	//sticky默认为1秒，小于0时不粘滞
+	if this.config.Sticky == 0 {
+		this.config.Sticky = 1
+	}
+	replicaSet := &databaseReplicaSet{
+		balance: this.config.Balance,
+		closeCh: make(chan bool),
+	}
+	for _, single := range Explode(this.config.Replicas, ",") {
+		host, port, err := parseDatabaseReplicaHost(single, this.config.Port)
+		if err != nil {
+			replicaSet.close()
+			return err
+		}
+		engine, err := newDatabaseEngine(this.config, host, port)
+		if err != nil {
+			replicaSet.close()
+			return err
+		}
+		replicaSet.replicas = append(replicaSet.replicas, &databaseReplica{
+			engine: engine,
+			host:   single,
+		})
+	}
+
+	//从库只有一个时xorm不会调用policy，把主库也放在从库列表中，保证每次都经过健康检查的选择
+	slaves := []*xorm.Engine{}
+	for _, single := range replicaSet.replicas {
+		slaves = append(slaves, single.engine)
+	}
+	slaves = append(slaves, this.Engine)
+	group, err := xorm.NewEngineGroup(this.Engine, slaves, replicaSet)
+	if err != nil {
+		replicaSet.close()
+		return err
+	}
+	this.group = group
+	this.replicas = replicaSet
+	replicaSet.checkOnce(time.Duration(this.config.ReplicaCheck) * time.Second)
+	replicaSet.closeWg.Add(1)
+	go replicaSet.check(time.Duration(this.config.ReplicaCheck) * time.Second)
+	return nil
+}
+
+func parseDatabaseReplicaHost(replica string, defaultPort int) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(replica)
+	if err != nil {
+		return replica, defaultPort, nil
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", 0, errors.New("invalid database replica " + replica)
+	}
+	return host, port, nil
+}
+
+// 没有从库，或者当前请求刚写入过时，读请求也走主库
+func (this *databaseImplement) isReadReplica() bool {
+	if this.group == nil {
+		return false
+	}
+	return this.sticky.isActive() == false
+}
+
+func (this *databaseImplement) Close() error {
+	if this.replicas != nil {
+		this.replicas.close()
+	}
+	return this.Engine.Close()
+}
+
+func (this *databaseReplicaSet) Slave(group *xorm.EngineGroup) *xorm.Engine {
+	healthy := make([]*databaseReplica, 0, len(this.replicas))
+	for _, single := range this.replicas {
+		if atomic.LoadInt32(&single.isDown) == 0 {
+			healthy = append(healthy, single)
+		}
+	}
+	if len(healthy) == 0 {
+		return group.Master()
+	}
+	if this.balance == "leastconn" {
+		result := healthy[0]
+		resultInUse := result.engine.DB().Stats().InUse
+		for _, single := range healthy[1:] {
+			inUse := single.engine.DB().Stats().InUse
+			if inUse < resultInUse {
+				result = single
+				resultInUse = inUse
+			}
+		}
+		return result.engine
+	}
+	position := atomic.AddUint32(&this.position, 1)
+	return healthy[int(position-1)%len(healthy)].engine
+}
+
+func (this *databaseReplicaSet) checkOnce(timeout time.Duration) {
+	var wg sync.WaitGroup
+	for _, single := range this.replicas {
+		wg.Add(1)
+		go func(single *databaseReplica) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			if single.engine.DB().PingContext(ctx) != nil {
+				atomic.StoreInt32(&single.isDown, 1)
+			} else {
+				atomic.StoreInt32(&single.isDown, 0)
+			}
+		}(single)
+	}
+	wg.Wait()
+}
+
+func (this *databaseReplicaSet) check(interval time.Duration) {
+	defer this.closeWg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-this.closeCh:
+			return
+		case <-ticker.C:
+			this.checkOnce(interval)
+		}
+	}
+}
+
+// WithContext后的数据库共用同一个从库集合，可以重复关闭
+func (this *databaseReplicaSet) close() {
+	this.closeOnce.Do(func() {
+		close(this.closeCh)
+		this.closeWg.Wait()
+		for _, single := range this.replicas {
+			single.engine.Close()
+		}
+	})
+}
@@ -0,0 +1,164 @@
+package web
+
+import (
+	"context"
+	"github.com/milkbobo/fishgoweb/assert"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDatabaseReplicaConfig(t *testing.T) {
+	_, err := NewDatabase(DatabaseConfig{
+		Driver:   "mysql",
+		Host:     "127.0.0.1",
+		Port:     1,
+		Replicas: "127.0.0.1:2",
+		Balance:  "random",
+	})
+	assert.AssertEqual(t, err.Error(), "invalid database balance random")
+	_, err = NewDatabase(DatabaseConfig{
+		Driver:   "mysql",
+		Host:     "127.0.0.1",
+		Port:     1,
+		Replicas: "127.0.0.1:abc",
+	})
+	assert.AssertEqual(t, err.Error(), "invalid database replica 127.0.0.1:abc")
+
+	testCase := []struct {
+		replica string
+		host    string
+		port    int
+	}{
+		{"10.0.0.1:3307", "10.0.0.1", 3307},
+		{"10.0.0.1", "10.0.0.1", 3306},
+		{"[::1]:3308", "::1", 3308},
+	}
+	for singleIndex, singleTestCase := range testCase {
+		host, port, err := parseDatabaseReplicaHost(singleTestCase.replica, 3306)
+		assert.AssertEqual(t, err, nil, singleIndex)
+		assert.AssertEqual(t, host, singleTestCase.host, singleIndex)
+		assert.AssertEqual(t, port, singleTestCase.port, singleIndex)
+	}
+}
+
+func TestDatabaseReplicaBalance(t *testing.T) {
+	newDatabase := func(balance string) *databaseImplement {
+		db, err := NewDatabase(DatabaseConfig{
+			Driver:       "mysql",
+			Host:         "127.0.0.1",
+			Port:         1,
+			Replicas:     "127.0.0.1:2,127.0.0.1:3",
+			Balance:      balance,
+			ReplicaCheck: 3600,
+		})
+		assert.AssertEqual(t, err, nil)
+		return db.(*databaseImplement)
+	}
+	db := newDatabase("")
+	defer db.Close()
+	replicas := db.replicas.replicas
+
+	//从库都不可用时退回主库
+	assert.AssertEqual(t, db.group.Slave() == db.Engine, true)
+
+	//轮询健康的从库
+	atomic.StoreInt32(&replicas[0].isDown, 0)
+	atomic.StoreInt32(&replicas[1].isDown, 0)
+	assert.AssertEqual(t, db.group.Slave() == replicas[0].engine, true)
+	assert.AssertEqual(t, db.group.Slave() == replicas[1].engine, true)
+	assert.AssertEqual(t, db.group.Slave() == replicas[0].engine, true)
+	atomic.StoreInt32(&replicas[0].isDown, 1)
+	assert.AssertEqual(t, db.group.Slave() == replicas[1].engine, true)
+	assert.AssertEqual(t, db.group.Slave() == replicas[1].engine, true)
+
+	leastConnDb := newDatabase("leastconn")
+	defer leastConnDb.Close()
+	for _, single := range leastConnDb.replicas.replicas {
+		atomic.StoreInt32(&single.isDown, 0)
+	}
+	assert.AssertEqual(t, leastConnDb.group.Slave() == leastConnDb.replicas.replicas[0].engine, true)
+}
+
+func TestDatabaseReplicaSticky(t *testing.T) {
+	noReplicaDb, err := NewDatabase(DatabaseConfig{Driver: "mysql", Host: "127.0.0.1", Port: 1})
+	assert.AssertEqual(t, err, nil)
+	defer noReplicaDb.Close()
+	assert.AssertEqual(t, noReplicaDb.(*databaseImplement).isReadReplica(), false)
+
+	db, err := NewDatabase(DatabaseConfig{
+		Driver:       "mysql",
+		Host:         "127.0.0.1",
+		Port:         1,
+		Replicas:     "127.0.0.1:2",
+		Sticky:       60,
+		ReplicaCheck: 3600,
+	})
+	assert.AssertEqual(t, err, nil)
+	defer db.Close()
+
+	//写入只影响当前请求后续的读
+	request1 := db.WithContext(context.Background()).(*databaseImplement)
+	request2 := db.WithContext(context.Background()).(*databaseImplement)
+	assert.AssertEqual(t, request1.isReadReplica(), true)
+	request1.NewSession().(*databaseSessionImplement).sticky.markWrite()
+	assert.AssertEqual(t, request1.isReadReplica(), false)
+	assert.AssertEqual(t, request2.isReadReplica(), true)
+
+	//全局的数据库不记录写入，每个session有独立的粘滞状态
+	global := db.(*databaseImplement)
+	session1 := global.NewSession().(*databaseSessionImplement)
+	session2 := global.NewSession().(*databaseSessionImplement)
+	session1.sticky.markWrite()
+	assert.AssertEqual(t, session1.sticky.isActive(), true)
+	assert.AssertEqual(t, session2.sticky.isActive(), false)
+	assert.AssertEqual(t, global.isReadReplica(), true)
+
+	//session写入后，以及同一个请求中其他地方写入后，session的查询都走主库
+	isGroupSession := func(sess DatabaseSession) bool {
+		return reflect.ValueOf(sess.(*databaseSessionImplement).Session).Elem().FieldByName("sessionType").Bool()
+	}
+	session3 := global.NewSession()
+	assert.AssertEqual(t, isGroupSession(session3), true)
+	session3.(*databaseSessionImplement).markWrite()
+	assert.AssertEqual(t, isGroupSession(session3), false)
+	request4 := db.WithContext(context.Background())
+	session4 := request4.NewSession()
+	assert.AssertEqual(t, isGroupSession(session4.Where("1 = 1")), true)
+	request4.NewSession().(*databaseSessionImplement).sticky.markWrite()
+	assert.AssertEqual(t, isGroupSession(session4.Where("1 = 1")), false)
+
+	//sticky小于0时不粘滞
+	noStickyDb, err := NewDatabase(DatabaseConfig{
+		Driver:       "mysql",
+		Host:         "127.0.0.1",
+		Port:         1,
+		Replicas:     "127.0.0.1:2",
+		Sticky:       -1,
+		ReplicaCheck: 3600,
+	})
+	assert.AssertEqual(t, err, nil)
+	defer noStickyDb.Close()
+	request5 := noStickyDb.WithContext(context.Background()).(*databaseImplement)
+	request5.NewSession().(*databaseSessionImplement).sticky.markWrite()
+	assert.AssertEqual(t, request5.isReadReplica(), true)
+
+	//配置了从库时sticky默认为1秒
+	defaultDb, err := NewDatabase(DatabaseConfig{
+		Driver:       "mysql",
+		Host:         "127.0.0.1",
+		Port:         1,
+		Replicas:     "127.0.0.1:2",
+		ReplicaCheck: 3600,
+	})
+	assert.AssertEqual(t, err, nil)
+	defer defaultDb.Close()
+	assert.AssertEqual(t, defaultDb.(*databaseImplement).config.Sticky, 1)
+	request3 := defaultDb.WithContext(context.Background()).(*databaseImplement)
+	request3.NewSession().(*databaseSessionImplement).sticky.markWrite()
+	assert.AssertEqual(t, request3.isReadReplica(), false)
+
+	//重复关闭不会panic
+	assert.AssertEqual(t, request3.Close(), nil)
+	assert.AssertEqual(t, defaultDb.Close(), nil)
+}
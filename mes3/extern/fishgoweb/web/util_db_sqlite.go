@@ -0,0 +1,9 @@
+//go:build sqlite3
+// +build sqlite3
+
+package web
+
+// sqlite3的驱动依赖cgo，只在使用-tags sqlite3编译时引入，一般用于本地测试
+import (
+	_ "github.com/mattn/go-sqlite3"
+)
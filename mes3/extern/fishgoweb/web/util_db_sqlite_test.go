@@ -0,0 +1,173 @@
+//go:build sqlite3
+// +build sqlite3
+
+package web
+
+import (
+	"github.com/milkbobo/fishgoweb/assert"
+	"github.com/milkbobo/fishgoweb/language"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+type SqliteTestUser struct {
+	UserId     int `xorm:"autoincr"`
+	Name       string
+	Age        int
+	CreateTime time.Time `xorm:"created"`
+}
+
+func newSqliteTestDatabase(t *testing.T, database string) Database {
+	db, err := NewDatabase(DatabaseConfig{Driver: "sqlite3", Database: database})
+	assert.AssertEqual(t, err, nil)
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS t_sqlite_test_user (" +
+		"userId integer NOT NULL PRIMARY KEY AUTOINCREMENT," +
+		"name varchar(32) NOT NULL," +
+		"age integer NOT NULL," +
+		"createTime datetime NOT NULL)")
+	assert.AssertEqual(t, err, nil)
+	return db
+}
+
+func TestDatabaseSqlite(t *testing.T) {
+	db := newSqliteTestDatabase(t, "")
+	defer db.Close()
+
+	//与mysql使用相同的表名与列名映射
+	user := SqliteTestUser{Name: "fish", Age: 10}
+	_, err := db.Insert(&user)
+	assert.AssertEqual(t, err, nil)
+	assert.AssertEqual(t, user.UserId, 1)
+	_, err = db.Insert(&SqliteTestUser{Name: "cat", Age: 20})
+	assert.AssertEqual(t, err, nil)
+	_, err = db.Where("userId = ?", 2).Cols("age").Update(&SqliteTestUser{Age: 21})
+	assert.AssertEqual(t, err, nil)
+
+	users := []SqliteTestUser{}
+	err = db.Where("age > ?", 5).Asc("userId").Find(&users)
+	assert.AssertEqual(t, err, nil)
+	assert.AssertEqual(t, len(users), 2)
+	assert.AssertEqual(t, users[0].Name, "fish")
+	assert.AssertEqual(t, users[1].Age, 21)
+	assert.AssertEqual(t, users[0].CreateTime.IsZero(), false)
+
+	//内存数据库在事务中也使用同一个连接
+	func() {
+		defer language.Catch(func(exception language.Exception) {
+			assert.AssertEqual(t, exception.GetMessage(), "rollback")
+		})
+		db.Transaction(func(sess DatabaseSession) {
+			sess.Insert(&SqliteTestUser{Name: "dog", Age: 30})
+			sess.Transaction(func(sess DatabaseSession) {
+				sess.Insert(&SqliteTestUser{Name: "bird", Age: 40})
+			})
+			language.Throw(1, "rollback")
+		})
+	}()
+	db.Transaction(func(sess DatabaseSession) {
+		sess.Insert(&SqliteTestUser{Name: "dog", Age: 30})
+		func() {
+			defer language.Catch(func(exception language.Exception) {
+			})
+			sess.Transaction(func(sess DatabaseSession) {
+				sess.Insert(&SqliteTestUser{Name: "bird", Age: 40})
+				language.Throw(1, "rollback")
+			})
+		}()
+	})
+	count, err := db.Count(&SqliteTestUser{})
+	assert.AssertEqual(t, err, nil)
+	assert.AssertEqual(t, count, int64(3))
+
+	//sqlite3不支持从库
+	_, err = NewDatabase(DatabaseConfig{Driver: "sqlite3", Replicas: "127.0.0.1:3306"})
+	assert.AssertEqual(t, err.Error(), "sqlite3 not support replicas")
+}
+
+func TestDatabaseSqliteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite_test")
+	assert.AssertEqual(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	//文件数据库重新打开后数据仍在
+	db := newSqliteTestDatabase(t, dir+"/test.db")
+	_, err = db.Insert(&SqliteTestUser{Name: "fish", Age: 10})
+	assert.AssertEqual(t, err, nil)
+	db.Close()
+
+	db = newSqliteTestDatabase(t, dir+"/test.db")
+	defer db.Close()
+	user := SqliteTestUser{}
+	isExist, err := db.Where("name = ?", "fish").Get(&user)
+	assert.AssertEqual(t, err, nil)
+	assert.AssertEqual(t, isExist, true)
+	assert.AssertEqual(t, user.Age, 10)
+}
+
+func TestMigrateSqlite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate_sqlite_test")
+	assert.AssertEqual(t, err, nil)
+	defer os.RemoveAll(dir)
+	oldMigrations := migrations
+	oldDBs := globalBasic.DBs
+	defer func() {
+		migrations = oldMigrations
+		globalBasic.DBs = oldDBs
+	}()
+	migrations = map[string][]AppMigration{}
+	db, err := NewDatabase(DatabaseConfig{Driver: "sqlite3"})
+	assert.AssertEqual(t, err, nil)
+	defer db.Close()
+	globalBasic.DBs = map[string]Database{"sqlitetest": db}
+	migrate, err := NewMigrate(MigrateConfig{Path: dir})
+	assert.AssertEqual(t, err, nil)
+
+	//Go迁移使用xorm按方言生成建表语句
+	AddMigration("sqlitetest", AppMigration{
+		Version: "20200101000000",
+		Name:    "create_user",
+		Up: func(sess DatabaseSession) {
+			type sqliteTestUser struct {
+				UserId int    `xorm:"pk autoincr"`
+				Name   string `xorm:"varchar(32) notnull"`
+			}
+			err := sess.Table("t_sqlite_test_user").CreateTable(&sqliteTestUser{})
+			if err != nil {
+				panic(err)
+			}
+		},
+		Down: func(sess DatabaseSession) {
+			err := sess.DropTable("t_sqlite_test_user")
+			if err != nil {
+				panic(err)
+			}
+		},
+	})
+	os.MkdirAll(dir+"/sqlitetest", os.ModePerm)
+	ioutil.WriteFile(dir+"/sqlitetest/20200102000000_init_user.up.sql", []byte("INSERT INTO t_sqlite_test_user (name) VALUES ('fish');\nINSERT INTO t_unknown VALUES (1);"), 0644)
+	status, err := migrate.Up("sqlitetest", 0)
+	assert.AssertEqual(t, len(status), 1)
+	assert.AssertEqual(t, strings.HasPrefix(err.Error(), "migration 20200102000000_init_user fail at step 2/3: no such table: t_unknown"), true, err.Error())
+
+	//sqlite3中失败的迁移整体回滚，重新执行时从头开始
+	count, err := db.Table("t_sqlite_test_user").Count()
+	assert.AssertEqual(t, err, nil)
+	assert.AssertEqual(t, count, int64(0))
+	ioutil.WriteFile(dir+"/sqlitetest/20200102000000_init_user.up.sql", []byte("INSERT INTO t_sqlite_test_user (name) VALUES ('fish');\nINSERT INTO t_sqlite_test_user (name) VALUES ('cat');"), 0644)
+	status, err = migrate.Up("sqlitetest", 0)
+	assert.AssertEqual(t, err, nil)
+	assert.AssertEqual(t, len(status), 1)
+	count, err = db.Table("t_sqlite_test_user").Where("userId = ?", 2).Count()
+	assert.AssertEqual(t, err, nil)
+	assert.AssertEqual(t, count, int64(1))
+
+	ioutil.WriteFile(dir+"/sqlitetest/20200102000000_init_user.down.sql", []byte("DELETE FROM t_sqlite_test_user;"), 0644)
+	status, err = migrate.Down("sqlitetest", 2)
+	assert.AssertEqual(t, err, nil)
+	assert.AssertEqual(t, len(status), 2)
+	_, err = db.Exec("SELECT * FROM t_sqlite_test_user")
+	assert.AssertEqual(t, err != nil, true)
+}
@@ -0,0 +1,134 @@
+package web
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// 同一个会话上正在执行的Transaction层数，大于0时Begin，Commit与Close由Transaction负责
+type databaseTransaction struct {
+	depth int
+}
+
+// 请求级事务中替换basic.DB，所有操作都在同一个事务会话上执行
+type databaseTransactionImplement struct {
+	DatabaseSession
+	db Database
+}
+
+// 正常返回时提交，Throw或者崩溃时回滚，异常会继续向上抛出
+func (this *databaseImplement) Transaction(handler func(sess DatabaseSession)) {
+	sess := this.NewSession()
+	defer sess.Close()
+	sess.Transaction(handler)
+}
+
+// 已经在事务中时使用savepoint，内层回滚不影响外层
+func (this *databaseSessionImplement) Transaction(handler func(sess DatabaseSession)) {
+	if this.transaction.depth == 0 && this.Session.IsInTx() == false {
+		this.runTransaction(handler)
+	} else {
+		this.runSavepoint(handler)
+	}
+}
+
+func (this *databaseSessionImplement) runTransaction(handler func(sess DatabaseSession)) {
+	err := this.Session.Begin()
+	if err != nil {
+		panic(err)
+	}
+	this.transaction.depth++
+	isCommit := false
+	defer func() {
+		this.transaction.depth--
+		if isCommit == false {
+			this.Session.Rollback()
+		}
+	}()
+	handler(this)
+	err = this.Session.Commit()
+	if err != nil {
+		panic(err)
+	}
+	isCommit = true
+}
+
+func (this *databaseSessionImplement) runSavepoint(handler func(sess DatabaseSession)) {
+	savepoint := fmt.Sprintf("sp_%d", this.transaction.depth)
+	_, err := this.Session.Exec("SAVEPOINT " + savepoint)
+	if err != nil {
+		panic(err)
+	}
+	this.transaction.depth++
+	isRelease := false
+	defer func() {
+		this.transaction.depth--
+		if isRelease == false {
+			this.Session.Exec("ROLLBACK TO SAVEPOINT " + savepoint)
+		}
+	}()
+	handler(this)
+	_, err = this.Session.Exec("RELEASE SAVEPOINT " + savepoint)
+	if err != nil {
+		panic(err)
+	}
+	isRelease = true
+}
+
+func (this *databaseSessionImplement) Begin() error {
+	if this.transaction.depth > 0 {
+		return nil
+	}
+	return this.Session.Begin()
+}
+
+func (this *databaseSessionImplement) Commit() error {
+	if this.transaction.depth > 0 {
+		return nil
+	}
+	return this.Session.Commit()
+}
+
+func (this *databaseSessionImplement) Close() error {
+	if this.transaction.depth > 0 {
+		return nil
+	}
+	return this.Session.Close()
+}
+
+func (this *databaseTransactionImplement) NewSession() DatabaseSession {
+	return this.DatabaseSession
+}
+
+func (this *databaseTransactionImplement) WithContext(ctx context.Context) Database {
+	return this
+}
+
+func (this *databaseTransactionImplement) GetStats() sql.DBStats {
+	return this.db.GetStats()
+}
+
+func (this *databaseTransactionImplement) Ping(ctx context.Context) error {
+	return this.db.Ping(ctx)
+}
+
+// 整个请求在basic.DB的一个事务中执行，业务正常返回时提交，Throw或者崩溃时回滚
+// 只需要单个方法开启时，使用AddMethodMiddleware(&XxxController{}, "Add_Json", NewTransactionMiddleware())
+// 事务会话不能在多个goroutine中同时使用
+func NewTransactionMiddleware() AppRouterRouteMiddleware {
+	return func(basic *Basic, method AppRouterMethodInfo, next func()) {
+		db := basic.DB
+		if db == nil {
+			next()
+			return
+		}
+		db.Transaction(func(sess DatabaseSession) {
+			basic.DB = &databaseTransactionImplement{DatabaseSession: sess, db: db}
+			defer func() {
+				basic.DB = db
+			}()
+			next()
+		})
+	}
+}
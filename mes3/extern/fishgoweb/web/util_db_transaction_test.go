@@ -0,0 +1,260 @@
+package web
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"github.com/milkbobo/fishgoweb/assert"
+	"github.com/milkbobo/fishgoweb/language"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"xorm.io/xorm/dialects"
+)
+
+// 只记录执行的语句的数据库驱动，复用mysql的dsn解析与方言
+type dbTestDriver struct {
+	mutex sync.Mutex
+	trace []string
+}
+
+type dbTestConn struct {
+	driver *dbTestDriver
+}
+
+type dbTestStmt struct {
+	conn  *dbTestConn
+	query string
+}
+
+var dbTest = &dbTestDriver{}
+
+func init() {
+	sql.Register("dbtest", dbTest)
+	dialects.RegisterDriver("dbtest", dialects.QueryDriver("mysql"))
+}
+
+func (this *dbTestDriver) Open(name string) (driver.Conn, error) {
+	return &dbTestConn{driver: this}, nil
+}
+
+func (this *dbTestDriver) record(query string) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.trace = append(this.trace, query)
+}
+
+func (this *dbTestDriver) getTrace() []string {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	result := this.trace
+	this.trace = nil
+	return result
+}
+
+func (this *dbTestConn) Prepare(query string) (driver.Stmt, error) {
+	return &dbTestStmt{conn: this, query: query}, nil
+}
+
+func (this *dbTestConn) Close() error {
+	return nil
+}
+
+func (this *dbTestConn) Begin() (driver.Tx, error) {
+	this.driver.record("BEGIN")
+	return this, nil
+}
+
+func (this *dbTestConn) Commit() error {
+	this.driver.record("COMMIT")
+	return nil
+}
+
+func (this *dbTestConn) Rollback() error {
+	this.driver.record("ROLLBACK")
+	return nil
+}
+
+func (this *dbTestStmt) Close() error {
+	return nil
+}
+
+func (this *dbTestStmt) NumInput() int {
+	return -1
+}
+
+func (this *dbTestStmt) Exec(args []driver.Value) (driver.Result, error) {
+	this.conn.driver.record(this.query)
+	return driver.RowsAffected(1), nil
+}
+
+// 查询总是返回空的结果，GET_LOCK总是成功
+func (this *dbTestStmt) Query(args []driver.Value) (driver.Rows, error) {
+	this.conn.driver.record(this.query)
+	if strings.HasPrefix(this.query, "SELECT GET_LOCK") {
+		return &dbTestRows{columns: []string{"lock"}, values: [][]driver.Value{{int64(1)}}}, nil
+	}
+	return &dbTestRows{}, nil
+}
+
+type dbTestRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (this *dbTestRows) Columns() []string {
+	return this.columns
+}
+
+func (this *dbTestRows) Close() error {
+	return nil
+}
+
+func (this *dbTestRows) Next(dest []driver.Value) error {
+	if len(this.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, this.values[0])
+	this.values = this.values[1:]
+	return nil
+}
+
+func newDbTestDatabase(t *testing.T) Database {
+	db, err := NewDatabase(DatabaseConfig{Driver: "dbtest", Host: "127.0.0.1", Port: 3306})
+	assert.AssertEqual(t, err, nil)
+	dbTest.getTrace()
+	return db
+}
+
+func runDbTestTransaction(db Database, handler func(sess DatabaseSession)) (result interface{}) {
+	defer func() {
+		result = recover()
+	}()
+	db.Transaction(handler)
+	return nil
+}
+
+func TestDatabaseTransaction(t *testing.T) {
+	db := newDbTestDatabase(t)
+	defer db.Close()
+
+	//正常返回时提交，业务中的Commit与Close不会提前结束事务
+	err := runDbTestTransaction(db, func(sess DatabaseSession) {
+		sess.Exec("UPDATE t_a SET a = 1")
+		assert.AssertEqual(t, sess.Commit(), nil)
+		assert.AssertEqual(t, sess.Close(), nil)
+		sess.Where("a = 1").Exec("UPDATE t_a SET b = 1")
+	})
+	assert.AssertEqual(t, err, nil)
+	assert.AssertEqual(t, dbTest.getTrace(), []string{"BEGIN", "UPDATE t_a SET a = 1", "UPDATE t_a SET b = 1", "COMMIT"})
+
+	//Throw与崩溃时回滚，并继续抛出
+	err = runDbTestTransaction(db, func(sess DatabaseSession) {
+		sess.Exec("UPDATE t_a SET a = 1")
+		language.Throw(1, "business error")
+	})
+	exception := err.(*language.Exception)
+	assert.AssertEqual(t, exception.GetMessage(), "business error")
+	assert.AssertEqual(t, dbTest.getTrace(), []string{"BEGIN", "UPDATE t_a SET a = 1", "ROLLBACK"})
+	err = runDbTestTransaction(db, func(sess DatabaseSession) {
+		panic("crash")
+	})
+	assert.AssertEqual(t, err, "crash")
+	assert.AssertEqual(t, dbTest.getTrace(), []string{"BEGIN", "ROLLBACK"})
+
+	//嵌套使用savepoint，内层回滚不影响外层
+	err = runDbTestTransaction(db, func(sess DatabaseSession) {
+		sess.Exec("UPDATE t_a SET a = 1")
+		innerErr := runDbTestTransaction(&databaseTransactionImplement{DatabaseSession: sess, db: db}, func(sess DatabaseSession) {
+			sess.Exec("UPDATE t_a SET b = 1")
+			language.Throw(1, "inner error")
+		})
+		assert.AssertEqual(t, innerErr != nil, true)
+		sess.Transaction(func(sess DatabaseSession) {
+			sess.Exec("UPDATE t_a SET c = 1")
+			sess.Transaction(func(sess DatabaseSession) {
+				sess.Exec("UPDATE t_a SET d = 1")
+			})
+		})
+	})
+	assert.AssertEqual(t, err, nil)
+	assert.AssertEqual(t, dbTest.getTrace(), []string{
+		"BEGIN",
+		"UPDATE t_a SET a = 1",
+		"SAVEPOINT sp_1",
+		"UPDATE t_a SET b = 1",
+		"ROLLBACK TO SAVEPOINT sp_1",
+		"SAVEPOINT sp_1",
+		"UPDATE t_a SET c = 1",
+		"SAVEPOINT sp_2",
+		"UPDATE t_a SET d = 1",
+		"RELEASE SAVEPOINT sp_2",
+		"RELEASE SAVEPOINT sp_1",
+		"COMMIT",
+	})
+}
+
+type transactionTestController struct {
+	Controller
+}
+
+func (this *transactionTestController) Add_Json() interface{} {
+	this.DB.Exec("UPDATE t_a SET a = 1")
+	this.DB.Transaction(func(sess DatabaseSession) {
+		sess.Exec("UPDATE t_a SET b = 1")
+	})
+	return nil
+}
+
+func (this *transactionTestController) Fail_Json() interface{} {
+	this.DB.Exec("UPDATE t_a SET a = 1")
+	language.Throw(1, "business error")
+	return nil
+}
+
+func (this *transactionTestController) Other_Json() interface{} {
+	this.DB.Exec("UPDATE t_a SET a = 1")
+	return nil
+}
+
+func (this *transactionTestController) AutoRender(data interface{}, viewName string) {
+	this.Ctx.Write([]byte("ok"))
+}
+
+func TestDatabaseTransactionMiddleware(t *testing.T) {
+	db := newDbTestDatabase(t)
+	defer db.Close()
+	oldDB := globalBasic.DB
+	oldRouteTree := handler.routeTree
+	oldRouteMethodMiddlewares := routeMethodMiddlewares
+	defer func() {
+		globalBasic.DB = oldDB
+		handler.routeTree = oldRouteTree
+		routeMethodMiddlewares = oldRouteMethodMiddlewares
+	}()
+	globalBasic.DB = db
+	handler.routeTree = nil
+	handler.addRoute("/transaction", &transactionTestController{}, 0)
+	AddMethodMiddleware(&transactionTestController{}, "Add_Json", NewTransactionMiddleware())
+	AddMethodMiddleware(&transactionTestController{}, "Fail_Json", NewTransactionMiddleware())
+	server := httptest.NewServer(http.HandlerFunc(handler.innerServeHTTP))
+	defer server.Close()
+
+	testCase := []struct {
+		url   string
+		trace []string
+	}{
+		{"/transaction/add", []string{"BEGIN", "UPDATE t_a SET a = 1", "SAVEPOINT sp_1", "UPDATE t_a SET b = 1", "RELEASE SAVEPOINT sp_1", "COMMIT"}},
+		{"/transaction/fail", []string{"BEGIN", "UPDATE t_a SET a = 1", "ROLLBACK"}},
+		{"/transaction/other", []string{"UPDATE t_a SET a = 1"}},
+	}
+	for singleIndex, singleTestCase := range testCase {
+		response, err := http.Get(server.URL + singleTestCase.url)
+		assert.AssertEqual(t, err, nil, singleIndex)
+		response.Body.Close()
+		assert.AssertEqual(t, response.StatusCode, 200, singleIndex)
+		assert.AssertEqual(t, dbTest.getTrace(), singleTestCase.trace, singleIndex)
+	}
+}
@@ -2,7 +2,7 @@ package web
 
 import (
 	"fmt"
-	. "github.com/milkbobo/fishgoweb/assert"
+	"github.com/milkbobo/fishgoweb/assert"
 	"testing"
 )
 
@@ -25,7 +25,7 @@ func TestOldestStayElem(t *testing.T) {
 	for i, _ := range stays {
 		stays[i].Timestamp = 0
 	}
-	AssertEqual(t, stays, []OldestStayElem{
+	assert.AssertEqual(t, stays, []OldestStayElem{
 		OldestStayElem{0, 11, "fish_11"},
 		OldestStayElem{0, 12, "fish_12"},
 		OldestStayElem{0, 14, "fish_14"},
@@ -45,7 +45,7 @@ func TestOldestStayElem(t *testing.T) {
 	for i, _ := range stays2 {
 		stays2[i].Timestamp = 0
 	}
-	AssertEqual(t, stays2, []OldestStayElem{
+	assert.AssertEqual(t, stays2, []OldestStayElem{
 		OldestStayElem{0, 11, "fish_11"},
 		OldestStayElem{0, 16, "fish_16"},
 		OldestStayElem{0, 17, "fish_17"},
@@ -58,7 +58,7 @@ func TestOldestStayElem(t *testing.T) {
 	for i, _ := range stays4 {
 		stays4[i].Timestamp = 0
 	}
-	AssertEqual(t, stays4, []OldestStayElem{
+	assert.AssertEqual(t, stays4, []OldestStayElem{
 		OldestStayElem{0, 11, "fish_11"},
 		OldestStayElem{0, 16, "fish_16"},
 		OldestStayElem{0, 17, "fish_17"},
@@ -76,7 +76,7 @@ func TestOldestStayElem(t *testing.T) {
 	for i, _ := range stays3 {
 		stays3[i].Timestamp = 0
 	}
-	AssertEqual(t, stays3, []OldestStayElem{
+	assert.AssertEqual(t, stays3, []OldestStayElem{
 		OldestStayElem{0, 16, "fish_16"},
 		OldestStayElem{0, 24, "cat_24"},
 	})
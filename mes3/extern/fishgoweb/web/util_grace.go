@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -20,18 +21,22 @@ var (
 
 type Grace interface {
 	ListenAndServe(port int, handler http.Handler) error
+	IsShutdown() bool
 }
 
 type GraceConfig struct {
 	Driver  string
 	Stop    []string
 	Restart []string
+	Drain   time.Duration
 }
 
 type graceImplement struct {
 	runGrace      bool
 	stopSignal    map[os.Signal]bool
 	restartSignal map[os.Signal]bool
+	drain         time.Duration
+	isShutdown    int32
 }
 
 func NewGrace(config GraceConfig) (Grace, error) {
@@ -57,10 +62,17 @@ func NewGrace(config GraceConfig) (Grace, error) {
 		}
 		restartSignal[signal] = true
 	}
+	//开启优雅关闭时drain默认为5秒，小于0时不等待
+	if goGrace && config.Drain == 0 {
+		config.Drain = 5 * time.Second
+	} else if config.Drain < 0 {
+		config.Drain = 0
+	}
 	return &graceImplement{
 		runGrace:      goGrace,
 		stopSignal:    stopSignal,
 		restartSignal: restartSignal,
+		drain:         config.Drain,
 	}, nil
 }
 
@@ -75,6 +87,7 @@ func NewGraceFromConfig() (Grace, error) {
 		Driver:  gracedirver,
 		Stop:    gracestop,
 		Restart: gracerestart,
+		Drain:   time.Duration(globalBasic.Config.Get().Grace.Drain) * time.Second,
 	}
 	return NewGrace(config)
 }
@@ -118,6 +131,12 @@ func (this *graceImplement) listenAndServeGrace(httpPort string, handler http.Ha
 		signal.Notify(quit, signalArray...)
 		// 这里会阻塞当前 Goroutine 等待信号
 		<-quit
+		//先标记为未就绪，等待负载均衡摘除流量后再关闭
+		atomic.StoreInt32(&this.isShutdown, 1)
+		if this.drain > 0 {
+			globalBasic.Log.Debug("等待%v后开始优雅关闭", this.drain)
+			time.Sleep(this.drain)
+		}
 		//调用Server.Shutdown graceful结束
 		globalBasic.Log.Debug("%+v", "开始优雅关闭")
 		timeoutCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -148,6 +167,11 @@ func (this *graceImplement) listenAndServeGrace(httpPort string, handler http.Ha
 	}
 }
 
+// 收到停止信号后返回true
+func (this *graceImplement) IsShutdown() bool {
+	return atomic.LoadInt32(&this.isShutdown) == 1
+}
+
 func (this *graceImplement) ListenAndServe(httpPort int, handler http.Handler) error {
 	if this.runGrace == false {
 		return http.ListenAndServe(":"+strconv.Itoa(httpPort), handler)
@@ -0,0 +1,25 @@
+package web
+
+import (
+	"github.com/milkbobo/fishgoweb/assert"
+	"testing"
+	"time"
+)
+
+func TestGraceDrain(t *testing.T) {
+	testCase := []struct {
+		driver string
+		drain  time.Duration
+		result time.Duration
+	}{
+		{"", 0, 0},
+		{"signal", 0, 5 * time.Second},
+		{"signal", time.Second, time.Second},
+		{"signal", -time.Second, 0},
+	}
+	for singleIndex, singleTestCase := range testCase {
+		grace, err := NewGrace(GraceConfig{Driver: singleTestCase.driver, Drain: singleTestCase.drain})
+		assert.AssertEqual(t, err, nil)
+		assert.AssertEqual(t, grace.(*graceImplement).drain, singleTestCase.result, singleIndex)
+	}
+}
@@ -6,15 +6,24 @@ import (
 	"github.com/beego/beego/logs"
 	"github.com/k0kubun/pp"
 	. "github.com/milkbobo/fishgoweb/language"
+	"io"
+	"os"
 	"path"
 	"reflect"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+// 日志的结构化字段，json驱动中作为独立的字段输出，其他驱动中以key=value追加在日志后面
+type LogFields map[string]interface{}
+
 type Log interface {
 	WithContextAndMonitor(ctx Context, monitor Monitor) Log
+	With(fields LogFields) Log
 	Emergency(format string, v ...interface{})
 	Alert(format string, v ...interface{})
 	Critical(format string, v ...interface{})
@@ -42,22 +51,25 @@ type LogConfig struct {
 type logImplement struct {
 	*logs.BeeLogger
 	monitor     Monitor
-	logPrefix   string
+	ctx         Context
+	fields      LogFields
 	prettyPrint bool
+	isJson      bool
+}
+
+var logLevelName = map[int]string{
+	logs.LevelEmergency:     "Emergency",
+	logs.LevelAlert:         "Alert",
+	logs.LevelCritical:      "Critical",
+	logs.LevelError:         "Error",
+	logs.LevelWarning:       "Warning",
+	logs.LevelNotice:        "Notice",
+	logs.LevelInformational: "Informational",
+	logs.LevelDebug:         "Debug",
 }
 
 func getLevel(in string) int {
-	levelString := map[string]int{
-		"Emergency":     logs.LevelEmergency,
-		"Alert":         logs.LevelAlert,
-		"Critical":      logs.LevelCritical,
-		"Error":         logs.LevelError,
-		"Warning":       logs.LevelWarning,
-		"Notice":        logs.LevelNotice,
-		"Informational": logs.LevelInformational,
-		"Debug":         logs.LevelDebug,
-	}
-	for key, value := range levelString {
+	for value, key := range logLevelName {
 		if strings.ToLower(in) == strings.ToLower(key) {
 			return value
 		}
@@ -88,6 +100,7 @@ func NewLog(config LogConfig) (Log, error) {
 	return &logImplement{
 		BeeLogger:   Log,
 		prettyPrint: config.PrettyPrint,
+		isJson:      config.Driver == "json",
 	}, nil
 }
 
@@ -108,13 +121,33 @@ func NewLogFromConfig() (Log, error) {
 }
 
 func (this *logImplement) WithContextAndMonitor(ctx Context, monitor Monitor) Log {
-	logPrefix := ctx.GetRemoteAddr()
 	newLogManager := *this
-	newLogManager.logPrefix = logPrefix
+	newLogManager.ctx = ctx
 	newLogManager.monitor = monitor
 	return &newLogManager
 }
 
+// 返回带有fields的子日志，与父日志的fields合并，同名的字段以新的为准
+func (this *logImplement) With(fields LogFields) Log {
+	newLogManager := *this
+	newLogManager.fields = LogFields{}
+	for key, value := range this.fields {
+		newLogManager.fields[key] = value
+	}
+	for key, value := range fields {
+		newLogManager.fields[key] = value
+	}
+	return &newLogManager
+}
+
+// 日志前缀为来源地址与请求Id，队列消费者反序列化请求后沿用生产者的请求Id
+func (this *logImplement) getLogPrefix() string {
+	if this.ctx == nil {
+		return ""
+	}
+	return this.ctx.GetRemoteAddr() + " " + this.ctx.GetRequestId()
+}
+
 func (this *logImplement) getTraceLineNumber(traceNumber int) string {
 	_, filename, line, ok := runtime.Caller(traceNumber + 1)
 	if !ok {
@@ -125,7 +158,7 @@ func (this *logImplement) getTraceLineNumber(traceNumber int) string {
 }
 
 func (this *logImplement) getLogFormat(format string, v []interface{}) string {
-	if this.prettyPrint {
+	if this.prettyPrint && this.isJson == false {
 		format = strings.Replace(format, "%+v", "%v", -1)
 		format = strings.Replace(format, "%#v", "%v", -1)
 		for singleIndex, singleV := range v {
@@ -142,60 +175,175 @@ func (this *logImplement) getLogFormat(format string, v []interface{}) string {
 			}
 		}
 	}
-	v = append([]interface{}{this.logPrefix, this.getTraceLineNumber(2)}, v...)
-	return fmt.Sprintf("%s %s "+format, v...)
+	return fmt.Sprintf(format, v...)
+}
+
+func (this *logImplement) getLogJson(level int, message string, caller string) string {
+	data := map[string]interface{}{}
+	for key, value := range this.fields {
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		data[key] = value
+	}
+	data["time"] = time.Now().Format(time.RFC3339Nano)
+	data["level"] = logLevelName[level]
+	data["caller"] = caller
+	data["msg"] = message
+	if this.ctx != nil {
+		data["remoteAddr"] = this.ctx.GetRemoteAddr()
+		data["requestId"] = this.ctx.GetRequestId()
+		data["traceId"] = this.ctx.GetTraceId()
+	}
+	result, err := json.Marshal(data)
+	if err != nil {
+		result, _ = json.Marshal(map[string]interface{}{
+			"time":   data["time"],
+			"level":  data["level"],
+			"caller": caller,
+			"msg":    message,
+			"error":  err.Error(),
+		})
+	}
+	return string(result)
+}
+
+// 字段按名称排序，保证同样的字段输出一致
+func (this *logImplement) getLogText(message string, caller string) string {
+	result := this.getLogPrefix() + " " + caller + " " + message
+	keys := []string{}
+	for key := range this.fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		result += fmt.Sprintf(" %s=%v", key, this.fields[key])
+	}
+	return result
+}
+
+func (this *logImplement) getLogMessage(level int, format string, v []interface{}) string {
+	caller := this.getTraceLineNumber(2)
+	message := this.getLogFormat(format, v)
+	if this.isJson {
+		return this.getLogJson(level, message, caller)
+	}
+	return this.getLogText(message, caller)
 }
 
 func (this *logImplement) Emergency(format string, v ...interface{}) {
-	this.BeeLogger.Emergency("%s", this.getLogFormat(format, v))
+	this.BeeLogger.Emergency("%s", this.getLogMessage(logs.LevelEmergency, format, v))
 }
 
 func (this *logImplement) Alert(format string, v ...interface{}) {
-	this.BeeLogger.Alert("%s", this.getLogFormat(format, v))
+	this.BeeLogger.Alert("%s", this.getLogMessage(logs.LevelAlert, format, v))
 }
 
 func (this *logImplement) Critical(format string, v ...interface{}) {
 	if this.monitor != nil {
 		this.monitor.AscCriticalCount()
 	}
-	this.BeeLogger.Critical("%s", this.getLogFormat(format, v))
+	this.BeeLogger.Critical("%s", this.getLogMessage(logs.LevelCritical, format, v))
 }
 
 func (this *logImplement) Error(format string, v ...interface{}) {
 	if this.monitor != nil {
 		this.monitor.AscErrorCount()
 	}
-	this.BeeLogger.Error("%s", this.getLogFormat(format, v))
+	this.BeeLogger.Error("%s", this.getLogMessage(logs.LevelError, format, v))
 }
 
 func (this *logImplement) Warning(format string, v ...interface{}) {
-	this.BeeLogger.Warning("%s", this.getLogFormat(format, v))
+	this.BeeLogger.Warning("%s", this.getLogMessage(logs.LevelWarning, format, v))
 }
 
 func (this *logImplement) Notice(format string, v ...interface{}) {
-	this.BeeLogger.Notice("%s", this.getLogFormat(format, v))
+	this.BeeLogger.Notice("%s", this.getLogMessage(logs.LevelNotice, format, v))
 }
 
 func (this *logImplement) Informational(format string, v ...interface{}) {
-	this.BeeLogger.Informational("%s", this.getLogFormat(format, v))
+	this.BeeLogger.Informational("%s", this.getLogMessage(logs.LevelInformational, format, v))
 }
 
 func (this *logImplement) Debug(format string, v ...interface{}) {
-	this.BeeLogger.Debug("%s", this.getLogFormat(format, v))
+	this.BeeLogger.Debug("%s", this.getLogMessage(logs.LevelDebug, format, v))
 }
 
 func (this *logImplement) Warn(format string, v ...interface{}) {
-	this.BeeLogger.Warn("%s", this.getLogFormat(format, v))
+	this.BeeLogger.Warn("%s", this.getLogMessage(logs.LevelWarning, format, v))
 }
 
 func (this *logImplement) Info(format string, v ...interface{}) {
-	this.BeeLogger.Info("%s", this.getLogFormat(format, v))
+	this.BeeLogger.Info("%s", this.getLogMessage(logs.LevelInformational, format, v))
 }
 
 func (this *logImplement) Trace(format string, v ...interface{}) {
-	this.BeeLogger.Trace(this.getLogFormat(format, v))
+	this.BeeLogger.Trace("%s", this.getLogMessage(logs.LevelDebug, format, v))
 }
 
 func (this *logImplement) Close() {
 	this.BeeLogger.Close()
 }
+
+// json驱动每行输出一个json对象，没有配置file时输出到标准输出
+type logJsonWriter struct {
+	Filename string `json:"filename"`
+	Level    int    `json:"level"`
+	writer   io.Writer
+	file     *os.File
+	lock     sync.Mutex
+}
+
+func newLogJsonWriter() logs.Logger {
+	return &logJsonWriter{
+		Level: logs.LevelDebug,
+	}
+}
+
+func (this *logJsonWriter) Init(config string) error {
+	err := json.Unmarshal([]byte(config), this)
+	if err != nil {
+		return err
+	}
+	if this.Filename == "" {
+		this.writer = os.Stdout
+		return nil
+	}
+	this.file, err = os.OpenFile(this.Filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0660)
+	if err != nil {
+		return err
+	}
+	this.writer = this.file
+	return nil
+}
+
+func (this *logJsonWriter) WriteMsg(when time.Time, msg string, level int) error {
+	if level > this.Level {
+		return nil
+	}
+	//去掉beego添加的级别前缀
+	index := strings.Index(msg, "{")
+	if index == -1 {
+		return nil
+	}
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	_, err := io.WriteString(this.writer, msg[index:]+"\n")
+	return err
+}
+
+func (this *logJsonWriter) Flush() {
+	if this.file != nil {
+		this.file.Sync()
+	}
+}
+
+func (this *logJsonWriter) Destroy() {
+	if this.file != nil {
+		this.file.Close()
+	}
+}
+
+func init() {
+	logs.Register("json", newLogJsonWriter)
+}
@@ -0,0 +1,60 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/milkbobo/fishgoweb/assert"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestLogJson(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logjson")
+	assert.AssertEqual(t, err, nil)
+	defer os.RemoveAll(dir)
+	filename := path.Join(dir, "app.log")
+
+	log, err := NewLog(LogConfig{
+		Driver:   "json",
+		Filename: filename,
+		Level:    getLevel("warning"),
+	})
+	assert.AssertEqual(t, err, nil)
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.Header.Set("X-Request-Id", "log-1")
+	ctx := NewContext(request, &memoryResponseWriter{}, nil)
+	requestLog := log.WithContextAndMonitor(ctx, nil)
+	orderLog := requestLog.With(LogFields{"orderId": 10001, "user": "fish"})
+	orderLog.With(LogFields{"user": "cat"}).Error("pay fail %d", 2)
+	orderLog.Debug("ignore")
+	requestLog.Warning("no fields")
+	log.Close()
+
+	data, err := ioutil.ReadFile(filename)
+	assert.AssertEqual(t, err, nil)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.AssertEqual(t, len(lines), 2)
+
+	var first map[string]interface{}
+	assert.AssertEqual(t, json.Unmarshal([]byte(lines[0]), &first), nil)
+	assert.AssertEqual(t, first["level"], "Error")
+	assert.AssertEqual(t, first["msg"], "pay fail 2")
+	assert.AssertEqual(t, first["orderId"], float64(10001))
+	assert.AssertEqual(t, first["user"], "cat")
+	assert.AssertEqual(t, first["requestId"], "log-1")
+	assert.AssertEqual(t, strings.HasPrefix(first["caller"].(string), "util_log_test.go:"), true)
+
+	var second map[string]interface{}
+	assert.AssertEqual(t, json.Unmarshal([]byte(lines[1]), &second), nil)
+	assert.AssertEqual(t, second["level"], "Warning")
+	assert.AssertEqual(t, second["msg"], "no fields")
+	assert.AssertEqual(t, second["orderId"], nil)
+}
+
+func TestLogText(t *testing.T) {
+	log := (&logImplement{}).With(LogFields{"b": 2, "a": "x"}).(*logImplement)
+	assert.AssertEqual(t, log.getLogText("hello", "main.go:1"), " main.go:1 hello a=x b=2")
+}
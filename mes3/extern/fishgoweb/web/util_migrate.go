@@ -0,0 +1,537 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/milkbobo/fishgoweb/language"
+	"xorm.io/xorm/schemas"
+)
+
+const (
+	migrateTableName = "t_migration"
+	//等待其他进程执行迁移的最长时间，单位为秒
+	migrateLockTimeout = 600
+)
+
+// Go代码的迁移，Version一般为创建时的时间如20060102150405，按Version从小到大执行
+type AppMigration struct {
+	Version string
+	Name    string
+	Up      func(sess DatabaseSession)
+	Down    func(sess DatabaseSession)
+}
+
+type MigrateStatus struct {
+	Database    string
+	Version     string
+	Name        string
+	Source      string
+	IsApplied   bool
+	AppliedTime string
+}
+
+type MigrateConfig struct {
+	Path  string
+	Check bool
+}
+
+type Migrate interface {
+	Up(dbName string, step int) ([]MigrateStatus, error)
+	Down(dbName string, step int) ([]MigrateStatus, error)
+	Status(dbName string) ([]MigrateStatus, error)
+	New(dbName string, name string) ([]string, error)
+	CheckPending() error
+}
+
+type migrateItem struct {
+	AppMigration
+	source  string
+	upSql   string
+	downSql string
+}
+
+type migrateImplement struct {
+	config MigrateConfig
+}
+
+var (
+	migrationsLock sync.Mutex
+	migrations     = map[string][]AppMigration{}
+	migrateFileReg = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+	migrateNameReg = regexp.MustCompile(`^\w+$`)
+)
+
+// 注册dbName对应数据库的Go迁移，需要在Run之前调用，一般放在init中
+func AddMigration(dbName string, migration AppMigration) {
+	migrationsLock.Lock()
+	defer migrationsLock.Unlock()
+	migrations[dbName] = append(migrations[dbName], migration)
+}
+
+// Path下每个数据库一个目录，如migrations/db/20060102150405_create_user.up.sql
+func NewMigrate(config MigrateConfig) (Migrate, error) {
+	if config.Path == "" {
+		return nil, errors.New("migrate path can not be empty")
+	}
+	return &migrateImplement{
+		config: config,
+	}, nil
+}
+
+// path相对于应用目录，即conf/app.toml所在目录的上一级
+func NewMigrateFromConfig() (Migrate, error) {
+	migrateConfig := MigrateConfig{}
+	migrateConfig.Path = globalBasic.Config.Get().Migrate.Path
+	migrateConfig.Check = globalBasic.Config.Get().Migrate.Check
+	if migrateConfig.Path == "" {
+		migrateConfig.Path = "migrations"
+	}
+	if path.IsAbs(migrateConfig.Path) == false {
+		appConfigPath, _, err := findAppConfPath("conf/app.toml")
+		if err != nil {
+			return nil, err
+		}
+		migrateConfig.Path = path.Dir(path.Dir(appConfigPath)) + "/" + migrateConfig.Path
+	}
+	return NewMigrate(migrateConfig)
+}
+
+func (this *migrateImplement) getDatabase(dbName string) (Database, error) {
+	db, isExist := globalBasic.getDatabases()[dbName]
+	if isExist == false {
+		return nil, errors.New("unknown database " + dbName)
+	}
+	return db, nil
+}
+
+// sql文件中的多条语句以行尾的分号分隔，忽略--开头的注释行
+func splitMigrateSql(data string) []string {
+	result := []string{}
+	current := []string{}
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "--") {
+			continue
+		}
+		current = append(current, line)
+		if strings.HasSuffix(line, ";") {
+			result = append(result, strings.TrimSuffix(strings.Join(current, "\n"), ";"))
+			current = []string{}
+		}
+	}
+	if len(current) != 0 {
+		result = append(result, strings.Join(current, "\n"))
+	}
+	return result
+}
+
+// 合并目录中的sql迁移与注册的Go迁移，按Version排序
+func (this *migrateImplement) getMigrations(dbName string) ([]migrateItem, error) {
+	itemMap := map[string]*migrateItem{}
+	dir := this.config.Path + "/" + dbName
+	files, err := ioutil.ReadDir(dir)
+	if err != nil && os.IsNotExist(err) == false {
+		return nil, err
+	}
+	for _, file := range files {
+		match := migrateFileReg.FindStringSubmatch(file.Name())
+		if file.IsDir() || match == nil {
+			continue
+		}
+		data, err := ioutil.ReadFile(dir + "/" + file.Name())
+		if err != nil {
+			return nil, err
+		}
+		item, isExist := itemMap[match[1]]
+		if isExist == false {
+			item = &migrateItem{source: "sql"}
+			item.Version = match[1]
+			item.Name = match[2]
+			itemMap[match[1]] = item
+		} else if item.Name != match[2] {
+			return nil, errors.New("duplicate migration version " + match[1])
+		}
+		if match[3] == "up" {
+			item.upSql = string(data)
+		} else {
+			item.downSql = string(data)
+		}
+	}
+	migrationsLock.Lock()
+	goMigrations := migrations[dbName]
+	migrationsLock.Unlock()
+	for _, single := range goMigrations {
+		if _, isExist := itemMap[single.Version]; isExist {
+			return nil, errors.New("duplicate migration version " + single.Version)
+		}
+		itemMap[single.Version] = &migrateItem{AppMigration: single, source: "go"}
+	}
+
+	result := []migrateItem{}
+	for _, item := range itemMap {
+		if item.source == "sql" && item.upSql == "" {
+			return nil, errors.New("migration " + item.Version + "_" + item.Name + " lack of up sql")
+		}
+		result = append(result, *item)
+	}
+	sort.Slice(result, func(i int, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+	return result, nil
+}
+
+func (this *migrateImplement) getApplied(db Database) (map[string]string, error) {
+	_, err := db.Exec("CREATE TABLE IF NOT EXISTS " + migrateTableName + " (" +
+		"version varchar(32) NOT NULL PRIMARY KEY," +
+		"name varchar(128) NOT NULL," +
+		"createTime datetime NOT NULL)")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query("SELECT version, createTime FROM " + migrateTableName)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]string{}
+	for _, row := range rows {
+		result[string(row["version"])] = string(row["createTime"])
+	}
+	return result, nil
+}
+
+func (this *migrateImplement) getStatus(dbName string, item migrateItem, applied map[string]string) MigrateStatus {
+	appliedTime, isApplied := applied[item.Version]
+	return MigrateStatus{
+		Database:    dbName,
+		Version:     item.Version,
+		Name:        item.Name,
+		Source:      item.source,
+		IsApplied:   isApplied,
+		AppliedTime: appliedTime,
+	}
+}
+
+// mysql的DDL会隐式提交，事务无法保证迁移的原子性，所以用GET_LOCK避免多个进程同时执行迁移
+// 锁与连接绑定，进程退出时随连接自动释放，其他驱动直接执行
+// sqlite3的DDL支持事务，并发执行时迁移表的主键冲突会回滚整个迁移
+func (this *migrateImplement) lock(db Database, dbName string) (func(), error) {
+	database, ok := db.(*databaseImplement)
+	if ok == false || database.Engine.Dialect().URI().DBType != schemas.MYSQL {
+		return func() {}, nil
+	}
+	ctx := context.Background()
+	conn, err := database.Engine.DB().DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lockName := migrateTableName + ":" + database.config.Database
+	var isLock sql.NullInt64
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", lockName, migrateLockTimeout).Scan(&isLock)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if isLock.Int64 != 1 {
+		conn.Close()
+		return nil, errors.New("database " + dbName + " is migrating by another process")
+	}
+	return func() {
+		conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", lockName)
+		conn.Close()
+	}, nil
+}
+
+// 每个迁移在单独的事务中执行，并在同一个事务中更新迁移表
+// 注意mysql的DDL，如CREATE，ALTER与DROP会隐式提交事务，失败时之前执行的DDL不会回滚，
+// 所以一个迁移最好只包含一条DDL，每一步执行前都会记录到日志，失败时返回出错的步骤，以便手动修复后重新执行
+func (this *migrateImplement) runMigration(db Database, dbName string, item migrateItem, isUp bool) (err error) {
+	direction := "down"
+	if isUp {
+		direction = "up"
+	}
+	step, total := 0, 1
+	defer CatchCrash(func(exception Exception) {
+		err = fmt.Errorf("migration %s_%s fail at step %d/%d: %s", item.Version, item.Name, step, total, exception.GetMessage())
+	})
+	logStep := func(statement string) {
+		step++
+		if globalBasic.Log != nil {
+			globalBasic.Log.Informational("Migrate Database:[%s] Migration:[%s_%s] Direction:[%s] Step:[%d/%d] Sql:[%s]", dbName, item.Version, item.Name, direction, step, total, statement)
+		}
+	}
+	db.Transaction(func(sess DatabaseSession) {
+		var handler func(sess DatabaseSession)
+		var sql string
+		if isUp {
+			handler, sql = item.Up, item.upSql
+		} else {
+			handler, sql = item.Down, item.downSql
+		}
+		if item.source == "sql" {
+			sqls := splitMigrateSql(sql)
+			total = len(sqls) + 1
+			for _, single := range sqls {
+				logStep(single)
+				_, err := sess.Exec(single)
+				if err != nil {
+					panic(err)
+				}
+			}
+		} else if handler != nil {
+			total = 2
+			logStep("(go)")
+			handler(sess)
+		}
+		var record []interface{}
+		if isUp {
+			record = []interface{}{"INSERT INTO " + migrateTableName + " (version, name, createTime) VALUES (?, ?, ?)", item.Version, item.Name, time.Now().Format("2006-01-02 15:04:05")}
+		} else {
+			record = []interface{}{"DELETE FROM " + migrateTableName + " WHERE version = ?", item.Version}
+		}
+		logStep(record[0].(string))
+		_, err := sess.Exec(record...)
+		if err != nil {
+			panic(err)
+		}
+	})
+	return nil
+}
+
+// step小于等于0时执行所有未执行的迁移，返回本次执行的迁移
+func (this *migrateImplement) Up(dbName string, step int) ([]MigrateStatus, error) {
+	db, err := this.getDatabase(dbName)
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := this.lock(db, dbName)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	items, err := this.getMigrations(dbName)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := this.getApplied(db)
+	if err != nil {
+		return nil, err
+	}
+	result := []MigrateStatus{}
+	for _, item := range items {
+		if _, isApplied := applied[item.Version]; isApplied {
+			continue
+		}
+		if step > 0 && len(result) >= step {
+			break
+		}
+		err := this.runMigration(db, dbName, item, true)
+		if err != nil {
+			return result, err
+		}
+		result = append(result, this.getStatus(dbName, item, map[string]string{item.Version: time.Now().Format("2006-01-02 15:04:05")}))
+	}
+	return result, nil
+}
+
+// 从最新的迁移开始回滚step个，step小于等于0时为1个
+func (this *migrateImplement) Down(dbName string, step int) ([]MigrateStatus, error) {
+	if step <= 0 {
+		step = 1
+	}
+	db, err := this.getDatabase(dbName)
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := this.lock(db, dbName)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	items, err := this.getMigrations(dbName)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := this.getApplied(db)
+	if err != nil {
+		return nil, err
+	}
+	result := []MigrateStatus{}
+	for i := len(items) - 1; i >= 0 && len(result) < step; i-- {
+		item := items[i]
+		if _, isApplied := applied[item.Version]; isApplied == false {
+			continue
+		}
+		if (item.source == "sql" && item.downSql == "") || (item.source == "go" && item.Down == nil) {
+			return result, errors.New("migration " + item.Version + "_" + item.Name + " can not down")
+		}
+		err := this.runMigration(db, dbName, item, false)
+		if err != nil {
+			return result, err
+		}
+		result = append(result, this.getStatus(dbName, item, nil))
+	}
+	return result, nil
+}
+
+func (this *migrateImplement) Status(dbName string) ([]MigrateStatus, error) {
+	db, err := this.getDatabase(dbName)
+	if err != nil {
+		return nil, err
+	}
+	items, err := this.getMigrations(dbName)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := this.getApplied(db)
+	if err != nil {
+		return nil, err
+	}
+	result := []MigrateStatus{}
+	for _, item := range items {
+		result = append(result, this.getStatus(dbName, item, applied))
+	}
+	return result, nil
+}
+
+// 生成一对空的up与down的sql文件，返回文件路径
+func (this *migrateImplement) New(dbName string, name string) ([]string, error) {
+	if migrateNameReg.MatchString(name) == false {
+		return nil, errors.New("invalid migration name " + name)
+	}
+	dir := this.config.Path + "/" + dbName
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+	version := time.Now().Format("20060102150405")
+	result := []string{}
+	for _, direction := range []string{"up", "down"} {
+		file := dir + "/" + version + "_" + name + "." + direction + ".sql"
+		data := fmt.Sprintf("-- %s %s %s\n", version, name, direction)
+		err := ioutil.WriteFile(file, []byte(data), 0644)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, file)
+	}
+	return result, nil
+}
+
+// 检查所有已配置的数据库是否有未执行的迁移
+func (this *migrateImplement) CheckPending() error {
+	databases := globalBasic.getDatabases()
+	names := []string{}
+	for name := range databases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		items, err := this.getMigrations(name)
+		if err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			continue
+		}
+		applied, err := this.getApplied(databases[name])
+		if err != nil {
+			return err
+		}
+		pending := []string{}
+		for _, item := range items {
+			if _, isApplied := applied[item.Version]; isApplied == false {
+				pending = append(pending, item.Version+"_"+item.Name)
+			}
+		}
+		if len(pending) != 0 {
+			return errors.New("database " + name + " has pending migrations " + Implode(pending, ","))
+		}
+	}
+	return nil
+}
+
+// 命令行入口，应用以migrate为第一个参数启动时执行，如./mes3 migrate up --db db --step 1
+func runMigrateCommand(argv []string) error {
+	if globalMigrate == nil {
+		return errors.New("migrate is not init")
+	}
+	if len(argv) == 0 {
+		return errors.New("lack of migrate command, support up, down, status, new")
+	}
+	command := argv[0]
+	dbName := "db"
+	step := 0
+	name := ""
+	for i := 1; i < len(argv); i++ {
+		if argv[i] == "--db" && i+1 < len(argv) {
+			dbName = argv[i+1]
+			i++
+		} else if argv[i] == "--step" && i+1 < len(argv) {
+			var err error
+			step, err = strconv.Atoi(argv[i+1])
+			if err != nil {
+				return errors.New("invalid migrate step " + argv[i+1])
+			}
+			i++
+		} else {
+			name = argv[i]
+		}
+	}
+
+	var result []MigrateStatus
+	var err error
+	switch command {
+	case "up":
+		result, err = globalMigrate.Up(dbName, step)
+	case "down":
+		result, err = globalMigrate.Down(dbName, step)
+	case "status":
+		result, err = globalMigrate.Status(dbName)
+	case "new":
+		var files []string
+		files, err = globalMigrate.New(dbName, name)
+		for _, file := range files {
+			fmt.Println("create " + file)
+		}
+		return err
+	default:
+		return errors.New("invalid migrate command " + command)
+	}
+	for _, single := range result {
+		status := "pending"
+		if single.IsApplied {
+			status = "applied " + single.AppliedTime
+		}
+		if command == "down" {
+			status = "reverted"
+		}
+		fmt.Printf("%s\t%s_%s\t%s\t%s\n", single.Database, single.Version, single.Name, single.Source, status)
+	}
+	return err
+}
+
+// 启动时检查，只在prod下开启了check时拒绝启动
+// Go迁移在应用的init中注册，所以放在Run中而不是Basic的init中检查
+func checkMigrateOnStart() error {
+	migrate, ok := globalMigrate.(*migrateImplement)
+	if ok == false || migrate.config.Check == false ||
+		globalBasic.Config.GetRunMode() != "prod" {
+		return nil
+	}
+	return migrate.CheckPending()
+}
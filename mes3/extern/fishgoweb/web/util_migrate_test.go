@@ -0,0 +1,113 @@
+package web
+
+import (
+	"github.com/milkbobo/fishgoweb/assert"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMigrateSplitSql(t *testing.T) {
+	testCase := []struct {
+		data   string
+		result []string
+	}{
+		{"", []string{}},
+		{"-- comment\nDROP TABLE t_a;", []string{"DROP TABLE t_a"}},
+		{"CREATE TABLE t_a (\n  a int\n);\n\n-- next\nINSERT INTO t_a VALUES (1);\nDROP TABLE t_b", []string{
+			"CREATE TABLE t_a (\na int\n)",
+			"INSERT INTO t_a VALUES (1)",
+			"DROP TABLE t_b",
+		}},
+	}
+	for singleIndex, singleTestCase := range testCase {
+		assert.AssertEqual(t, splitMigrateSql(singleTestCase.data), singleTestCase.result, singleIndex)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate_test")
+	assert.AssertEqual(t, err, nil)
+	defer os.RemoveAll(dir)
+	oldMigrations := migrations
+	oldDBs := globalBasic.DBs
+	defer func() {
+		migrations = oldMigrations
+		globalBasic.DBs = oldDBs
+	}()
+	migrations = map[string][]AppMigration{}
+	db := newDbTestDatabase(t)
+	defer db.Close()
+	globalBasic.DBs = map[string]Database{"migratetest": db}
+	migrate, err := NewMigrate(MigrateConfig{Path: dir})
+	assert.AssertEqual(t, err, nil)
+
+	//New生成一对sql文件
+	files, err := migrate.New("migratetest", "create user")
+	assert.AssertEqual(t, err.Error(), "invalid migration name create user")
+	files, err = migrate.New("migratetest", "create_user")
+	assert.AssertEqual(t, err, nil)
+	assert.AssertEqual(t, len(files), 2)
+	assert.AssertEqual(t, strings.HasSuffix(files[0], "_create_user.up.sql"), true)
+	assert.AssertEqual(t, strings.HasSuffix(files[1], "_create_user.down.sql"), true)
+	for _, file := range files {
+		os.Remove(file)
+	}
+
+	//sql与Go迁移按版本合并
+	ioutil.WriteFile(dir+"/migratetest/20200101000000_create_a.up.sql", []byte("CREATE TABLE t_a (a int);\nINSERT INTO t_a VALUES (1);"), 0644)
+	ioutil.WriteFile(dir+"/migratetest/20200101000000_create_a.down.sql", []byte("DROP TABLE t_a;"), 0644)
+	ioutil.WriteFile(dir+"/migratetest/20200103000000_create_c.up.sql", []byte("CREATE TABLE t_c (c int);"), 0644)
+	ioutil.WriteFile(dir+"/migratetest/readme.md", []byte("readme"), 0644)
+	AddMigration("migratetest", AppMigration{
+		Version: "20200102000000",
+		Name:    "init_b",
+		Up: func(sess DatabaseSession) {
+			sess.Exec("UPDATE t_a SET a = 2")
+		},
+	})
+	status, err := migrate.Status("migratetest")
+	assert.AssertEqual(t, err, nil)
+	assert.AssertEqual(t, status, []MigrateStatus{
+		{Database: "migratetest", Version: "20200101000000", Name: "create_a", Source: "sql"},
+		{Database: "migratetest", Version: "20200102000000", Name: "init_b", Source: "go"},
+		{Database: "migratetest", Version: "20200103000000", Name: "create_c", Source: "sql"},
+	})
+	dbTest.getTrace()
+
+	//每个迁移一个事务，并记录到迁移表
+	status, err = migrate.Up("migratetest", 2)
+	assert.AssertEqual(t, err, nil)
+	assert.AssertEqual(t, len(status), 2)
+	assert.AssertEqual(t, status[1].Name, "init_b")
+	assert.AssertEqual(t, status[1].IsApplied, true)
+	trace := dbTest.getTrace()
+	assert.AssertEqual(t, trace[0], "SELECT GET_LOCK(?, ?)")
+	assert.AssertEqual(t, strings.HasPrefix(trace[1], "CREATE TABLE IF NOT EXISTS t_migration"), true)
+	assert.AssertEqual(t, trace[2:], []string{
+		"SELECT version, createTime FROM t_migration",
+		"BEGIN",
+		"CREATE TABLE t_a (a int)",
+		"INSERT INTO t_a VALUES (1)",
+		"INSERT INTO t_migration (version, name, createTime) VALUES (?, ?, ?)",
+		"COMMIT",
+		"BEGIN",
+		"UPDATE t_a SET a = 2",
+		"INSERT INTO t_migration (version, name, createTime) VALUES (?, ?, ?)",
+		"COMMIT",
+		"SELECT RELEASE_LOCK(?)",
+	})
+
+	//版本重复与缺少up时报错
+	AddMigration("migratetest", AppMigration{Version: "20200103000000", Name: "create_c"})
+	_, err = migrate.Status("migratetest")
+	assert.AssertEqual(t, err.Error(), "duplicate migration version 20200103000000")
+	migrations = map[string][]AppMigration{}
+	os.Remove(dir + "/migratetest/20200103000000_create_c.up.sql")
+	ioutil.WriteFile(dir+"/migratetest/20200103000000_create_c.down.sql", []byte("DROP TABLE t_c;"), 0644)
+	_, err = migrate.Status("migratetest")
+	assert.AssertEqual(t, err.Error(), "migration 20200103000000_create_c lack of up sql")
+	_, err = migrate.Up("unknown", 0)
+	assert.AssertEqual(t, err.Error(), "unknown database unknown")
+}
@@ -36,7 +36,8 @@ func NewMongoDatabase(config MongoDbDatabaseConfig) (*mongo.Database, error) {
 		return nil, err
 	}
 
-	ctx, _ := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
 	err = client.Connect(ctx)
 	if err != nil {
@@ -74,3 +75,25 @@ func NewMongoDatabaseFromConfig(configName string) (*mongo.Database, error) {
 
 	return NewMongoDatabase(config)
 }
+
+// 按[xxx.mdb.name]创建所有的具名连接
+func NewMongoDatabasesFromConfig() (map[string]*mongo.Database, error) {
+	result := map[string]*mongo.Database{}
+	for name, single := range globalBasic.Config.Get().MDBs {
+		db, err := NewMongoDatabase(MongoDbDatabaseConfig{
+			Host:     single.Host,
+			Port:     single.Port,
+			User:     single.User,
+			Passowrd: single.Password,
+			Database: single.Database,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if db == nil {
+			continue
+		}
+		result[name] = db
+	}
+	return result, nil
+}
@@ -2,12 +2,22 @@ package web
 
 import (
 	"errors"
+	. "github.com/milkbobo/fishgoweb/language"
 	. "github.com/milkbobo/fishgoweb/sdk"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
 )
 
+// Counter，Gauge与Histogram的name与labelNames遵循Prometheus的命名规则，同名的指标重复注册时返回同一个指标
 type Monitor interface {
 	AscErrorCount()
 	AscCriticalCount()
+	Counter(name string, help string, labelNames ...string) MonitorCounter
+	Gauge(name string, help string, labelNames ...string) MonitorGauge
+	Histogram(name string, help string, buckets []float64, labelNames ...string) MonitorHistogram
+	AddCollector(collector func())
 }
 
 type MonitorConfig struct {
@@ -15,13 +25,24 @@ type MonitorConfig struct {
 	AppId         string
 	ErrorCount    string
 	CriticalCount string
+	Path          string
+	IpWhite       []string
 }
 
 type monitorImplement struct {
 	AliCloudMonitorSdk
+	*monitorRegistry
 	config MonitorConfig
 }
 
+type prometheusMonitorImplement struct {
+	*monitorRegistry
+	config        MonitorConfig
+	errorCount    MonitorCounter
+	criticalCount MonitorCounter
+	ipWhites      []*net.IPNet
+}
+
 func NewMonitor(config MonitorConfig) (Monitor, error) {
 	if config.Driver == "" {
 		return nil, nil
@@ -30,10 +51,32 @@ func NewMonitor(config MonitorConfig) (Monitor, error) {
 			AliCloudMonitorSdk: AliCloudMonitorSdk{
 				AppId: config.AppId,
 			},
-			config: config,
+			monitorRegistry: newMonitorRegistry(),
+			config:          config,
 		}
 		go result.AliCloudMonitorSdk.Sync()
 		return result, nil
+	} else if config.Driver == "prometheus" {
+		if config.Path == "" {
+			config.Path = "/metrics"
+		}
+		if len(config.IpWhite) == 0 {
+			return nil, errors.New("monitor ipwhite can not be empty")
+		}
+		result := &prometheusMonitorImplement{
+			monitorRegistry: newMonitorRegistry(),
+			config:          config,
+		}
+		for _, single := range config.IpWhite {
+			ipNet, err := parseSecurityIpNet(single)
+			if err != nil {
+				return nil, errors.New("invalid monitor ipwhite " + single)
+			}
+			result.ipWhites = append(result.ipWhites, ipNet)
+		}
+		result.errorCount = result.Counter("log_errors_total", "Number of error logs.")
+		result.criticalCount = result.Counter("log_criticals_total", "Number of critical logs.")
+		return result, nil
 	} else {
 		return nil, errors.New("invalid monitor config " + config.Driver)
 	}
@@ -45,6 +88,8 @@ func NewMonitorFromConfig() (Monitor, error) {
 	monitorConfig.AppId = globalBasic.Config.Get().Monitor.AppId
 	monitorConfig.ErrorCount = globalBasic.Config.Get().Monitor.ErrorCount
 	monitorConfig.CriticalCount = globalBasic.Config.Get().Monitor.CriticalCount
+	monitorConfig.Path = globalBasic.Config.Get().Monitor.Path
+	monitorConfig.IpWhite = Explode(globalBasic.Config.Get().Monitor.IpWhite, ",")
 	return NewMonitor(monitorConfig)
 }
 
@@ -59,3 +104,108 @@ func (this *monitorImplement) AscCriticalCount() {
 		this.Asc(this.config.CriticalCount, 1)
 	}
 }
+
+func (this *prometheusMonitorImplement) AscErrorCount() {
+	this.errorCount.Inc()
+}
+
+func (this *prometheusMonitorImplement) AscCriticalCount() {
+	this.criticalCount.Inc()
+}
+
+// 与调试接口相同，只允许ipwhite中的ip或网段访问
+func (this *prometheusMonitorImplement) isAllowIp(request *http.Request) bool {
+	ip := getRequestClientIp(request, globalTrustedProxies)
+	if ip == nil {
+		return false
+	}
+	return isSecurityIpIn(this.ipWhites, ip)
+}
+
+func (this *prometheusMonitorImplement) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	if this.isAllowIp(request) == false {
+		response.WriteHeader(403)
+		response.Write([]byte("forbidden"))
+		return
+	}
+	response.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	response.WriteHeader(200)
+	response.Write(this.export())
+}
+
+// 配置了prometheus驱动时，由路由在config.Path上输出指标
+func getMonitorHandler(request *http.Request) http.Handler {
+	monitor, ok := globalBasic.Monitor.(*prometheusMonitorImplement)
+	if ok == false || request.URL.Path != monitor.config.Path {
+		return nil
+	}
+	return monitor
+}
+
+// 框架内置的指标，配置了prometheus驱动时在组件初始化之后注册，aliyuncloudmonitor驱动不输出这些指标
+type monitorBasicMetric struct {
+	requestCount    MonitorCounter
+	requestDuration MonitorHistogram
+	requestInFlight MonitorGauge
+	timerCount      MonitorCounter
+	timerDuration   MonitorHistogram
+}
+
+var globalMonitorMetric *monitorBasicMetric
+
+func newMonitorBasicMetric(monitor Monitor) *monitorBasicMetric {
+	if _, ok := monitor.(*prometheusMonitorImplement); ok == false {
+		return nil
+	}
+	result := &monitorBasicMetric{
+		requestCount:    monitor.Counter("http_requests_total", "Number of http requests.", "route", "method", "status"),
+		requestDuration: monitor.Histogram("http_request_duration_seconds", "Latency of http requests.", nil, "route", "method"),
+		requestInFlight: monitor.Gauge("http_requests_in_flight", "Number of http requests in flight."),
+		timerCount:      monitor.Counter("timer_tasks_total", "Number of timer tasks by result.", "task", "result"),
+		timerDuration:   monitor.Histogram("timer_task_duration_seconds", "Latency of timer tasks.", nil, "task"),
+	}
+	dbGauges := map[string]MonitorGauge{
+		"open":         monitor.Gauge("db_connections_open", "Number of established database connections.", "db"),
+		"inUse":        monitor.Gauge("db_connections_in_use", "Number of database connections in use.", "db"),
+		"idle":         monitor.Gauge("db_connections_idle", "Number of idle database connections.", "db"),
+		"maxOpen":      monitor.Gauge("db_connections_max_open", "Maximum number of open database connections.", "db"),
+		"waitCount":    monitor.Gauge("db_wait_count", "Total number of connections waited for.", "db"),
+		"waitDuration": monitor.Gauge("db_wait_duration_seconds", "Total time blocked waiting for a new connection.", "db"),
+	}
+	monitor.AddCollector(func() {
+		for name, db := range globalBasic.getDatabases() {
+			stats := db.GetStats()
+			dbGauges["open"].Set(float64(stats.OpenConnections), name)
+			dbGauges["inUse"].Set(float64(stats.InUse), name)
+			dbGauges["idle"].Set(float64(stats.Idle), name)
+			dbGauges["maxOpen"].Set(float64(stats.MaxOpenConnections), name)
+			dbGauges["waitCount"].Set(float64(stats.WaitCount), name)
+			dbGauges["waitDuration"].Set(stats.WaitDuration.Seconds(), name)
+		}
+	})
+	queueLength := monitor.Gauge("queue_length", "Number of messages waiting in the queue.", "topic")
+	monitor.AddCollector(func() {
+		queue, ok := globalBasic.Queue.(*queueImplement)
+		if ok == false {
+			return
+		}
+		for _, topicId := range queue.getTopics() {
+			length, err := queue.GetLength(topicId)
+			if err != nil {
+				continue
+			}
+			queueLength.Set(float64(length), topicId)
+		}
+	})
+	return result
+}
+
+func (this *monitorBasicMetric) observeRequest(method string, response *statusResponseWriter, duration time.Duration) {
+	this.requestCount.Inc(response.route, method, strconv.Itoa(response.getStatus()))
+	this.requestDuration.Observe(duration.Seconds(), response.route, method)
+}
+
+func (this *monitorBasicMetric) observeTimerTask(task string, result string, duration time.Duration) {
+	this.timerCount.Inc(task, result)
+	this.timerDuration.Observe(duration.Seconds(), task)
+}
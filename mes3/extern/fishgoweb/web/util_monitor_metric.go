@@ -0,0 +1,274 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type MonitorCounter interface {
+	Inc(labelValues ...string)
+	Add(value float64, labelValues ...string)
+}
+
+type MonitorGauge interface {
+	Inc(labelValues ...string)
+	Dec(labelValues ...string)
+	Add(value float64, labelValues ...string)
+	Set(value float64, labelValues ...string)
+}
+
+type MonitorHistogram interface {
+	Observe(value float64, labelValues ...string)
+}
+
+// 默认的直方图分桶，单位为秒
+var MonitorDefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+var monitorMetricNameRegex = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+type monitorMetricValue struct {
+	labelValues  []string
+	value        float64
+	bucketCounts []uint64
+	count        uint64
+}
+
+type monitorMetric struct {
+	name       string
+	help       string
+	metricType string
+	labelNames []string
+	buckets    []float64
+	values     map[string]*monitorMetricValue
+	lock       sync.Mutex
+}
+
+// 所有Monitor驱动共用的指标容器，同名的指标只注册一次
+type monitorRegistry struct {
+	metrics    map[string]*monitorMetric
+	collectors []func()
+	lock       sync.Mutex
+}
+
+func newMonitorRegistry() *monitorRegistry {
+	return &monitorRegistry{
+		metrics: map[string]*monitorMetric{},
+	}
+}
+
+func (this *monitorRegistry) getMetric(metricType string, name string, help string, buckets []float64, labelNames []string) *monitorMetric {
+	if monitorMetricNameRegex.MatchString(name) == false {
+		panic("invalid metric name " + name)
+	}
+	for _, single := range labelNames {
+		if monitorMetricNameRegex.MatchString(single) == false || single == "le" {
+			panic("invalid metric label name " + single)
+		}
+	}
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if result, isExist := this.metrics[name]; isExist {
+		if result.metricType != metricType || len(result.labelNames) != len(labelNames) {
+			panic(fmt.Sprintf("metric %s is registered as %s with labels %v", name, result.metricType, result.labelNames))
+		}
+		return result
+	}
+	if metricType == "histogram" {
+		if len(buckets) == 0 {
+			buckets = MonitorDefaultBuckets
+		}
+		buckets = append([]float64{}, buckets...)
+		sort.Float64s(buckets)
+	}
+	result := &monitorMetric{
+		name:       name,
+		help:       help,
+		metricType: metricType,
+		labelNames: labelNames,
+		buckets:    buckets,
+		values:     map[string]*monitorMetricValue{},
+	}
+	this.metrics[name] = result
+	return result
+}
+
+func (this *monitorRegistry) Counter(name string, help string, labelNames ...string) MonitorCounter {
+	return &monitorCounter{this.getMetric("counter", name, help, nil, labelNames)}
+}
+
+func (this *monitorRegistry) Gauge(name string, help string, labelNames ...string) MonitorGauge {
+	return &monitorGauge{this.getMetric("gauge", name, help, nil, labelNames)}
+}
+
+func (this *monitorRegistry) Histogram(name string, help string, buckets []float64, labelNames ...string) MonitorHistogram {
+	return &monitorHistogram{this.getMetric("histogram", name, help, buckets, labelNames)}
+}
+
+// collector在每次导出指标前执行，用于把连接池这类外部状态同步到Gauge
+func (this *monitorRegistry) AddCollector(collector func()) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.collectors = append(this.collectors, collector)
+}
+
+func (this *monitorMetric) getValue(labelValues []string) *monitorMetricValue {
+	if len(labelValues) != len(this.labelNames) {
+		panic(fmt.Sprintf("metric %s expect %d label values but get %d", this.name, len(this.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	result, isExist := this.values[key]
+	if isExist == false {
+		result = &monitorMetricValue{
+			labelValues: append([]string{}, labelValues...),
+		}
+		if this.metricType == "histogram" {
+			result.bucketCounts = make([]uint64, len(this.buckets))
+		}
+		this.values[key] = result
+	}
+	return result
+}
+
+type monitorCounter struct {
+	metric *monitorMetric
+}
+
+func (this *monitorCounter) Inc(labelValues ...string) {
+	this.Add(1, labelValues...)
+}
+
+func (this *monitorCounter) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		panic("counter " + this.metric.name + " can not decrease")
+	}
+	this.metric.lock.Lock()
+	defer this.metric.lock.Unlock()
+	this.metric.getValue(labelValues).value += value
+}
+
+type monitorGauge struct {
+	metric *monitorMetric
+}
+
+func (this *monitorGauge) Inc(labelValues ...string) {
+	this.Add(1, labelValues...)
+}
+
+func (this *monitorGauge) Dec(labelValues ...string) {
+	this.Add(-1, labelValues...)
+}
+
+func (this *monitorGauge) Add(value float64, labelValues ...string) {
+	this.metric.lock.Lock()
+	defer this.metric.lock.Unlock()
+	this.metric.getValue(labelValues).value += value
+}
+
+func (this *monitorGauge) Set(value float64, labelValues ...string) {
+	this.metric.lock.Lock()
+	defer this.metric.lock.Unlock()
+	this.metric.getValue(labelValues).value = value
+}
+
+type monitorHistogram struct {
+	metric *monitorMetric
+}
+
+func (this *monitorHistogram) Observe(value float64, labelValues ...string) {
+	this.metric.lock.Lock()
+	defer this.metric.lock.Unlock()
+	single := this.metric.getValue(labelValues)
+	for i, bucket := range this.metric.buckets {
+		if value <= bucket {
+			single.bucketCounts[i]++
+		}
+	}
+	single.value += value
+	single.count++
+}
+
+func formatMonitorFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	} else if math.IsInf(value, -1) {
+		return "-Inf"
+	} else if math.IsNaN(value) {
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func formatMonitorLabels(names []string, values []string, extraName string, extraValue string) string {
+	if extraName != "" {
+		names = append(append([]string{}, names...), extraName)
+		values = append(append([]string{}, values...), extraValue)
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	result := []string{}
+	for i, name := range names {
+		result = append(result, name+`="`+replacer.Replace(values[i])+`"`)
+	}
+	return "{" + strings.Join(result, ",") + "}"
+}
+
+func (this *monitorMetric) export(buffer *bytes.Buffer) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	help := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(this.help)
+	buffer.WriteString("# HELP " + this.name + " " + help + "\n")
+	buffer.WriteString("# TYPE " + this.name + " " + this.metricType + "\n")
+	keys := []string{}
+	for key := range this.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		single := this.values[key]
+		if this.metricType != "histogram" {
+			buffer.WriteString(this.name + formatMonitorLabels(this.labelNames, single.labelValues, "", "") + " " + formatMonitorFloat(single.value) + "\n")
+			continue
+		}
+		for i, bucket := range this.buckets {
+			buffer.WriteString(this.name + "_bucket" + formatMonitorLabels(this.labelNames, single.labelValues, "le", formatMonitorFloat(bucket)) + " " + strconv.FormatUint(single.bucketCounts[i], 10) + "\n")
+		}
+		buffer.WriteString(this.name + "_bucket" + formatMonitorLabels(this.labelNames, single.labelValues, "le", "+Inf") + " " + strconv.FormatUint(single.count, 10) + "\n")
+		buffer.WriteString(this.name + "_sum" + formatMonitorLabels(this.labelNames, single.labelValues, "", "") + " " + formatMonitorFloat(single.value) + "\n")
+		buffer.WriteString(this.name + "_count" + formatMonitorLabels(this.labelNames, single.labelValues, "", "") + " " + strconv.FormatUint(single.count, 10) + "\n")
+	}
+}
+
+// 以Prometheus的文本格式导出所有指标
+func (this *monitorRegistry) export() []byte {
+	this.lock.Lock()
+	collectors := append([]func(){}, this.collectors...)
+	this.lock.Unlock()
+	for _, collector := range collectors {
+		collector()
+	}
+
+	this.lock.Lock()
+	names := []string{}
+	for name := range this.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	metrics := []*monitorMetric{}
+	for _, name := range names {
+		metrics = append(metrics, this.metrics[name])
+	}
+	this.lock.Unlock()
+	buffer := bytes.NewBuffer(nil)
+	for _, metric := range metrics {
+		metric.export(buffer)
+	}
+	return buffer.Bytes()
+}
@@ -0,0 +1,165 @@
+package web
+
+import (
+	"github.com/milkbobo/fishgoweb/assert"
+	"github.com/milkbobo/fishgoweb/language"
+	"github.com/milkbobo/fishgoweb/util"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type monitorTestController struct {
+	Controller
+}
+
+func (this *monitorTestController) Get_Json() interface{} {
+	return nil
+}
+
+func (this *monitorTestController) AutoRender(data interface{}, viewName string) {
+	this.Ctx.Write([]byte("ok"))
+}
+
+func TestMonitorRegistry(t *testing.T) {
+	monitor, err := NewMonitor(MonitorConfig{Driver: "prometheus", IpWhite: []string{"127.0.0.1"}})
+	assert.AssertEqual(t, err, nil)
+	counter := monitor.Counter("order_total", "Number of orders.", "type")
+	counter.Inc("pay")
+	counter.Add(2, "pay")
+	monitor.Counter("order_total", "Number of orders.", "type").Inc("refund")
+	gauge := monitor.Gauge("order_pending", "Pending \"orders\"\nnow.")
+	gauge.Set(5)
+	gauge.Dec()
+	histogram := monitor.Histogram("order_seconds", "Latency.", []float64{1, 0.1}, "type")
+	histogram.Observe(0.05, `a"b`)
+	histogram.Observe(0.5, `a"b`)
+	monitor.AscErrorCount()
+
+	data := string(monitor.(*prometheusMonitorImplement).export())
+	assert.AssertEqual(t, data, strings.Join([]string{
+		"# HELP log_criticals_total Number of critical logs.",
+		"# TYPE log_criticals_total counter",
+		"# HELP log_errors_total Number of error logs.",
+		"# TYPE log_errors_total counter",
+		"log_errors_total 1",
+		"# HELP order_pending Pending \"orders\"\\nnow.",
+		"# TYPE order_pending gauge",
+		"order_pending 4",
+		"# HELP order_seconds Latency.",
+		"# TYPE order_seconds histogram",
+		`order_seconds_bucket{type="a\"b",le="0.1"} 1`,
+		`order_seconds_bucket{type="a\"b",le="1"} 2`,
+		`order_seconds_bucket{type="a\"b",le="+Inf"} 2`,
+		`order_seconds_sum{type="a\"b"} 0.55`,
+		`order_seconds_count{type="a\"b"} 2`,
+		"# HELP order_total Number of orders.",
+		"# TYPE order_total counter",
+		`order_total{type="pay"} 3`,
+		`order_total{type="refund"} 1`,
+		"",
+	}, "\n"))
+
+	assert.AssertError(t, "metric order_total is registered as counter with labels [type]", func() {
+		monitor.Gauge("order_total", "Number of orders.", "type")
+	})
+	assert.AssertError(t, "invalid metric name order-total", func() {
+		monitor.Counter("order-total", "Number of orders.")
+	})
+	assert.AssertError(t, "metric order_total expect 1 label values but get 0", func() {
+		counter.Inc()
+	})
+}
+
+func TestMonitorPrometheus(t *testing.T) {
+	_, err := NewMonitor(MonitorConfig{Driver: "prometheus"})
+	assert.AssertEqual(t, err.Error(), "monitor ipwhite can not be empty")
+	_, err = NewMonitor(MonitorConfig{Driver: "prometheus", IpWhite: []string{"abc"}})
+	assert.AssertEqual(t, err.Error(), "invalid monitor ipwhite abc")
+	monitor, err := NewMonitor(MonitorConfig{Driver: "prometheus", IpWhite: []string{"127.0.0.1"}})
+	assert.AssertEqual(t, err, nil)
+	oldMonitor := globalBasic.Monitor
+	oldMonitorMetric := globalMonitorMetric
+	oldRouteTree := handler.routeTree
+	defer func() {
+		globalBasic.Monitor = oldMonitor
+		globalMonitorMetric = oldMonitorMetric
+		handler.routeTree = oldRouteTree
+	}()
+	globalBasic.Monitor = monitor
+	globalMonitorMetric = newMonitorBasicMetric(monitor)
+	handler.routeTree = nil
+	handler.addRoute("/monitor", &monitorTestController{}, 0)
+	server := httptest.NewServer(http.HandlerFunc(handler.innerServeHTTP))
+	defer server.Close()
+
+	for _, url := range []string{"/monitor/get", "/monitor/get", "/monitor/notFound"} {
+		response, err := http.Get(server.URL + url)
+		assert.AssertEqual(t, err, nil)
+		response.Body.Close()
+	}
+	timer := &timerImplement{log: globalBasic.Log, closeFunc: util.NewCloseFunc()}
+	timer.startSingleTask("expire", func() {})
+	timer.startSingleTask("expire", func() {
+		language.Throw(1, "fail")
+	})
+
+	response, err := http.Get(server.URL + "/metrics")
+	assert.AssertEqual(t, err, nil)
+	body, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	assert.AssertEqual(t, response.Header.Get("Content-Type"), "text/plain; version=0.0.4; charset=utf-8")
+	data := string(body)
+	for _, line := range []string{
+		`http_requests_total{route="/monitor/get",method="GET",status="200"} 2`,
+		`http_requests_total{route="",method="GET",status="404"} 1`,
+		`http_request_duration_seconds_count{route="/monitor/get",method="GET"} 2`,
+		`http_requests_in_flight 0`,
+		`timer_tasks_total{task="expire",result="success"} 1`,
+		`timer_tasks_total{task="expire",result="error"} 1`,
+	} {
+		assert.AssertEqual(t, strings.Contains(data, line+"\n"), true, line)
+	}
+
+	//不在ipwhite中的ip，以及非可信代理伪造的X-Forwarded-For都无法访问
+	for _, singleTestCase := range []struct {
+		ipWhite []string
+		forward string
+		status  int
+	}{
+		{[]string{"127.0.0.1"}, "", 200},
+		{[]string{"10.0.0.0/8"}, "", 403},
+		{[]string{"10.0.0.0/8"}, "10.0.0.1", 403},
+	} {
+		monitor.(*prometheusMonitorImplement).ipWhites = nil
+		for _, single := range singleTestCase.ipWhite {
+			ipNet, _ := parseSecurityIpNet(single)
+			monitor.(*prometheusMonitorImplement).ipWhites = append(monitor.(*prometheusMonitorImplement).ipWhites, ipNet)
+		}
+		request, _ := http.NewRequest("GET", server.URL+"/metrics", nil)
+		if singleTestCase.forward != "" {
+			request.Header.Set("X-Forwarded-For", singleTestCase.forward)
+		}
+		response, err := http.DefaultClient.Do(request)
+		assert.AssertEqual(t, err, nil)
+		response.Body.Close()
+		assert.AssertEqual(t, response.StatusCode, singleTestCase.status, singleTestCase)
+	}
+}
+
+func TestMonitorAliyun(t *testing.T) {
+	//aliyuncloudmonitor驱动不输出框架内置的指标，不需要ipwhite
+	monitor := &monitorImplement{
+		monitorRegistry: newMonitorRegistry(),
+	}
+	assert.AssertEqual(t, newMonitorBasicMetric(monitor) == nil, true)
+	request := httptest.NewRequest("GET", "/metrics", nil)
+	oldMonitor := globalBasic.Monitor
+	defer func() {
+		globalBasic.Monitor = oldMonitor
+	}()
+	globalBasic.Monitor = monitor
+	assert.AssertEqual(t, getMonitorHandler(request), nil)
+}
@@ -8,6 +8,8 @@ import (
 	. "github.com/milkbobo/fishgoweb/util"
 	. "github.com/milkbobo/fishgoweb/web/util_queue"
 	"reflect"
+	"sort"
+	"sync"
 )
 
 type Queue interface {
@@ -18,6 +20,7 @@ type Queue interface {
 	Publish(topicId string, data ...interface{})
 	Subscribe(topicId string, listener interface{})
 	SubscribeInPool(topicId string, listener interface{}, poolSize int)
+	GetLength(topicId string) (int64, error)
 	Close()
 }
 
@@ -36,6 +39,7 @@ type queueImplement struct {
 	poolSize  int
 	debug     bool
 	closeFunc *CloseFunc
+	topics    *sync.Map
 }
 
 func NewQueue(config QueueConfig) (Queue, error) {
@@ -52,6 +56,7 @@ func NewQueue(config QueueConfig) (Queue, error) {
 			poolSize:  config.PoolSize,
 			debug:     config.Debug,
 			closeFunc: closeFunc,
+			topics:    &sync.Map{},
 		}, nil
 	} else if config.Driver == "redis" {
 		closeFunc := NewCloseFunc()
@@ -67,6 +72,7 @@ func NewQueue(config QueueConfig) (Queue, error) {
 			poolSize:  config.PoolSize,
 			debug:     config.Debug,
 			closeFunc: closeFunc,
+			topics:    &sync.Map{},
 		}, nil
 	} else {
 		return nil, errors.New("invalid memory config " + config.Driver)
@@ -90,6 +96,39 @@ func (this *queueImplement) WithLogAndContext(log Log, ctx Context) Queue {
 	return &newQueueManager
 }
 
+// 记录消费与订阅的topic，用于监控队列长度
+func (this *queueImplement) addTopic(topicId string) {
+	this.topics.Store(topicId, true)
+}
+
+func (this *queueImplement) getTopics() []string {
+	result := []string{}
+	this.topics.Range(func(key interface{}, value interface{}) bool {
+		result = append(result, key.(string))
+		return true
+	})
+	sort.Strings(result)
+	return result
+}
+
+// 等待消费的消息数量，memory驱动直接执行消费者，不支持获取长度
+func (this *queueImplement) GetLength(topicId string) (int64, error) {
+	store, ok := this.store.(QueueStoreLengthInterface)
+	if ok == false {
+		return 0, errors.New("queue store does not support length")
+	}
+	return store.Len(topicId)
+}
+
+// memory驱动不需要检查连通性
+func (this *queueImplement) ping() error {
+	store, ok := this.store.(QueueStorePingInterface)
+	if ok == false {
+		return nil
+	}
+	return store.Ping()
+}
+
 func (this *queueImplement) EncodeData(data []interface{}) ([]byte, error) {
 	ctxRequest, err := this.Ctx.SerializeRequest()
 	if err != nil {
@@ -244,6 +283,7 @@ func (this *queueImplement) Consume(topicId string, listener interface{}) {
 	defer CatchCrash(func(exception Exception) {
 		this.Log.Critical("QueueTask Crash Code:[%d] Message:[%s]\nStackTrace:[%s]", exception.GetCode(), exception.GetMessage(), exception.GetStackTrace())
 	})
+	this.addTopic(topicId)
 	listenerResult, err := this.WrapExceptionListener(listener, topicId, "Consume")
 	if err != nil {
 		panic(err)
@@ -262,6 +302,7 @@ func (this *queueImplement) ConsumeInPool(topicId string, listener interface{},
 	defer CatchCrash(func(exception Exception) {
 		this.Log.Critical("QueueTask Crash Code:[%d] Message:[%s]\nStackTrace:[%s]", exception.GetCode(), exception.GetMessage(), exception.GetStackTrace())
 	})
+	this.addTopic(topicId)
 	listenerResult, err := this.WrapExceptionListener(listener, topicId, "ConsumeInPool")
 	if err != nil {
 		panic(err)
@@ -296,6 +337,7 @@ func (this *queueImplement) Subscribe(topicId string, listener interface{}) {
 	defer CatchCrash(func(exception Exception) {
 		this.Log.Critical("QueueTask Crash Code:[%d] Message:[%s]\nStackTrace:[%s]", exception.GetCode(), exception.GetMessage(), exception.GetStackTrace())
 	})
+	this.addTopic(topicId)
 	listenerResult, err := this.WrapExceptionListener(listener, topicId, "Subscribe")
 	if err != nil {
 		panic(err)
@@ -314,6 +356,7 @@ func (this *queueImplement) SubscribeInPool(topicId string, listener interface{}
 	defer CatchCrash(func(exception Exception) {
 		this.Log.Critical("QueueTask Crash Code:[%d] Message:[%s]\nStackTrace:[%s]", exception.GetCode(), exception.GetMessage(), exception.GetStackTrace())
 	})
+	this.addTopic(topicId)
 	listenerResult, err := this.WrapExceptionListener(listener, topicId, "SubscribeInPool")
 	if err != nil {
 		panic(err)
@@ -33,6 +33,22 @@ func (this *BasicQueueStore) Publish(topicId string, data interface{}) error {
 	return this.Produce(topicId, data)
 }
 
+func (this *BasicQueueStore) Len(topicId string) (int64, error) {
+	store, ok := this.QueueStoreBasicInterface.(QueueStoreLengthInterface)
+	if !ok {
+		return 0, errors.New("queue store does not support length")
+	}
+	return store.Len(topicId)
+}
+
+func (this *BasicQueueStore) Ping() error {
+	store, ok := this.QueueStoreBasicInterface.(QueueStorePingInterface)
+	if !ok {
+		return nil
+	}
+	return store.Ping()
+}
+
 func (this *BasicQueueStore) subscribeInner(topicId string, single *BasicAsyncQueuePubSubStore) error {
 	return this.Consume(topicId, func(argv interface{}) error {
 		var lastError error
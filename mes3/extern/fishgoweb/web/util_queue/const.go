@@ -15,6 +15,14 @@ type QueueStoreInterface interface {
 	Subscribe(topicId string, listener QueueListener) error
 }
 
+type QueueStoreLengthInterface interface {
+	Len(topicId string) (int64, error)
+}
+
+type QueueStorePingInterface interface {
+	Ping() error
+}
+
 type QueueStoreBasicInterface interface {
 	Produce(topicId string, data interface{}) error
 	Consume(topicId string, listener QueueListener) error
@@ -1,8 +1,8 @@
 package util_queue
 
 import (
-	. "github.com/milkbobo/fishgoweb/util"
 	"github.com/garyburd/redigo/redis"
+	. "github.com/milkbobo/fishgoweb/util"
 	"strconv"
 	"strings"
 	"time"
@@ -15,7 +15,8 @@ type RedisQueueStore struct {
 
 var MAX_POOL_SIZE = 100
 
-func newRedisPool(configSavePath string) (*redis.Pool, error) {
+// configSavePath的格式为地址,连接池大小,密码,数据库，如127.0.0.1:6379,100,password,0
+func NewRedisPool(configSavePath string) (*redis.Pool, error) {
 	var savePath string
 	var poolsize int
 	var password string
@@ -82,8 +83,24 @@ func newRedisPool(configSavePath string) (*redis.Pool, error) {
 	}
 	return poollist, poollist.Get().Err()
 }
+
+// 使用与队列相同的配置格式检查redis的连通性，用完即关闭连接池
+func PingRedis(configSavePath string) error {
+	redisPool, err := NewRedisPool(configSavePath)
+	if err != nil {
+		return err
+	}
+	defer redisPool.Close()
+
+	c := redisPool.Get()
+	defer c.Close()
+
+	_, err = c.Do("PING")
+	return err
+}
+
 func NewRedisQueue(closeFunc *CloseFunc, config QueueStoreConfig) (QueueStoreInterface, error) {
-	redisPool, err := newRedisPool(config.SavePath)
+	redisPool, err := NewRedisPool(config.SavePath)
 	if err != nil {
 		return nil, err
 	}
@@ -108,6 +125,21 @@ func (this *RedisQueueStore) Produce(topicId string, data interface{}) error {
 	return nil
 }
 
+func (this *RedisQueueStore) Ping() error {
+	c := this.redisPool.Get()
+	defer c.Close()
+
+	_, err := c.Do("PING")
+	return err
+}
+
+func (this *RedisQueueStore) Len(topicId string) (int64, error) {
+	c := this.redisPool.Get()
+	defer c.Close()
+
+	return redis.Int64(c.Do("LLEN", this.prefix+topicId))
+}
+
 func (this *RedisQueueStore) consumeData(topicId string, timeout int) (interface{}, error) {
 	var topic interface{}
 	var data interface{}
@@ -0,0 +1,382 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	. "github.com/milkbobo/fishgoweb/language"
+	"github.com/milkbobo/fishgoweb/web/util_queue"
+)
+
+type RateLimiter interface {
+	WithLog(log Log) RateLimiter
+	Allow(key string) (bool, time.Duration)
+	AllowN(key string, n int) (bool, time.Duration)
+	Check(key string)
+	Close()
+}
+
+type RateLimiterConfig struct {
+	Driver     string
+	Algorithm  string
+	Limit      int
+	Window     time.Duration
+	SavePath   string
+	SavePrefix string
+}
+
+type rateLimitStore interface {
+	take(key string, n int, now time.Time) (time.Duration, error)
+	close()
+}
+
+type rateLimiterImplement struct {
+	store rateLimitStore
+	log   Log
+	now   func() time.Time
+}
+
+// 令牌桶的容量为limit，每window补充limit个令牌，滑动窗口在任意window内最多通过limit次
+func NewRateLimiter(config RateLimiterConfig) (RateLimiter, error) {
+	if config.Driver == "" {
+		return nil, nil
+	}
+	if config.Algorithm == "" {
+		config.Algorithm = "tokenbucket"
+	}
+	if config.Algorithm != "tokenbucket" && config.Algorithm != "slidingwindow" {
+		return nil, errors.New("invalid ratelimit algorithm " + config.Algorithm)
+	}
+	if config.Limit <= 0 {
+		return nil, errors.New("invalid ratelimit limit " + strconv.Itoa(config.Limit))
+	}
+	if config.Window <= 0 {
+		config.Window = time.Second
+	}
+	var store rateLimitStore
+	if config.Driver == "memory" {
+		store = &rateLimitMemoryStore{
+			config: config,
+			items:  map[string]*rateLimitMemoryItem{},
+		}
+	} else if config.Driver == "redis" {
+		redisPool, err := util_queue.NewRedisPool(config.SavePath)
+		if err != nil {
+			return nil, err
+		}
+		store = &rateLimitRedisStore{
+			config:    config,
+			redisPool: redisPool,
+		}
+	} else {
+		return nil, errors.New("invalid ratelimit driver " + config.Driver)
+	}
+	return &rateLimiterImplement{
+		store: store,
+		now:   time.Now,
+	}, nil
+}
+
+func NewRateLimiterFromConfig() (RateLimiter, error) {
+	rateLimiterConfig := RateLimiterConfig{}
+	rateLimiterConfig.Driver = globalBasic.Config.Get().RateLimit.Driver
+	rateLimiterConfig.Algorithm = globalBasic.Config.Get().RateLimit.Algorithm
+	rateLimiterConfig.Limit = globalBasic.Config.Get().RateLimit.Limit
+	rateLimiterConfig.Window = time.Duration(globalBasic.Config.Get().RateLimit.Window) * time.Second
+	rateLimiterConfig.SavePath = globalBasic.Config.Get().RateLimit.SavePath
+	rateLimiterConfig.SavePrefix = globalBasic.Config.Get().RateLimit.SavePrefix
+	return NewRateLimiter(rateLimiterConfig)
+}
+
+func (this *rateLimiterImplement) WithLog(log Log) RateLimiter {
+	if this == nil {
+		return nil
+	} else {
+		newRateLimiter := *this
+		newRateLimiter.log = log
+		return &newRateLimiter
+	}
+}
+
+func (this *rateLimiterImplement) Allow(key string) (bool, time.Duration) {
+	return this.AllowN(key, 1)
+}
+
+// 返回是否通过与需要等待的时间，存储出错时放行，避免限流影响正常业务
+func (this *rateLimiterImplement) AllowN(key string, n int) (bool, time.Duration) {
+	retryAfter, err := this.store.take(key, n, this.now())
+	if err != nil {
+		if this.log != nil {
+			this.log.Error("RateLimit Error Key:[%s] Message:[%s]", key, err.Error())
+		}
+		return true, 0
+	}
+	return retryAfter == 0, retryAfter
+}
+
+// 超过限制时抛出429的异常，在请求中由路由与中间件一样返回429与Retry-After，输出交由SetErrorHandler设置的错误处理器
+func (this *rateLimiterImplement) Check(key string) {
+	isAllow, retryAfter := this.Allow(key)
+	if isAllow == false {
+		ThrowWithCause(429, rateLimitExceed{key: key, retryAfter: retryAfter}, "too many requests, retry after "+getRateLimitRetryAfter(retryAfter)+"s")
+	}
+}
+
+func (this *rateLimiterImplement) Close() {
+	this.store.close()
+}
+
+// Retry-After只支持整数秒，向上取整
+func getRateLimitRetryAfter(retryAfter time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+}
+
+// Check抛出的异常的cause，用于路由识别超过限制的请求
+type rateLimitExceed struct {
+	key        string
+	retryAfter time.Duration
+}
+
+func getRateLimitExceed(exception Exception) (rateLimitExceed, bool) {
+	result, ok := exception.GetCause().(rateLimitExceed)
+	return result, ok
+}
+
+func writeRateLimitError(basic *Basic, pattern string, key string, retryAfter time.Duration) {
+	appError := newAppError(429, "too many requests", "")
+	basic.Log.Warning("too many requests : %s %s Key:[%s] ErrorId:[%s]", pattern, basic.Ctx.GetMethod(), key, appError.Id)
+	basic.Ctx.WriteHeader("Retry-After", getRateLimitRetryAfter(retryAfter))
+	writeAppError(basic, appError)
+}
+
+type rateLimitMemoryItem struct {
+	tokens float64
+	times  []time.Time
+	last   time.Time
+}
+
+type rateLimitMemoryStore struct {
+	config RateLimiterConfig
+	items  map[string]*rateLimitMemoryItem
+	lastGc time.Time
+	lock   sync.Mutex
+}
+
+func (this *rateLimitMemoryStore) take(key string, n int, now time.Time) (time.Duration, error) {
+	if n > this.config.Limit {
+		return this.config.Window, nil
+	}
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.gc(now)
+	item, isExist := this.items[key]
+	if isExist == false {
+		item = &rateLimitMemoryItem{
+			tokens: float64(this.config.Limit),
+			last:   now,
+		}
+		this.items[key] = item
+	}
+	if this.config.Algorithm == "tokenbucket" {
+		return this.takeTokenBucket(item, n, now), nil
+	}
+	return this.takeSlidingWindow(item, n, now), nil
+}
+
+func (this *rateLimitMemoryStore) takeTokenBucket(item *rateLimitMemoryItem, n int, now time.Time) time.Duration {
+	rate := float64(this.config.Limit) / float64(this.config.Window)
+	if now.After(item.last) {
+		item.tokens = math.Min(float64(this.config.Limit), item.tokens+float64(now.Sub(item.last))*rate)
+		item.last = now
+	}
+	if item.tokens >= float64(n) {
+		item.tokens -= float64(n)
+		return 0
+	}
+	return time.Duration(math.Ceil((float64(n) - item.tokens) / rate))
+}
+
+func (this *rateLimitMemoryStore) takeSlidingWindow(item *rateLimitMemoryItem, n int, now time.Time) time.Duration {
+	begin := now.Add(-this.config.Window)
+	index := 0
+	for index < len(item.times) && item.times[index].After(begin) == false {
+		index++
+	}
+	item.times = item.times[index:]
+	item.last = now
+	count := len(item.times)
+	if count+n <= this.config.Limit {
+		for i := 0; i != n; i++ {
+			item.times = append(item.times, now)
+		}
+		return 0
+	}
+	return item.times[count+n-this.config.Limit-1].Add(this.config.Window).Sub(now)
+}
+
+// 每个窗口清理一次长时间没有访问的key，此时令牌桶已满，滑动窗口已空
+func (this *rateLimitMemoryStore) gc(now time.Time) {
+	if now.Sub(this.lastGc) < this.config.Window {
+		return
+	}
+	this.lastGc = now
+	for key, item := range this.items {
+		if now.Sub(item.last) >= this.config.Window {
+			delete(this.items, key)
+		}
+	}
+}
+
+func (this *rateLimitMemoryStore) close() {
+}
+
+// 令牌数与上次补充的时间保存在hash中，时间单位为毫秒
+var rateLimitTokenBucketScript = redis.NewScript(1, `
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+local data = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(data[1])
+local last = tonumber(data[2])
+if tokens == nil or last == nil then
+	tokens = capacity
+	last = now
+end
+if now > last then
+	tokens = math.min(capacity, tokens + (now - last) * rate)
+	last = now
+end
+local wait = 0
+if tokens >= n then
+	tokens = tokens - n
+else
+	wait = math.ceil((n - tokens) / rate)
+end
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'last', last)
+redis.call('PEXPIRE', KEYS[1], math.ceil(capacity / rate))
+return wait
+`)
+
+// 每次请求保存为有序集合中的一个成员，分数为请求的时间，单位为毫秒
+var rateLimitSlidingWindowScript = redis.NewScript(1, `
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+if count + n <= limit then
+	for i = 1, n do
+		redis.call('ZADD', KEYS[1], now, ARGV[5] .. ':' .. i)
+	end
+	redis.call('PEXPIRE', KEYS[1], window)
+	return 0
+end
+local index = count + n - limit - 1
+local oldest = redis.call('ZRANGE', KEYS[1], index, index, 'WITHSCORES')
+return math.max(1, tonumber(oldest[2]) + window - now)
+`)
+
+type rateLimitRedisStore struct {
+	config    RateLimiterConfig
+	redisPool *redis.Pool
+}
+
+func (this *rateLimitRedisStore) take(key string, n int, now time.Time) (time.Duration, error) {
+	if n > this.config.Limit {
+		return this.config.Window, nil
+	}
+	c := this.redisPool.Get()
+	defer c.Close()
+
+	nowMs := now.UnixNano() / int64(time.Millisecond)
+	windowMs := int64(this.config.Window / time.Millisecond)
+	var wait int64
+	var err error
+	if this.config.Algorithm == "tokenbucket" {
+		rate := float64(this.config.Limit) / float64(windowMs)
+		wait, err = redis.Int64(rateLimitTokenBucketScript.Do(c, this.config.SavePrefix+key, this.config.Limit, rate, nowMs, n))
+	} else {
+		wait, err = redis.Int64(rateLimitSlidingWindowScript.Do(c, this.config.SavePrefix+key, this.config.Limit, windowMs, nowMs, n, newTraceId(8)))
+	}
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(wait) * time.Millisecond, nil
+}
+
+func (this *rateLimitRedisStore) close() {
+	this.redisPool.Close()
+}
+
+// 限流的key，通常按ip或登录用户区分
+type RateLimitKeyFunc func(basic *Basic) string
+
+// 只有直连的对端是可信代理时才使用X-Forwarded-For，避免伪造请求头绕过限流
+func RateLimitKeyByIp(basic *Basic) string {
+	return "ip:" + basic.Ctx.GetClientIP()
+}
+
+// name为空时使用session id，否则使用session中name的值，如登录用户的clientId，没有值时退回到ip
+// 请求没有携带已经存在的session时同样退回到ip，不创建新的session，避免丢弃cookie绕过限流
+func RateLimitKeyBySession(name string) RateLimitKeyFunc {
+	return func(basic *Basic) string {
+		session, ok := basic.Session.(*sessionImplement)
+		if ok == false || session.isExist() == false {
+			return RateLimitKeyByIp(basic)
+		}
+		sess, err := basic.Session.SessionStart()
+		if err != nil {
+			return RateLimitKeyByIp(basic)
+		}
+		defer sess.SessionRelease()
+		if name == "" {
+			return "session:" + sess.SessionID()
+		}
+		value := sess.Get(name)
+		if value == nil || fmt.Sprintf("%v", value) == "" {
+			return RateLimitKeyByIp(basic)
+		}
+		return "session:" + fmt.Sprintf("%v", value)
+	}
+}
+
+func getRateLimitKeyFuncFromConfig() RateLimitKeyFunc {
+	if globalBasic.Config.Get().RateLimit.Key == "session" {
+		return RateLimitKeyBySession(globalBasic.Config.Get().RateLimit.SessionKey)
+	}
+	return RateLimitKeyByIp
+}
+
+// 限流的路由中间件，limiter为nil时使用Basic中的RateLimiter，keyFunc为nil时按配置的key区分
+// 超过限制时返回429与Retry-After，输出交由SetErrorHandler设置的错误处理器
+func NewRateLimitMiddleware(limiter RateLimiter, keyFunc RateLimitKeyFunc) AppRouterRouteMiddleware {
+	return func(basic *Basic, method AppRouterMethodInfo, next func()) {
+		currentLimiter := limiter
+		if currentLimiter == nil {
+			currentLimiter = basic.RateLimiter
+		}
+		if currentLimiter == nil {
+			next()
+			return
+		}
+		currentKeyFunc := keyFunc
+		if currentKeyFunc == nil {
+			currentKeyFunc = getRateLimitKeyFuncFromConfig()
+		}
+		key := currentKeyFunc(basic)
+		isAllow, retryAfter := currentLimiter.WithLog(basic.Log).Allow(key)
+		if isAllow {
+			next()
+			return
+		}
+		writeRateLimitError(basic, method.Pattern, key, retryAfter)
+	}
+}
@@ -0,0 +1,230 @@
+package web
+
+import (
+	"github.com/milkbobo/fishgoweb/assert"
+	"github.com/milkbobo/fishgoweb/language"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type rateLimitTestController struct {
+	Controller
+}
+
+func (this *rateLimitTestController) Get_Json() interface{} {
+	return nil
+}
+
+func (this *rateLimitTestController) Check_Json() interface{} {
+	this.RateLimiter.Check("check")
+	return nil
+}
+
+func (this *rateLimitTestController) AutoRender(data interface{}, viewName string) {
+	if data != nil {
+		exception := data.(language.Exception)
+		this.Ctx.Write([]byte(exception.GetMessage()))
+		return
+	}
+	this.Ctx.Write([]byte("ok"))
+}
+
+func TestRateLimiterConfig(t *testing.T) {
+	limiter, err := NewRateLimiter(RateLimiterConfig{})
+	assert.AssertEqual(t, limiter, nil)
+	assert.AssertEqual(t, err, nil)
+	_, err = NewRateLimiter(RateLimiterConfig{Driver: "file", Limit: 1})
+	assert.AssertEqual(t, err.Error(), "invalid ratelimit driver file")
+	_, err = NewRateLimiter(RateLimiterConfig{Driver: "memory", Algorithm: "leakybucket", Limit: 1})
+	assert.AssertEqual(t, err.Error(), "invalid ratelimit algorithm leakybucket")
+	_, err = NewRateLimiter(RateLimiterConfig{Driver: "memory"})
+	assert.AssertEqual(t, err.Error(), "invalid ratelimit limit 0")
+}
+
+func TestRateLimiterMemory(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	newLimiter := func(algorithm string) *rateLimiterImplement {
+		limiter, err := NewRateLimiter(RateLimiterConfig{
+			Driver:    "memory",
+			Algorithm: algorithm,
+			Limit:     3,
+			Window:    3 * time.Second,
+		})
+		assert.AssertEqual(t, err, nil)
+		result := limiter.(*rateLimiterImplement)
+		result.now = func() time.Time {
+			return now
+		}
+		return result
+	}
+	type testCase struct {
+		after      time.Duration
+		isAllow    bool
+		retryAfter time.Duration
+	}
+	runTestCase := func(limiter *rateLimiterImplement, testCases []testCase) {
+		for singleIndex, singleTestCase := range testCases {
+			now = now.Add(singleTestCase.after)
+			isAllow, retryAfter := limiter.Allow("user")
+			assert.AssertEqual(t, isAllow, singleTestCase.isAllow, singleIndex)
+			assert.AssertEqual(t, retryAfter, singleTestCase.retryAfter, singleIndex)
+		}
+	}
+
+	//令牌桶每秒补充一个令牌
+	runTestCase(newLimiter("tokenbucket"), []testCase{
+		{0, true, 0},
+		{0, true, 0},
+		{0, true, 0},
+		{0, false, time.Second},
+		{500 * time.Millisecond, false, 500 * time.Millisecond},
+		{500 * time.Millisecond, true, 0},
+		{10 * time.Second, true, 0},
+		{0, true, 0},
+		{0, true, 0},
+		{0, false, time.Second},
+	})
+
+	//滑动窗口在任意3秒内最多3次
+	runTestCase(newLimiter("slidingwindow"), []testCase{
+		{0, true, 0},
+		{time.Second, true, 0},
+		{time.Second, true, 0},
+		{500 * time.Millisecond, false, 500 * time.Millisecond},
+		{500 * time.Millisecond, true, 0},
+		{0, false, time.Second},
+		{time.Second, true, 0},
+	})
+
+	//超过limit的n永远不会通过
+	limiter := newLimiter("slidingwindow")
+	isAllow, retryAfter := limiter.AllowN("other", 4)
+	assert.AssertEqual(t, isAllow, false)
+	assert.AssertEqual(t, retryAfter, 3*time.Second)
+	isAllow, retryAfter = limiter.AllowN("other", 3)
+	assert.AssertEqual(t, isAllow, true)
+	assert.AssertEqual(t, retryAfter, time.Duration(0))
+	isAllow, retryAfter = limiter.AllowN("other", 2)
+	assert.AssertEqual(t, isAllow, false)
+	assert.AssertEqual(t, retryAfter, 3*time.Second)
+
+	//长时间不访问的key会被清理
+	now = now.Add(time.Hour)
+	limiter.Allow("user")
+	assert.AssertEqual(t, len(limiter.store.(*rateLimitMemoryStore).items), 1)
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	limiter, err := NewRateLimiter(RateLimiterConfig{
+		Driver: "memory",
+		Limit:  2,
+		Window: time.Minute,
+	})
+	assert.AssertEqual(t, err, nil)
+	oldRateLimiter := globalBasic.RateLimiter
+	oldRouteTree := handler.routeTree
+	oldRouteMiddlewares := routeMiddlewares
+	defer func() {
+		globalBasic.RateLimiter = oldRateLimiter
+		handler.routeTree = oldRouteTree
+		routeMiddlewares = oldRouteMiddlewares
+	}()
+	globalBasic.RateLimiter = limiter
+	handler.routeTree = nil
+	handler.addRoute("/ratelimit", &rateLimitTestController{}, 0)
+	routeMiddlewares = nil
+	AddRouteMiddleware(NewRateLimitMiddleware(nil, func(basic *Basic) string {
+		return "header:" + basic.Ctx.GetHeader("X-User")
+	}))
+	server := httptest.NewServer(http.HandlerFunc(handler.innerServeHTTP))
+	defer server.Close()
+
+	get := func(url string, user string) (*http.Response, string) {
+		request, _ := http.NewRequest("GET", server.URL+url, nil)
+		request.Header.Set("X-User", user)
+		response, err := http.DefaultClient.Do(request)
+		assert.AssertEqual(t, err, nil)
+		defer response.Body.Close()
+		body, _ := ioutil.ReadAll(response.Body)
+		return response, string(body)
+	}
+	for i := 0; i != 2; i++ {
+		response, body := get("/ratelimit/get", "a")
+		assert.AssertEqual(t, response.StatusCode, 200)
+		assert.AssertEqual(t, body, "ok")
+	}
+	response, body := get("/ratelimit/get", "a")
+	assert.AssertEqual(t, response.StatusCode, 429)
+	assert.AssertEqual(t, response.Header.Get("Retry-After"), "30")
+	assert.AssertEqual(t, body, "too many requests")
+	response, _ = get("/ratelimit/get", "b")
+	assert.AssertEqual(t, response.StatusCode, 200)
+
+	//业务中直接使用
+	for _, user := range []string{"c", "d"} {
+		response, body = get("/ratelimit/check", user)
+		assert.AssertEqual(t, body, "ok")
+	}
+	response, body = get("/ratelimit/check", "e")
+	assert.AssertEqual(t, response.StatusCode, 429)
+	assert.AssertEqual(t, response.Header.Get("Retry-After"), "30")
+	assert.AssertEqual(t, body, "too many requests")
+}
+
+func TestRateLimitKeyByIp(t *testing.T) {
+	oldTrustedProxies := globalTrustedProxies
+	defer func() {
+		globalTrustedProxies = oldTrustedProxies
+	}()
+	request := httptest.NewRequest("GET", "/ratelimit/get", nil)
+	request.RemoteAddr = "127.0.0.1:1234"
+	request.Header.Set("X-Forwarded-For", "10.0.0.1")
+
+	//非可信代理伪造的X-Forwarded-For不影响限流的key
+	globalTrustedProxies = nil
+	basic := initBasic(request, &memoryResponseWriter{}, nil)
+	assert.AssertEqual(t, RateLimitKeyByIp(basic), "ip:127.0.0.1")
+	globalTrustedProxies, _ = NewTrustedProxies([]string{"127.0.0.1"})
+	basic = initBasic(request, &memoryResponseWriter{}, nil)
+	assert.AssertEqual(t, RateLimitKeyByIp(basic), "ip:10.0.0.1")
+}
+
+func TestRateLimitKeyBySession(t *testing.T) {
+	session := getSessionTest(t)
+	oldSession := globalBasic.Session
+	defer func() {
+		globalBasic.Session = oldSession
+	}()
+	globalBasic.Session = session
+	newRequest := func(cookie string) (*Basic, *memoryResponseWriter) {
+		request := httptest.NewRequest("GET", "/ratelimit/get", nil)
+		request.RemoteAddr = "127.0.0.1:1234"
+		if cookie != "" {
+			request.Header.Set("Cookie", "sessiontest="+cookie)
+		}
+		response := &memoryResponseWriter{}
+		return initBasic(request, response, nil), response
+	}
+
+	//没有session或session不存在时退回到ip，不创建新的session
+	for _, cookie := range []string{"", "unknown"} {
+		basic, response := newRequest(cookie)
+		assert.AssertEqual(t, RateLimitKeyBySession("")(basic), "ip:127.0.0.1")
+		assert.AssertEqual(t, RateLimitKeyBySession("clientId")(basic), "ip:127.0.0.1")
+		assert.AssertEqual(t, response.Header().Get("Set-Cookie"), "")
+	}
+
+	//已经存在的session
+	basic, _ := newRequest("")
+	sess, err := basic.Session.SessionStart()
+	assert.AssertEqual(t, err, nil)
+	sess.Set("clientId", 10001)
+	sess.SessionRelease()
+	basic, _ = newRequest(sess.SessionID())
+	assert.AssertEqual(t, RateLimitKeyBySession("")(basic), "session:"+sess.SessionID())
+	assert.AssertEqual(t, RateLimitKeyBySession("clientId")(basic), "session:10001")
+	assert.AssertEqual(t, RateLimitKeyBySession("userId")(basic), "ip:127.0.0.1")
+}
@@ -1,24 +1,89 @@
 package web
 
 import (
+	"crypto/subtle"
 	"errors"
+	"fmt"
 	. "github.com/milkbobo/fishgoweb/language"
 	. "github.com/milkbobo/fishgoweb/util"
+	"net"
 	"runtime"
+	"strings"
+)
+
+const (
+	SecurityCsrfHeader     = "X-CSRF-Token"
+	SecurityCsrfField      = "_csrf"
+	securityCsrfSessionKey = "_csrf_token"
 )
 
 type Security interface {
+	WithSessionAndContext(session Session, ctx Context) Security
+	WriteHeader()
+	IsAllowIp(pattern string) bool
+	IsValidCsrf(pattern string) bool
+	GetCsrfToken() string
+}
+
+// namespace下的客户端ip规则，先检查deny再检查allow，allow为空时不限制
+type SecurityIpRule struct {
+	Namespace string
+	Allow     []string
+	Deny      []string
 }
 
 type SecurityConfig struct {
-	IpWhite []string
+	IpWhite            []string
+	IpRules            []SecurityIpRule
+	Csrf               bool
+	CsrfExclude        []string
+	Hsts               string
+	FrameOptions       string
+	Csp                string
+	ContentTypeOptions string
+	ReferrerPolicy     string
 }
 
-func NewSecurity(config SecurityConfig) (Security, error) {
-	var netConfig string
-	if len(config.IpWhite) == 0 {
-		return nil, nil
+type securityIpRule struct {
+	segments []string
+	allow    []*net.IPNet
+	deny     []*net.IPNet
+}
+
+type securityImplement struct {
+	config      SecurityConfig
+	ipRules     []securityIpRule
+	csrfExclude [][]string
+	session     Session
+	ctx         Context
+}
+
+// ip支持单个地址与CIDR
+func parseSecurityIpNet(ip string) (*net.IPNet, error) {
+	ip = strings.TrimSpace(ip)
+	if strings.Contains(ip, "/") == false {
+		if strings.Contains(ip, ":") {
+			ip = ip + "/128"
+		} else {
+			ip = ip + "/32"
+		}
+	}
+	_, result, err := net.ParseCIDR(ip)
+	return result, err
+}
+
+func isSecurityIpIn(ipNets []*net.IPNet, ip net.IP) bool {
+	for _, single := range ipNets {
+		if single.Contains(ip) {
+			return true
+		}
 	}
+	return false
+}
+
+// 启动时检查服务器自身的ip是否在IpWhite中
+func checkSecurityServerIp(ipWhite []string) error {
+	var netConfig string
 	if runtime.GOOS == "darwin" {
 		netConfig = "en0"
 	} else {
@@ -26,19 +91,187 @@ func NewSecurity(config SecurityConfig) (Security, error) {
 	}
 	ip, err := NewIfconfig().GetIP(netConfig)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	ipStr := ip.IP.String()
-	if len(config.IpWhite) != 0 && ArrayIn(config.IpWhite, ipStr) == -1 {
-		return nil, errors.New("当前IP: " + ipStr + "不在IP白名单中: " + Implode(config.IpWhite, ","))
+	if ArrayIn(ipWhite, ipStr) == -1 {
+		return errors.New("当前IP: " + ipStr + "不在IP白名单中: " + Implode(ipWhite, ","))
+	}
+	return nil
+}
+
+func NewSecurity(config SecurityConfig) (Security, error) {
+	if len(config.IpWhite) != 0 {
+		err := checkSecurityServerIp(config.IpWhite)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(config.IpRules) == 0 && config.Csrf == false &&
+		config.Hsts == "" && config.FrameOptions == "" && config.Csp == "" &&
+		config.ContentTypeOptions == "" && config.ReferrerPolicy == "" {
+		return nil, nil
 	}
 
-	return nil, nil
+	result := &securityImplement{
+		config: config,
+	}
+	for _, singleRule := range config.IpRules {
+		rule := securityIpRule{
+			segments: getRoutePatternSegments(singleRule.Namespace),
+		}
+		for _, single := range singleRule.Allow {
+			ipNet, err := parseSecurityIpNet(single)
+			if err != nil {
+				return nil, errors.New("invalid security allow ip " + single)
+			}
+			rule.allow = append(rule.allow, ipNet)
+		}
+		for _, single := range singleRule.Deny {
+			ipNet, err := parseSecurityIpNet(single)
+			if err != nil {
+				return nil, errors.New("invalid security deny ip " + single)
+			}
+			rule.deny = append(rule.deny, ipNet)
+		}
+		result.ipRules = append(result.ipRules, rule)
+	}
+	for _, single := range config.CsrfExclude {
+		result.csrfExclude = append(result.csrfExclude, getRoutePatternSegments(single))
+	}
+	return result, nil
 }
 
 func NewSecurityFromConfig() (Security, error) {
-	ipwhite := globalBasic.Config.Get().SecurityIpWhite
-	ipwhiteList := Explode(ipwhite, ",")
-	return NewSecurity(SecurityConfig{IpWhite: ipwhiteList})
+	securityConfig := SecurityConfig{}
+	securityConfig.IpWhite = Explode(globalBasic.Config.Get().SecurityIpWhite, ",")
+	for _, single := range globalBasic.Config.Get().Security.Ip {
+		securityConfig.IpRules = append(securityConfig.IpRules, SecurityIpRule{
+			Namespace: single.Namespace,
+			Allow:     Explode(single.Allow, ","),
+			Deny:      Explode(single.Deny, ","),
+		})
+	}
+	securityConfig.Csrf = globalBasic.Config.Get().Security.Csrf
+	securityConfig.CsrfExclude = Explode(globalBasic.Config.Get().Security.CsrfExclude, ",")
+	securityConfig.Hsts = globalBasic.Config.Get().Security.Hsts
+	securityConfig.FrameOptions = globalBasic.Config.Get().Security.FrameOptions
+	securityConfig.Csp = globalBasic.Config.Get().Security.Csp
+	securityConfig.ContentTypeOptions = globalBasic.Config.Get().Security.ContentTypeOptions
+	securityConfig.ReferrerPolicy = globalBasic.Config.Get().Security.ReferrerPolicy
+	if securityConfig.Csrf && globalBasic.Config.Get().Session.Driver == "" {
+		return nil, errors.New("security csrf need session driver")
+	}
+	return NewSecurity(securityConfig)
+}
+
+func (this *securityImplement) WithSessionAndContext(session Session, ctx Context) Security {
+	if this == nil {
+		return nil
+	} else {
+		newSecurity := *this
+		newSecurity.session = session
+		newSecurity.ctx = ctx
+		return &newSecurity
+	}
+}
+
+// HSTS只在https下输出
+func (this *securityImplement) WriteHeader() {
+	if this.config.Hsts != "" && this.ctx.GetScheme() == "https" {
+		this.ctx.WriteHeader("Strict-Transport-Security", this.config.Hsts)
+	}
+	if this.config.FrameOptions != "" {
+		this.ctx.WriteHeader("X-Frame-Options", this.config.FrameOptions)
+	}
+	if this.config.Csp != "" {
+		this.ctx.WriteHeader("Content-Security-Policy", this.config.Csp)
+	}
+	if this.config.ContentTypeOptions != "" {
+		this.ctx.WriteHeader("X-Content-Type-Options", this.config.ContentTypeOptions)
+	}
+	if this.config.ReferrerPolicy != "" {
+		this.ctx.WriteHeader("Referrer-Policy", this.config.ReferrerPolicy)
+	}
+}
+
+// 客户端ip使用GetClientIP，pattern为路由的pattern，所有匹配的namespace规则都需要通过
+func (this *securityImplement) IsAllowIp(pattern string) bool {
+	if len(this.ipRules) == 0 {
+		return true
+	}
+	ip := net.ParseIP(this.ctx.GetClientIP())
+	segments := getRoutePatternSegments(pattern)
+	for _, single := range this.ipRules {
+		if isRoutePatternPrefix(segments, single.segments) == false {
+			continue
+		}
+		if ip == nil {
+			return false
+		}
+		if isSecurityIpIn(single.deny, ip) {
+			return false
+		}
+		if len(single.allow) != 0 && isSecurityIpIn(single.allow, ip) == false {
+			return false
+		}
+	}
+	return true
+}
+
+// 只检查会修改数据的请求，token来自X-CSRF-Token头或者_csrf参数
+func (this *securityImplement) IsValidCsrf(pattern string) bool {
+	if this.config.Csrf == false {
+		return true
+	}
+	method := this.ctx.GetMethod()
+	if method == "GET" || method == "HEAD" || method == "OPTIONS" || method == "TRACE" {
+		return true
+	}
+	segments := getRoutePatternSegments(pattern)
+	for _, single := range this.csrfExclude {
+		if isRoutePatternPrefix(segments, single) {
+			return true
+		}
+	}
+	token := this.ctx.GetHeader(SecurityCsrfHeader)
+	if token == "" {
+		token = this.ctx.GetParam(SecurityCsrfField)
+	}
+	if token == "" || this.session == nil {
+		return false
+	}
+	sess, err := this.session.SessionStart()
+	if err != nil {
+		return false
+	}
+	defer sess.SessionRelease()
+	sessionToken := fmt.Sprintf("%v", sess.Get(securityCsrfSessionKey))
+	if sess.Get(securityCsrfSessionKey) == nil || sessionToken == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(sessionToken)) == 1
+}
+
+// 获取当前session的csrf token，不存在时生成并保存到session中
+func (this *securityImplement) GetCsrfToken() string {
+	if this.session == nil {
+		Throw(1, "security csrf need session")
+	}
+	sess, err := this.session.SessionStart()
+	if err != nil {
+		Throw(1, "session启动失败 "+err.Error())
+	}
+	defer sess.SessionRelease()
+	token := sess.Get(securityCsrfSessionKey)
+	if token != nil && fmt.Sprintf("%v", token) != "" {
+		return fmt.Sprintf("%v", token)
+	}
+	result := newTraceId(16)
+	err = sess.Set(securityCsrfSessionKey, result)
+	if err != nil {
+		Throw(1, err.Error())
+	}
+	return result
 }
@@ -0,0 +1,212 @@
+package web
+
+import (
+	"github.com/milkbobo/fishgoweb/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type securityTestController struct {
+	Controller
+}
+
+func (this *securityTestController) Token_Json() interface{} {
+	return this.Security.GetCsrfToken()
+}
+
+func (this *securityTestController) Add_Json_Post() interface{} {
+	return "add"
+}
+
+func (this *securityTestController) AutoRender(data interface{}, viewName string) {
+	this.Ctx.Write([]byte(data.(string)))
+}
+
+var (
+	sessionTestOnce sync.Once
+	sessionTest     Session
+)
+
+// beego的memory驱动是全局的，测试之间共用一个session，避免初始化与GC并发
+func getSessionTest(t *testing.T) Session {
+	sessionTestOnce.Do(func() {
+		var err error
+		sessionTest, err = NewSession(SessionConfig{Driver: "memory", CookieName: "sessiontest", EnableSetCookie: true})
+		assert.AssertEqual(t, err, nil)
+	})
+	return sessionTest
+}
+
+func TestSecurityConfig(t *testing.T) {
+	security, err := NewSecurity(SecurityConfig{})
+	assert.AssertEqual(t, security, nil)
+	assert.AssertEqual(t, err, nil)
+	_, err = NewSecurity(SecurityConfig{IpRules: []SecurityIpRule{{Namespace: "/admin", Allow: []string{"10.0.0.1/40"}}}})
+	assert.AssertEqual(t, err.Error(), "invalid security allow ip 10.0.0.1/40")
+
+	security, err = NewSecurity(SecurityConfig{IpRules: []SecurityIpRule{
+		{Namespace: "/admin", Allow: []string{"10.0.0.0/8", "127.0.0.1", "fd00::/8"}, Deny: []string{"10.0.0.5", "fd00::5"}},
+		{Namespace: "/admin/{id}/secret", Allow: []string{"10.0.0.1"}},
+	}})
+	assert.AssertEqual(t, err, nil)
+	oldTrustedProxies := globalTrustedProxies
+	defer func() {
+		globalTrustedProxies = oldTrustedProxies
+	}()
+	testCase := []struct {
+		remoteAddr     string
+		proxy          string
+		trustedProxies []string
+		pattern        string
+		isAllow        bool
+	}{
+		{"192.168.1.1:1234", "", nil, "/user/get", true},
+		{"192.168.1.1:1234", "", nil, "/admin/get", false},
+		{"10.1.2.3:1234", "", nil, "/admin/get", true},
+		{"127.0.0.1:1234", "", nil, "/admin", true},
+		{"10.0.0.5:1234", "", nil, "/admin/get", false},
+		{"10.1.2.3:1234", "", nil, "/admin/{userId}/secret/get", false},
+		{"10.0.0.1:1234", "", nil, "/admin/{userId}/secret/get", true},
+		{"192.168.1.1:1234", "", nil, "/adminer/get", true},
+		//ipv6
+		{"[fd00::1]:1234", "", nil, "/admin/get", true},
+		{"[fd00::5]:1234", "", nil, "/admin/get", false},
+		{"[::1]:1234", "", nil, "/admin/get", false},
+		//伪造的X-Forwarded-For不能绕过allow与deny
+		{"192.168.1.1:1234", "10.1.2.3", nil, "/admin/get", false},
+		{"10.1.2.3:1234", "10.0.0.5", nil, "/admin/get", true},
+		//可信代理转发时使用X-Forwarded-For
+		{"192.168.1.1:1234", "10.1.2.3", []string{"192.168.0.0/16"}, "/admin/get", true},
+		{"192.168.1.1:1234", "10.0.0.5", []string{"192.168.0.0/16"}, "/admin/get", false},
+		{"192.168.1.1:1234", "10.1.2.3, 172.16.0.1", []string{"192.168.0.0/16"}, "/admin/get", false},
+	}
+	for singleIndex, singleTestCase := range testCase {
+		globalTrustedProxies, err = NewTrustedProxies(singleTestCase.trustedProxies)
+		assert.AssertEqual(t, err, nil, singleIndex)
+		request, _ := http.NewRequest("GET", "/", nil)
+		request.RemoteAddr = singleTestCase.remoteAddr
+		if singleTestCase.proxy != "" {
+			request.Header.Set("X-Forwarded-For", singleTestCase.proxy)
+		}
+		ctx := NewContext(request, &memoryResponseWriter{}, nil)
+		isAllow := security.WithSessionAndContext(nil, ctx).IsAllowIp(singleTestCase.pattern)
+		assert.AssertEqual(t, isAllow, singleTestCase.isAllow, singleIndex)
+	}
+}
+
+func TestSecurityRequest(t *testing.T) {
+	security, err := NewSecurity(SecurityConfig{
+		IpRules:            []SecurityIpRule{{Namespace: "/securitytest/admin", Allow: []string{"10.0.0.0/8"}}},
+		Csrf:               true,
+		CsrfExclude:        []string{"/securitytest/callback"},
+		Hsts:               "max-age=31536000",
+		FrameOptions:       "DENY",
+		Csp:                "default-src 'self'",
+		ContentTypeOptions: "nosniff",
+	})
+	assert.AssertEqual(t, err, nil)
+	session := getSessionTest(t)
+	cors, err := NewCors(CorsConfig{AllowOrigins: []string{"https://app.example.com"}})
+	assert.AssertEqual(t, err, nil)
+	oldSecurity := globalBasic.Security
+	oldSession := globalBasic.Session
+	oldCors := globalBasic.Cors
+	oldRouteTree := handler.routeTree
+	oldTrustedProxies := globalTrustedProxies
+	defer func() {
+		globalBasic.Security = oldSecurity
+		globalBasic.Session = oldSession
+		globalBasic.Cors = oldCors
+		handler.routeTree = oldRouteTree
+		globalTrustedProxies = oldTrustedProxies
+	}()
+	globalBasic.Security = security
+	globalBasic.Session = session
+	globalBasic.Cors = cors
+	handler.routeTree = nil
+	handler.addRoute("/securitytest", &securityTestController{}, 0)
+	handler.addRoute("/securitytest/admin", &securityTestController{}, 0)
+	handler.addRoute("/securitytest/callback", &securityTestController{}, 0)
+	server := httptest.NewServer(http.HandlerFunc(handler.innerServeHTTP))
+	defer server.Close()
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	do := func(method string, url string, body string, header map[string]string) (*http.Response, string) {
+		request, _ := http.NewRequest(method, server.URL+url, strings.NewReader(body))
+		if body != "" {
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		for key, value := range header {
+			request.Header.Set(key, value)
+		}
+		response, err := client.Do(request)
+		assert.AssertEqual(t, err, nil)
+		defer response.Body.Close()
+		data, _ := ioutil.ReadAll(response.Body)
+		return response, string(data)
+	}
+
+	//安全头部，http下不输出HSTS
+	response, token := do("GET", "/securitytest/token", "", nil)
+	assert.AssertEqual(t, response.StatusCode, 200)
+	assert.AssertEqual(t, len(token), 32)
+	assert.AssertEqual(t, response.Header.Get("X-Frame-Options"), "DENY")
+	assert.AssertEqual(t, response.Header.Get("Content-Security-Policy"), "default-src 'self'")
+	assert.AssertEqual(t, response.Header.Get("X-Content-Type-Options"), "nosniff")
+	assert.AssertEqual(t, response.Header.Get("Strict-Transport-Security"), "")
+	_, sameToken := do("GET", "/securitytest/token", "", nil)
+	assert.AssertEqual(t, sameToken, token)
+
+	//csrf
+	response, body := do("POST", "/securitytest/add", "", nil)
+	assert.AssertEqual(t, response.StatusCode, 403)
+	assert.AssertEqual(t, body, "invalid csrf token")
+	response, _ = do("POST", "/securitytest/add", "", map[string]string{SecurityCsrfHeader: "wrong"})
+	assert.AssertEqual(t, response.StatusCode, 403)
+	response, body = do("POST", "/securitytest/add", "", map[string]string{SecurityCsrfHeader: token})
+	assert.AssertEqual(t, response.StatusCode, 200)
+	assert.AssertEqual(t, body, "add")
+	response, body = do("POST", "/securitytest/add", url.Values{SecurityCsrfField: {token}}.Encode(), nil)
+	assert.AssertEqual(t, response.StatusCode, 200)
+	assert.AssertEqual(t, body, "add")
+	response, body = do("POST", "/securitytest/callback/add", "", nil)
+	assert.AssertEqual(t, response.StatusCode, 200)
+
+	//ip
+	response, body = do("GET", "/securitytest/admin/token", "", nil)
+	assert.AssertEqual(t, response.StatusCode, 403)
+	assert.AssertEqual(t, body, "forbidden")
+	response, body = do("GET", "/securitytest/admin/token", "", map[string]string{"X-Forwarded-For": "10.1.1.1"})
+	assert.AssertEqual(t, response.StatusCode, 403)
+
+	//预检请求与405同样检查ip
+	response, body = do("OPTIONS", "/securitytest/admin/token", "", map[string]string{"Origin": "https://app.example.com"})
+	assert.AssertEqual(t, response.StatusCode, 403)
+	assert.AssertEqual(t, response.Header.Get("Access-Control-Allow-Origin"), "")
+	response, body = do("GET", "/securitytest/admin/add", "", nil)
+	assert.AssertEqual(t, response.StatusCode, 403)
+	response, body = do("OPTIONS", "/securitytest/token", "", map[string]string{"Origin": "https://app.example.com"})
+	assert.AssertEqual(t, response.StatusCode, 204)
+	assert.AssertEqual(t, response.Header.Get("Access-Control-Allow-Origin"), "https://app.example.com")
+
+	//404与405的错误同样输出Cors头
+	response, body = do("GET", "/notfound", "", map[string]string{"Origin": "https://app.example.com"})
+	assert.AssertEqual(t, response.StatusCode, 404)
+	assert.AssertEqual(t, response.Header.Get("Access-Control-Allow-Origin"), "https://app.example.com")
+	response, body = do("GET", "/securitytest/add", "", map[string]string{"Origin": "https://app.example.com"})
+	assert.AssertEqual(t, response.StatusCode, 405)
+	assert.AssertEqual(t, response.Header.Get("Access-Control-Allow-Origin"), "https://app.example.com")
+	assert.AssertEqual(t, response.Header.Get("X-Frame-Options"), "DENY")
+
+	globalTrustedProxies, _ = NewTrustedProxies([]string{"127.0.0.1"})
+	response, body = do("GET", "/securitytest/admin/token", "", map[string]string{"X-Forwarded-For": "10.1.1.1"})
+	assert.AssertEqual(t, response.StatusCode, 200)
+	assert.AssertEqual(t, body, token)
+}
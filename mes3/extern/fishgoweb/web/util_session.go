@@ -3,6 +3,7 @@ package web
 import (
 	"github.com/beego/beego/session"
 	_ "github.com/beego/beego/session/redis"
+	"github.com/milkbobo/fishgoweb/web/util_queue"
 	_ "github.com/milkbobo/fishgoweb/web/util_session"
 	"net/http"
 	"net/url"
@@ -156,6 +157,28 @@ func (manager *sessionImplement) SessionStart() (session SessionStore, err error
 	return newSessionStoreImplement(result, w), errOrgin
 }
 
+// 请求是否携带已经存在的session，不会创建新的session
+func (manager *sessionImplement) isExist() bool {
+	r := manager.ctx.GetRawRequest().(*http.Request)
+	cookie, err := r.Cookie(manager.config.CookieName)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	sid, err := url.QueryUnescape(cookie.Value)
+	if err != nil {
+		return false
+	}
+	return manager.GetProvider().SessionExist(sid)
+}
+
 func (this *sessionStoreImplement) SessionRelease() {
 	this.Store.SessionRelease(this.responseWriter)
 }
+
+// 只检查redis驱动的连通性
+func (this *sessionImplement) ping() error {
+	if this.config.Driver != "redis" {
+		return nil
+	}
+	return util_queue.PingRedis(this.config.ProviderConfig)
+}
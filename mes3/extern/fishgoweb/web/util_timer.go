@@ -6,6 +6,8 @@ import (
 	. "github.com/milkbobo/fishgoweb/util"
 	"github.com/robfig/cron"
 	"reflect"
+	"runtime"
+	"strings"
 	"time"
 )
 
@@ -34,18 +36,33 @@ func (this *timerImplement) WithLog(log Log) Timer {
 	return &result
 }
 
-func (this *timerImplement) startSingleTask(handler func()) {
+func (this *timerImplement) startSingleTask(name string, handler func()) {
 	this.closeFunc.IncrCloseCounter()
 	defer this.closeFunc.DecrCloseCounter()
+	beginTime := time.Now()
+	result := "success"
+	defer func() {
+		if globalMonitorMetric != nil {
+			globalMonitorMetric.observeTimerTask(name, result, time.Since(beginTime))
+		}
+	}()
 	defer CatchCrash(func(exception Exception) {
+		result = "crash"
 		this.log.Critical("TimerTask Crash Code:[%d] Message:[%s]\nStackTrace:[%s]", exception.GetCode(), exception.GetMessage(), exception.GetStackTrace())
 	})
 	defer Catch(func(exception Exception) {
+		result = "error"
 		this.log.Error("TimerTask Error Code:[%d] Message:[%s]\nStackTrace:[%s]", exception.GetCode(), exception.GetMessage(), exception.GetStackTrace())
 	})
 	handler()
 }
 
+// 定时任务的名称为处理函数的名称，如models.(*OrderAoModel).Expire-fm
+func (this *timerImplement) getHandlerName(handler interface{}) string {
+	name := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+	return name[strings.LastIndex(name, "/")+1:]
+}
+
 func (this *timerImplement) getHandler(handler interface{}) (func(), error) {
 	handlerValue := reflect.ValueOf(handler)
 	handlerType := reflect.TypeOf(handler)
@@ -81,8 +98,9 @@ func (this *timerImplement) Cron(cronspec string, inHandler interface{}) {
 	if err != nil {
 		panic(err)
 	}
+	name := this.getHandlerName(inHandler)
 	err = crontab.AddFunc(cronspec, func() {
-		this.startSingleTask(handler)
+		this.startSingleTask(name, handler)
 	})
 	if err != nil {
 		panic(err)
@@ -103,6 +121,7 @@ func (this *timerImplement) Interval(duraction time.Duration, inHandler interfac
 		panic(err)
 	}
 
+	name := this.getHandlerName(inHandler)
 	closeEvent := make(chan bool)
 	this.closeFunc.AddCloseHandler(func() {
 		closeEvent <- true
@@ -112,7 +131,7 @@ func (this *timerImplement) Interval(duraction time.Duration, inHandler interfac
 		for {
 			select {
 			case <-timeChan:
-				this.startSingleTask(handler)
+				this.startSingleTask(name, handler)
 				timeChan = time.After(duraction)
 			case <-closeEvent:
 				return
@@ -131,6 +150,7 @@ func (this *timerImplement) Tick(duraction time.Duration, inHandler interface{})
 	if err != nil {
 		panic(err)
 	}
+	name := this.getHandlerName(inHandler)
 	closeEvent := make(chan bool)
 	this.closeFunc.AddCloseHandler(func() {
 		closeEvent <- true
@@ -140,7 +160,7 @@ func (this *timerImplement) Tick(duraction time.Duration, inHandler interface{})
 		for {
 			select {
 			case <-tickChan:
-				this.startSingleTask(handler)
+				this.startSingleTask(name, handler)
 			case <-closeEvent:
 				return
 			}
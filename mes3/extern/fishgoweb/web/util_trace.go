@@ -0,0 +1,123 @@
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/milkbobo/fishgoweb/util"
+)
+
+const (
+	TraceRequestIdHeader   = "X-Request-Id"
+	TraceTraceParentHeader = "traceparent"
+	TraceTraceStateHeader  = "tracestate"
+)
+
+// 请求的追踪信息，traceId与parentId来自W3C traceparent，spanId为当前请求新生成的Id
+type contextTrace struct {
+	requestId  string
+	traceId    string
+	parentId   string
+	spanId     string
+	traceFlags string
+	traceState string
+}
+
+type contextTraceKey struct{}
+
+func newTraceId(size int) string {
+	result := make([]byte, size)
+	rand.Read(result)
+	return hex.EncodeToString(result)
+}
+
+func isTraceHex(data string, size int) bool {
+	if len(data) != size || strings.Trim(data, "0") == "" {
+		return false
+	}
+	for _, single := range data {
+		if (single < '0' || single > '9') && (single < 'a' || single > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// 外部传入的请求Id只接受可见的ascii字符，避免污染日志
+func isTraceRequestId(data string) bool {
+	if len(data) == 0 || len(data) > 128 {
+		return false
+	}
+	for _, single := range data {
+		if single <= ' ' || single > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// 格式为version-traceId-parentId-flags，如00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func parseTraceParent(data string) (string, string, string, bool) {
+	segments := strings.Split(strings.TrimSpace(data), "-")
+	if len(segments) < 4 || len(segments[0]) != 2 || segments[0] == "ff" ||
+		(segments[0] == "00" && len(segments) != 4) {
+		return "", "", "", false
+	}
+	if isTraceHex(segments[1], 32) == false ||
+		isTraceHex(segments[2], 16) == false ||
+		len(segments[3]) != 2 {
+		return "", "", "", false
+	}
+	return segments[1], segments[2], segments[3], true
+}
+
+func newContextTrace(header http.Header) contextTrace {
+	result := contextTrace{}
+	traceId, parentId, traceFlags, isValid := parseTraceParent(header.Get(TraceTraceParentHeader))
+	if isValid {
+		result.traceId = traceId
+		result.parentId = parentId
+		result.traceFlags = traceFlags
+		result.traceState = header.Get(TraceTraceStateHeader)
+	} else {
+		result.traceId = newTraceId(16)
+		result.traceFlags = "01"
+	}
+	result.spanId = newTraceId(8)
+	result.requestId = header.Get(TraceRequestIdHeader)
+	if isTraceRequestId(result.requestId) == false {
+		result.requestId = result.traceId
+	}
+	return result
+}
+
+func (this contextTrace) getTraceParent() string {
+	return "00-" + this.traceId + "-" + this.spanId + "-" + this.traceFlags
+}
+
+// 向下游转发的请求头，下游以当前请求的spanId作为parentId
+func (this contextTrace) getHeader() http.Header {
+	result := http.Header{}
+	result.Set(TraceRequestIdHeader, this.requestId)
+	result.Set(TraceTraceParentHeader, this.getTraceParent())
+	if this.traceState != "" {
+		result.Set(TraceTraceStateHeader, this.traceState)
+	}
+	return result
+}
+
+// 追踪信息保存在请求的context中，同一个请求多次创建Context时保持一致
+// 通过Basic.Ajax发起的调用自动转发，直接使用util.Ajax时需要传入Context: ctx.GetContext()
+func withContextTrace(request *http.Request) (*http.Request, contextTrace) {
+	ctx := request.Context()
+	if result, ok := ctx.Value(contextTraceKey{}).(contextTrace); ok {
+		return request, result
+	}
+	result := newContextTrace(request.Header)
+	ctx = context.WithValue(ctx, contextTraceKey{}, result)
+	ctx = util.WithAjaxHeader(ctx, result.getHeader())
+	return request.WithContext(ctx), result
+}
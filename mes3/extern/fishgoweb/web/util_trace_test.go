@@ -0,0 +1,115 @@
+package web
+
+import (
+	"github.com/milkbobo/fishgoweb/assert"
+	"github.com/milkbobo/fishgoweb/util"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTraceParent(t *testing.T) {
+	testCase := []struct {
+		origin   string
+		traceId  string
+		parentId string
+		isValid  bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", "", "", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "", "", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", "", "", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", "", "", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", "", "", false},
+		{"", "", "", false},
+	}
+	for singleIndex, singleTestCase := range testCase {
+		traceId, parentId, _, isValid := parseTraceParent(singleTestCase.origin)
+		assert.AssertEqual(t, isValid, singleTestCase.isValid, singleIndex)
+		assert.AssertEqual(t, traceId, singleTestCase.traceId, singleIndex)
+		assert.AssertEqual(t, parentId, singleTestCase.parentId, singleIndex)
+	}
+}
+
+func TestTraceContext(t *testing.T) {
+	//没有请求头时生成
+	request, _ := http.NewRequest("GET", "/", nil)
+	ctx := NewContext(request, &memoryResponseWriter{}, nil)
+	assert.AssertEqual(t, len(ctx.GetTraceId()), 32)
+	assert.AssertEqual(t, ctx.GetRequestId(), ctx.GetTraceId())
+	assert.AssertEqual(t, NewContext(ctx.GetRawRequest(), &memoryResponseWriter{}, nil).GetTraceParent(), ctx.GetTraceParent())
+
+	//沿用上游的请求Id与traceId
+	request, _ = http.NewRequest("GET", "/", nil)
+	request.Header.Set("X-Request-Id", "upstream-1")
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx = NewContext(request, &memoryResponseWriter{}, nil)
+	assert.AssertEqual(t, ctx.GetRequestId(), "upstream-1")
+	assert.AssertEqual(t, ctx.GetTraceId(), "4bf92f3577b34da6a3ce929d0e0e4736")
+	traceParent := ctx.GetTraceParent()
+	assert.AssertEqual(t, strings.HasPrefix(traceParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-"), true)
+	assert.AssertEqual(t, strings.HasSuffix(traceParent, "-01"), true)
+	assert.AssertEqual(t, strings.Contains(traceParent, "00f067aa0ba902b7"), false)
+
+	//不合法的请求Id
+	request, _ = http.NewRequest("GET", "/", nil)
+	request.Header.Set("X-Request-Id", "bad id\n")
+	ctx = NewContext(request, &memoryResponseWriter{}, nil)
+	assert.AssertEqual(t, ctx.GetRequestId(), ctx.GetTraceId())
+
+	//util.Ajax转发请求头
+	var ajaxHeader http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		ajaxHeader = request.Header
+	}))
+	defer server.Close()
+	request, _ = http.NewRequest("GET", "/", nil)
+	request.Header.Set("X-Request-Id", "upstream-2")
+	ctx = NewContext(request, &memoryResponseWriter{}, nil)
+	err := util.DefaultAjaxPool.Get(&util.Ajax{
+		Url:     server.URL,
+		Context: ctx.GetContext(),
+	})
+	assert.AssertEqual(t, err, nil)
+	assert.AssertEqual(t, ajaxHeader.Get("X-Request-Id"), "upstream-2")
+	assert.AssertEqual(t, ajaxHeader.Get("traceparent"), ctx.GetTraceParent())
+
+	//Basic.Ajax自动传入请求的context
+	request, _ = http.NewRequest("GET", "/", nil)
+	request.Header.Set("X-Request-Id", "upstream-3")
+	basic := initBasic(request, &memoryResponseWriter{}, nil)
+	err = basic.Ajax.Get(&util.Ajax{
+		Url: server.URL,
+	})
+	assert.AssertEqual(t, err, nil)
+	assert.AssertEqual(t, ajaxHeader.Get("X-Request-Id"), "upstream-3")
+	assert.AssertEqual(t, ajaxHeader.Get("traceparent"), basic.Ctx.GetTraceParent())
+	err = globalBasic.Ajax.Get(&util.Ajax{
+		Url: server.URL,
+	})
+	assert.AssertEqual(t, err, nil)
+	assert.AssertEqual(t, ajaxHeader.Get("X-Request-Id"), "")
+
+	//队列消息反序列化后沿用请求Id，以生产者为父节点
+	serializeRequest, err := ctx.SerializeRequest()
+	assert.AssertEqual(t, err, nil)
+	consumerCtx := initEmptyBasic(nil).Ctx
+	err = consumerCtx.DeSerializeRequest(serializeRequest)
+	assert.AssertEqual(t, err, nil)
+	assert.AssertEqual(t, consumerCtx.GetRequestId(), "upstream-2")
+	assert.AssertEqual(t, consumerCtx.GetTraceId(), ctx.GetTraceId())
+	assert.AssertEqual(t, consumerCtx.GetTraceParent() != ctx.GetTraceParent(), true)
+	_, parentId, _, _ := parseTraceParent(serializeRequest.Header["Traceparent"][0])
+	assert.AssertEqual(t, consumerCtx.(*contextImplement).trace.parentId, parentId)
+}
+
+func TestTraceResponseHeader(t *testing.T) {
+	request, _ := http.NewRequest("GET", "/traceNotFound", nil)
+	request.Header.Set("X-Request-Id", "upstream-3")
+	response := &memoryResponseWriter{}
+	handler.handleRequest(request, response)
+	assert.AssertEqual(t, response.headerCode, 404)
+	assert.AssertEqual(t, response.Header().Get("X-Request-Id"), "upstream-3")
+}
@@ -0,0 +1,417 @@
+package web
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/milkbobo/fishgoweb/language"
+)
+
+// 参数校验失败时的错误码，Exception的Cause为[]ValidateFieldError
+const ValidateErrorCode = 400
+
+type ValidateFieldError struct {
+	Field   string
+	Rule    string
+	Message string
+}
+
+type validateRule struct {
+	name     string
+	argument string
+	min      float64
+	max      float64
+	hasMin   bool
+	hasMax   bool
+	regexp   *regexp.Regexp
+}
+
+type validateFieldKey struct {
+	dataType reflect.Type
+	nameTag  string
+}
+
+type validateField struct {
+	name     string
+	index    []int
+	required bool
+	rules    []validateRule
+}
+
+var (
+	validateFieldMutex sync.RWMutex
+	validateFieldMap   = map[validateFieldKey][]validateField{}
+	validateEnumMutex  sync.RWMutex
+	validateEnumMap    = map[string][]string{}
+	validateEmail      = regexp.MustCompile(`^[a-zA-Z0-9_.+\-]+@[a-zA-Z0-9\-]+(\.[a-zA-Z0-9\-]+)+$`)
+	validateMobile     = regexp.MustCompile(`^1[3-9][0-9]{9}$`)
+)
+
+// 注册可以在validate中以enum=name引用的枚举，enum为InitEnumStruct或InitEnumStructString初始化后的指针
+func InitValidateEnum(name string, enum interface{}) {
+	enumValue := reflect.ValueOf(enum).Elem()
+	keys := []string{}
+	if enumStruct := enumValue.FieldByName("EnumStruct"); enumStruct.IsValid() {
+		for _, single := range enumStruct.Addr().Interface().(*language.EnumStruct).Keys() {
+			keys = append(keys, strconv.Itoa(single))
+		}
+	} else if enumStruct := enumValue.FieldByName("EnumStructString"); enumStruct.IsValid() {
+		keys = enumStruct.Addr().Interface().(*language.EnumStructString).Keys()
+	} else {
+		panic("invalid validate enum " + name + " is not a EnumStruct")
+	}
+	validateEnumMutex.Lock()
+	validateEnumMap[name] = keys
+	validateEnumMutex.Unlock()
+}
+
+func getValidateEnum(name string) []string {
+	validateEnumMutex.RLock()
+	defer validateEnumMutex.RUnlock()
+	result, isExist := validateEnumMap[name]
+	if isExist == false {
+		panic("invalid validate enum " + name + " has not been init")
+	}
+	return result
+}
+
+func parseValidateRange(argument string) (float64, float64, bool, bool, error) {
+	var min, max float64
+	var hasMin, hasMax bool
+	var err error
+	argumentArray := strings.Split(argument, "~")
+	if len(argumentArray) == 1 {
+		argumentArray = append(argumentArray, argumentArray[0])
+	}
+	if len(argumentArray) != 2 {
+		return 0, 0, false, false, fmt.Errorf("invalid range %v", argument)
+	}
+	if argumentArray[0] != "" {
+		min, err = strconv.ParseFloat(argumentArray[0], 64)
+		if err != nil {
+			return 0, 0, false, false, err
+		}
+		hasMin = true
+	}
+	if argumentArray[1] != "" {
+		max, err = strconv.ParseFloat(argumentArray[1], 64)
+		if err != nil {
+			return 0, 0, false, false, err
+		}
+		hasMax = true
+	}
+	return min, max, hasMin, hasMax, nil
+}
+
+// 解析validate标签，第一段为旧的validate:"name"写法中的名称，不作为规则，参数名由url标签决定
+// 规则从第二段开始，之间用逗号分隔，regex必须放在最后
+// validate:",required,min=1,max=100,length=1~20,regex=^[a-z]+$,enum=name,email,mobile"
+func parseValidateTag(tag string) (bool, []validateRule, error) {
+	required := false
+	rules := []validateRule{}
+	if index := strings.Index(tag, ","); index != -1 {
+		tag = tag[index+1:]
+	} else {
+		tag = ""
+	}
+	for tag != "" {
+		var single string
+		if strings.HasPrefix(tag, "regex=") {
+			single = tag
+			tag = ""
+		} else if index := strings.Index(tag, ","); index != -1 {
+			single = tag[:index]
+			tag = tag[index+1:]
+		} else {
+			single = tag
+			tag = ""
+		}
+		single = strings.TrimSpace(single)
+		if single == "" {
+			continue
+		}
+		rule := validateRule{}
+		if index := strings.Index(single, "="); index != -1 {
+			rule.name = single[:index]
+			rule.argument = single[index+1:]
+		} else {
+			rule.name = single
+		}
+		var err error
+		switch rule.name {
+		case "required":
+			required = true
+			continue
+		case "min":
+			rule.min, err = strconv.ParseFloat(rule.argument, 64)
+			rule.hasMin = true
+		case "max":
+			rule.max, err = strconv.ParseFloat(rule.argument, 64)
+			rule.hasMax = true
+		case "length":
+			rule.min, rule.max, rule.hasMin, rule.hasMax, err = parseValidateRange(rule.argument)
+		case "regex":
+			rule.regexp, err = regexp.Compile(rule.argument)
+		case "enum":
+			if rule.argument == "" {
+				err = fmt.Errorf("enum name is empty")
+			}
+		case "email":
+			rule.regexp = validateEmail
+		case "mobile":
+			rule.regexp = validateMobile
+		default:
+			err = fmt.Errorf("unknown rule %v", rule.name)
+		}
+		if err != nil {
+			return false, nil, fmt.Errorf("invalid validate rule [%v] : %v", single, err.Error())
+		}
+		rules = append(rules, rule)
+	}
+	return required, rules, nil
+}
+
+func getValidateNameMapper(field reflect.StructField, nameTag string) string {
+	name := strings.Split(field.Tag.Get(nameTag), ",")[0]
+	if name == "" || name == "-" || name == "->" || name == "<-" {
+		name = strings.ToLower(field.Name[0:1]) + field.Name[1:]
+	}
+	return name
+}
+
+func getValidateField(dataType reflect.Type, nameTag string) []validateField {
+	key := validateFieldKey{dataType: dataType, nameTag: nameTag}
+	validateFieldMutex.RLock()
+	result, isExist := validateFieldMap[key]
+	validateFieldMutex.RUnlock()
+	if isExist {
+		return result
+	}
+
+	result = []validateField{}
+	for i := 0; i != dataType.NumField(); i++ {
+		singleField := dataType.Field(i)
+		if singleField.PkgPath != "" && singleField.Anonymous == false {
+			continue
+		}
+		required, rules, err := parseValidateTag(singleField.Tag.Get("validate"))
+		if err != nil {
+			panic(dataType.String() + "." + singleField.Name + " " + err.Error())
+		}
+		result = append(result, validateField{
+			name:     getValidateNameMapper(singleField, nameTag),
+			index:    singleField.Index,
+			required: required,
+			rules:    rules,
+		})
+	}
+
+	validateFieldMutex.Lock()
+	validateFieldMap[key] = result
+	validateFieldMutex.Unlock()
+	return result
+}
+
+func getValidateNumber(value reflect.Value) (float64, bool) {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), true
+	case reflect.String:
+		if value.Type() == reflect.TypeOf(language.Decimal("")) {
+			result, err := strconv.ParseFloat(value.String(), 64)
+			return result, err == nil
+		}
+	}
+	return 0, false
+}
+
+func getValidateLength(value reflect.Value) (int, bool) {
+	switch value.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(value.String()), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return value.Len(), true
+	}
+	return 0, false
+}
+
+func formatValidateNumber(number float64) string {
+	return strconv.FormatFloat(number, 'f', -1, 64)
+}
+
+func checkValidateRule(name string, rule validateRule, value reflect.Value) string {
+	switch rule.name {
+	case "min", "max":
+		number, ok := getValidateNumber(value)
+		if ok == false {
+			length, isLength := getValidateLength(value)
+			if isLength == false {
+				return fmt.Sprintf("参数%s不是数字", name)
+			}
+			number = float64(length)
+		}
+		if rule.hasMin && number < rule.min {
+			return fmt.Sprintf("参数%s不能小于%s", name, formatValidateNumber(rule.min))
+		}
+		if rule.hasMax && number > rule.max {
+			return fmt.Sprintf("参数%s不能大于%s", name, formatValidateNumber(rule.max))
+		}
+	case "length":
+		length, ok := getValidateLength(value)
+		if ok == false {
+			length = utf8.RuneCountInString(fmt.Sprintf("%v", value.Interface()))
+		}
+		if (rule.hasMin && float64(length) < rule.min) ||
+			(rule.hasMax && float64(length) > rule.max) {
+			if rule.hasMin && rule.hasMax && rule.min == rule.max {
+				return fmt.Sprintf("参数%s长度必须为%s", name, formatValidateNumber(rule.min))
+			} else if rule.hasMin && rule.hasMax {
+				return fmt.Sprintf("参数%s长度必须为%s到%s", name, formatValidateNumber(rule.min), formatValidateNumber(rule.max))
+			} else if rule.hasMin {
+				return fmt.Sprintf("参数%s长度不能小于%s", name, formatValidateNumber(rule.min))
+			} else {
+				return fmt.Sprintf("参数%s长度不能大于%s", name, formatValidateNumber(rule.max))
+			}
+		}
+	case "regex", "email", "mobile":
+		if rule.regexp.MatchString(fmt.Sprintf("%v", value.Interface())) == false {
+			if rule.name == "email" {
+				return fmt.Sprintf("参数%s不是合法的邮箱", name)
+			} else if rule.name == "mobile" {
+				return fmt.Sprintf("参数%s不是合法的手机号码", name)
+			}
+			return fmt.Sprintf("参数%s格式不正确", name)
+		}
+	case "enum":
+		if language.ArrayIn(getValidateEnum(rule.argument), fmt.Sprintf("%v", value.Interface())) == -1 {
+			return fmt.Sprintf("参数%s不是合法的枚举值", name)
+		}
+	}
+	return ""
+}
+
+// 从请求的输入中取出字段，isKnown为false时不知道输入，按零值判断是否传入
+func getValidateInputField(input reflect.Value, name string) (reflect.Value, bool, bool) {
+	for input.IsValid() && input.Kind() == reflect.Interface {
+		input = input.Elem()
+	}
+	if input.IsValid() == false || input.Kind() != reflect.Map || input.Type().Key().Kind() != reflect.String {
+		return reflect.Value{}, false, false
+	}
+	result := input.MapIndex(reflect.ValueOf(name).Convert(input.Type().Key()))
+	return result, true, result.IsValid()
+}
+
+func getValidateInputIndex(input reflect.Value, index int) reflect.Value {
+	for input.IsValid() && input.Kind() == reflect.Interface {
+		input = input.Elem()
+	}
+	if input.IsValid() == false || (input.Kind() != reflect.Slice && input.Kind() != reflect.Array) || index >= input.Len() {
+		return reflect.Value{}
+	}
+	return input.Index(index)
+}
+
+func isValidateEmpty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return value.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return value.IsNil()
+	}
+	return false
+}
+
+func validateValue(prefix string, value reflect.Value, input reflect.Value, nameTag string, result []ValidateFieldError) []ValidateFieldError {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return result
+		}
+		value = value.Elem()
+	}
+	if value.Kind() == reflect.Slice || value.Kind() == reflect.Array {
+		for i := 0; i != value.Len(); i++ {
+			result = validateValue(fmt.Sprintf("%s[%d]", prefix, i), value.Index(i), getValidateInputIndex(input, i), nameTag, result)
+		}
+		return result
+	}
+	if value.Kind() != reflect.Struct || value.Type() == reflect.TypeOf(language.Decimal("")) {
+		return result
+	}
+	for _, singleField := range getValidateField(value.Type(), nameTag) {
+		singleValue := value.FieldByIndex(singleField.index)
+		singleName := singleField.name
+		if prefix != "" {
+			singleName = prefix + "." + singleName
+		}
+		if value.Type().FieldByIndex(singleField.index).Anonymous {
+			result = validateValue(prefix, singleValue, input, nameTag, result)
+			continue
+		}
+		//有输入时按是否传入判断，显式传入的零值同样需要满足规则
+		singleInput, isKnown, isSupplied := getValidateInputField(input, singleField.name)
+		if isKnown == false {
+			isSupplied = singleValue.IsZero() == false && isValidateEmpty(singleValue) == false
+		}
+		if singleField.required && (isSupplied == false || isValidateEmpty(singleValue)) {
+			result = append(result, ValidateFieldError{
+				Field:   singleName,
+				Rule:    "required",
+				Message: fmt.Sprintf("参数%s不能为空", singleName),
+			})
+			continue
+		}
+		if isSupplied == false {
+			continue
+		}
+		for _, singleRule := range singleField.rules {
+			message := checkValidateRule(singleName, singleRule, singleValue)
+			if message != "" {
+				result = append(result, ValidateFieldError{
+					Field:   singleName,
+					Rule:    singleRule.name,
+					Message: message,
+				})
+				break
+			}
+		}
+		result = validateValue(singleName, singleValue, singleInput, nameTag, result)
+	}
+	return result
+}
+
+func throwValidate(fieldErrors []ValidateFieldError) {
+	if len(fieldErrors) == 0 {
+		return
+	}
+	messages := []string{}
+	for _, single := range fieldErrors {
+		messages = append(messages, single.Message)
+	}
+	language.ThrowWithCause(ValidateErrorCode, fieldErrors, strings.Join(messages, "；"))
+}
+
+// 按照validate标签校验结构体，nameTag为字段对应的参数名的标签
+// 没有请求的输入，零值视为没有传入，只检查required
+func Validate(data interface{}, nameTag string) []ValidateFieldError {
+	return validateValue("", reflect.ValueOf(data), reflect.Value{}, nameTag, []ValidateFieldError{})
+}
+
+// 校验失败时抛出错误码为ValidateErrorCode的异常
+func CheckValidate(data interface{}, nameTag string) {
+	throwValidate(Validate(data, nameTag))
+}
+
+// 按照请求的输入校验，传入的字段即使为零值也需要满足规则，只有没有传入的可选字段跳过
+func checkValidateInput(data interface{}, input interface{}, nameTag string) {
+	throwValidate(validateValue("", reflect.ValueOf(data), reflect.ValueOf(input), nameTag, []ValidateFieldError{}))
+}
@@ -0,0 +1,112 @@
+package web
+
+import (
+	"github.com/milkbobo/fishgoweb/assert"
+	"github.com/milkbobo/fishgoweb/language"
+	"testing"
+)
+
+var validateTestEnum struct {
+	language.EnumStruct
+	ENABLE  int `enum:"1,启用"`
+	DISABLE int `enum:"2,禁用"`
+}
+
+type validateTestItem struct {
+	Name string `validate:",required"`
+}
+
+type validateTestData struct {
+	Name     string  `url:"userName" validate:",required,length=2~4"`
+	Age      int     `validate:",min=1,max=150"`
+	Score    float64 `validate:",max=100"`
+	State    int     `validate:",required,enum=validateTestEnum"`
+	Email    string  `validate:",email"`
+	Mobile   string  `validate:",mobile"`
+	Code     string  `validate:",regex=^[a-z]{2,3}$"`
+	Items    []validateTestItem
+	Optional string
+}
+
+type validateTestLegacy struct {
+	View     string `validate:"_view"`
+	Page     int    `validate:"_page,min=1"`
+	Mobile   string `validate:"mobile"`
+	Required string `validate:"required"`
+}
+
+func TestValidate(t *testing.T) {
+	language.InitEnumStruct(&validateTestEnum)
+	InitValidateEnum("validateTestEnum", &validateTestEnum)
+
+	testCase := []struct {
+		data   validateTestData
+		fields []string
+	}{
+		{validateTestData{
+			Name:   "小明",
+			Age:    20,
+			State:  1,
+			Email:  "fish@qq.com",
+			Mobile: "13800138000",
+			Code:   "ab",
+			Items:  []validateTestItem{{Name: "a"}},
+		}, []string{}},
+		{validateTestData{}, []string{"userName", "state"}},
+		{validateTestData{
+			Name:   "a",
+			Age:    151,
+			Score:  100.5,
+			State:  3,
+			Email:  "fish",
+			Mobile: "12800138000",
+			Code:   "abcd",
+			Items:  []validateTestItem{{Name: "a"}, {}},
+		}, []string{"userName", "age", "score", "state", "email", "mobile", "code", "items[1].name"}},
+	}
+	for singleIndex, singleTestCase := range testCase {
+		fields := []string{}
+		for _, single := range Validate(&singleTestCase.data, "url") {
+			fields = append(fields, single.Field)
+		}
+		assert.AssertEqual(t, fields, singleTestCase.fields, singleIndex)
+	}
+
+	assert.AssertException(t, ValidateErrorCode, "参数userName不能为空；参数state不能为空", func() {
+		CheckValidate(&validateTestData{}, "url")
+	})
+
+	//旧的validate:"name"写法不再报错，名称与规则同名时也不会作为规则
+	assert.AssertEqual(t, Validate(&validateTestLegacy{}, "url"), []ValidateFieldError{})
+	assert.AssertEqual(t, Validate(&validateTestLegacy{Mobile: "fish"}, "url"), []ValidateFieldError{})
+	assert.AssertEqual(t, len(Validate(&validateTestLegacy{Page: -1}, "url")), 1)
+}
+
+func TestValidateInput(t *testing.T) {
+	language.InitEnumStruct(&validateTestEnum)
+	InitValidateEnum("validateTestEnum", &validateTestEnum)
+
+	//显式传入的零值与空字符串同样需要满足规则，没有传入的可选字段跳过
+	testCase := []struct {
+		url     string
+		message string
+	}{
+		{"/test?userName=abc&state=1", ""},
+		{"/test?userName=abc&state=1&age=0", "参数age不能小于1"},
+		{"/test?userName=abc&state=0", "参数state不是合法的枚举值"},
+		{"/test?userName=abc&state=1&code=", "参数code格式不正确"},
+		{"/test?userName=&state=1", "参数userName不能为空"},
+		{"/test?userName=abc&state=1&items[0][name]=", "参数items[0].name不能为空"},
+	}
+	for singleIndex, singleTestCase := range testCase {
+		ctx := newContextTestRequest(singleTestCase.url, "", "")
+		message := ""
+		func() {
+			defer language.Catch(func(exception language.Exception) {
+				message = exception.GetMessage()
+			})
+			ctx.GetParamToStruct(&validateTestData{})
+		}()
+		assert.AssertEqual(t, message, singleTestCase.message, singleIndex)
+	}
+}
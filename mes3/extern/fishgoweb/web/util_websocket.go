@@ -0,0 +1,435 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/milkbobo/fishgoweb/util"
+)
+
+const (
+	WebsocketTextMessage   = websocket.TextMessage
+	WebsocketBinaryMessage = websocket.BinaryMessage
+)
+
+// websocket连接，声明为_Websocket方法的参数时由框架在握手后注入
+// 如func (this *OrderController) Status_Websocket(conn WebsocketConn)
+// 方法返回后连接自动关闭
+type WebsocketConn interface {
+	GetId() string
+	Read() (int, []byte, error)
+	ReadJson(data interface{}) error
+	ReadLoop(handler func(messageType int, data []byte)) error
+	Write(messageType int, data []byte) error
+	WriteJson(data interface{}) error
+	Join(group string)
+	Leave(group string)
+	Done() <-chan struct{}
+	Close() error
+}
+
+type WebsocketHub interface {
+	Join(group string, conn WebsocketConn)
+	Leave(group string, conn WebsocketConn)
+	LeaveAll(conn WebsocketConn)
+	GetGroupSize(group string) int
+	Broadcast(group string, messageType int, data []byte)
+	BroadcastJson(group string, data interface{})
+	Close()
+}
+
+type WebsocketConfig struct {
+	ReadBufferSize  int
+	WriteBufferSize int
+	SendBufferSize  int
+	MaxMessageSize  int64
+	PingInterval    time.Duration
+	PongWait        time.Duration
+	WriteWait       time.Duration
+	Topic           string
+}
+
+type websocketMessage struct {
+	messageType int
+	data        []byte
+}
+
+type websocketConnImplement struct {
+	id         string
+	ws         *util.Websocket
+	hub        *websocketHubImplement
+	send       chan websocketMessage
+	receive    chan websocketMessage
+	readError  error
+	closeError error
+	done       chan struct{}
+	closed     chan struct{}
+	closeOnce  sync.Once
+}
+
+type websocketHubImplement struct {
+	config        WebsocketConfig
+	mutex         sync.RWMutex
+	groups        map[string]map[*websocketConnImplement]bool
+	conns         map[*websocketConnImplement]map[string]bool
+	subscribeOnce sync.Once
+}
+
+// 订阅广播消息的监听者，只用于接收Basic的注入
+type websocketHubListener struct {
+	Model
+}
+
+var websocketConnId int64
+
+func NewWebsocketHub(config WebsocketConfig) (WebsocketHub, error) {
+	if config.SendBufferSize <= 0 {
+		config.SendBufferSize = 256
+	}
+	if config.MaxMessageSize <= 0 {
+		config.MaxMessageSize = 1 << 20
+	}
+	if config.PongWait <= 0 {
+		config.PongWait = 60 * time.Second
+	}
+	if config.PingInterval <= 0 || config.PingInterval >= config.PongWait {
+		config.PingInterval = config.PongWait * 9 / 10
+	}
+	if config.WriteWait <= 0 {
+		config.WriteWait = 10 * time.Second
+	}
+	return &websocketHubImplement{
+		config: config,
+		groups: map[string]map[*websocketConnImplement]bool{},
+		conns:  map[*websocketConnImplement]map[string]bool{},
+	}, nil
+}
+
+func NewWebsocketHubFromConfig() (WebsocketHub, error) {
+	websocketConfig := globalBasic.Config.Get().Websocket
+	return NewWebsocketHub(WebsocketConfig{
+		ReadBufferSize:  websocketConfig.ReadBufferSize,
+		WriteBufferSize: websocketConfig.WriteBufferSize,
+		SendBufferSize:  websocketConfig.SendBufferSize,
+		MaxMessageSize:  websocketConfig.MaxMessageSize,
+		PingInterval:    time.Duration(websocketConfig.PingInterval) * time.Second,
+		PongWait:        time.Duration(websocketConfig.PongWait) * time.Second,
+		WriteWait:       time.Duration(websocketConfig.WriteWait) * time.Second,
+		Topic:           websocketConfig.Topic,
+	})
+}
+
+// 握手请求会携带cookie，只允许同源或Cors允许的来源，避免跨站劫持websocket
+func isWebsocketAllowOrigin(request *http.Request, cors Cors) bool {
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	originUrl, err := url.Parse(origin)
+	if err == nil && strings.EqualFold(originUrl.Host, request.Host) {
+		return true
+	}
+	return cors != nil && cors.IsAllowOrigin(origin)
+}
+
+func (this *websocketHubImplement) newConn(request *http.Request, response http.ResponseWriter, cors Cors) (*websocketConnImplement, error) {
+	ws, err := util.NewWebsocketWithCheckOrigin(response, request, nil, this.config.ReadBufferSize, this.config.WriteBufferSize, func(request *http.Request) bool {
+		return isWebsocketAllowOrigin(request, cors)
+	})
+	if err != nil {
+		return nil, err
+	}
+	conn := &websocketConnImplement{
+		id:      strconv.FormatInt(atomic.AddInt64(&websocketConnId, 1), 10),
+		ws:      ws,
+		hub:     this,
+		send:    make(chan websocketMessage, this.config.SendBufferSize),
+		receive: make(chan websocketMessage),
+		done:    make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+	go conn.readLoop()
+	go conn.writeLoop()
+	return conn, nil
+}
+
+func (this *websocketHubImplement) Join(group string, conn WebsocketConn) {
+	this.subscribe()
+	single := conn.(*websocketConnImplement)
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	select {
+	case <-single.done:
+		//连接已经关闭
+		return
+	default:
+	}
+	if _, isExist := this.groups[group]; isExist == false {
+		this.groups[group] = map[*websocketConnImplement]bool{}
+	}
+	this.groups[group][single] = true
+	if _, isExist := this.conns[single]; isExist == false {
+		this.conns[single] = map[string]bool{}
+	}
+	this.conns[single][group] = true
+}
+
+func (this *websocketHubImplement) Leave(group string, conn WebsocketConn) {
+	single := conn.(*websocketConnImplement)
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	delete(this.groups[group], single)
+	if len(this.groups[group]) == 0 {
+		delete(this.groups, group)
+	}
+	delete(this.conns[single], group)
+	if len(this.conns[single]) == 0 {
+		delete(this.conns, single)
+	}
+}
+
+func (this *websocketHubImplement) LeaveAll(conn WebsocketConn) {
+	single := conn.(*websocketConnImplement)
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for group := range this.conns[single] {
+		delete(this.groups[group], single)
+		if len(this.groups[group]) == 0 {
+			delete(this.groups, group)
+		}
+	}
+	delete(this.conns, single)
+}
+
+func (this *websocketHubImplement) GetGroupSize(group string) int {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	return len(this.groups[group])
+}
+
+func (this *websocketHubImplement) broadcastLocal(group string, messageType int, data []byte) {
+	this.mutex.RLock()
+	conns := make([]*websocketConnImplement, 0, len(this.groups[group]))
+	for single := range this.groups[group] {
+		conns = append(conns, single)
+	}
+	this.mutex.RUnlock()
+	for _, single := range conns {
+		single.Write(messageType, data)
+	}
+}
+
+// 配置了Topic时通过Queue的Publish广播到所有实例
+func (this *websocketHubImplement) subscribe() {
+	if this.config.Topic == "" || globalBasic.Queue == nil {
+		return
+	}
+	this.subscribeOnce.Do(func() {
+		globalBasic.Queue.Subscribe(this.config.Topic, func(listener *websocketHubListener, group string, messageType int, data string) {
+			this.broadcastLocal(group, messageType, []byte(data))
+		})
+	})
+}
+
+func (this *websocketHubImplement) Broadcast(group string, messageType int, data []byte) {
+	if this.config.Topic == "" || globalBasic.Queue == nil {
+		this.broadcastLocal(group, messageType, data)
+		return
+	}
+	this.subscribe()
+	initEmptyBasic(nil).Queue.Publish(this.config.Topic, group, messageType, string(data))
+}
+
+func (this *websocketHubImplement) BroadcastJson(group string, data interface{}) {
+	result, err := json.Marshal(data)
+	if err != nil {
+		panic(err)
+	}
+	this.Broadcast(group, WebsocketTextMessage, result)
+}
+
+func (this *websocketHubImplement) Close() {
+	this.mutex.RLock()
+	conns := make([]*websocketConnImplement, 0, len(this.conns))
+	for single := range this.conns {
+		conns = append(conns, single)
+	}
+	this.mutex.RUnlock()
+	for _, single := range conns {
+		single.shutdown()
+	}
+	for _, single := range conns {
+		<-single.closed
+	}
+}
+
+func (this *websocketConnImplement) readLoop() {
+	defer this.Close()
+	defer close(this.receive)
+	config := this.hub.config
+	this.ws.SetReadLimit(config.MaxMessageSize)
+	this.ws.SetReadDeadline(time.Now().Add(config.PongWait))
+	this.ws.SetPongHandler(func(string) error {
+		return this.ws.SetReadDeadline(time.Now().Add(config.PongWait))
+	})
+	for {
+		messageType, data, err := this.ws.ReadMessage()
+		if err != nil {
+			this.readError = err
+			return
+		}
+		select {
+		case this.receive <- websocketMessage{messageType: messageType, data: data}:
+		case <-this.done:
+			this.readError = errors.New("websocket is closed")
+			return
+		}
+	}
+}
+
+// 只有writeLoop写入与关闭连接，关闭时先发送完缓冲中的消息再发送关闭帧
+func (this *websocketConnImplement) writeLoop() {
+	defer close(this.closed)
+	config := this.hub.config
+	ticker := time.NewTicker(config.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case message := <-this.send:
+			err := this.ws.WriteMessageWithDeadline(message.messageType, message.data, time.Now().Add(config.WriteWait))
+			if err != nil {
+				this.shutdown()
+				this.closeError = this.ws.Close()
+				return
+			}
+		case <-ticker.C:
+			err := this.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(config.WriteWait))
+			if err != nil {
+				this.shutdown()
+				this.closeError = this.ws.Close()
+				return
+			}
+		case <-this.done:
+			this.flush()
+			return
+		}
+	}
+}
+
+// 缓冲中的消息与关闭帧共用一个WriteWait的期限
+func (this *websocketConnImplement) flush() {
+	deadline := time.Now().Add(this.hub.config.WriteWait)
+	for {
+		select {
+		case message := <-this.send:
+			err := this.ws.WriteMessageWithDeadline(message.messageType, message.data, deadline)
+			if err != nil {
+				this.closeError = this.ws.Close()
+				return
+			}
+		default:
+			this.ws.WriteControl(
+				websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+				deadline,
+			)
+			this.closeError = this.ws.Close()
+			return
+		}
+	}
+}
+
+func (this *websocketConnImplement) GetId() string {
+	return this.id
+}
+
+func (this *websocketConnImplement) Read() (int, []byte, error) {
+	message, isOpen := <-this.receive
+	if isOpen == false {
+		return 0, nil, this.readError
+	}
+	return message.messageType, message.data, nil
+}
+
+func (this *websocketConnImplement) ReadJson(data interface{}) error {
+	_, message, err := this.Read()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(message, data)
+}
+
+// 循环读取消息直到连接关闭，客户端正常关闭时返回nil
+func (this *websocketConnImplement) ReadLoop(handler func(messageType int, data []byte)) error {
+	for {
+		messageType, data, err := this.Read()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return nil
+			}
+			return err
+		}
+		handler(messageType, data)
+	}
+}
+
+func (this *websocketConnImplement) Write(messageType int, data []byte) error {
+	select {
+	case <-this.done:
+		return errors.New("websocket is closed")
+	default:
+	}
+	select {
+	case this.send <- websocketMessage{messageType: messageType, data: data}:
+		return nil
+	case <-this.done:
+		return errors.New("websocket is closed")
+	default:
+		//客户端消费太慢时断开连接，避免阻塞广播
+		this.shutdown()
+		return errors.New("websocket send buffer is full")
+	}
+}
+
+func (this *websocketConnImplement) WriteJson(data interface{}) error {
+	result, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return this.Write(WebsocketTextMessage, result)
+}
+
+func (this *websocketConnImplement) Join(group string) {
+	this.hub.Join(group, this)
+}
+
+func (this *websocketConnImplement) Leave(group string) {
+	this.hub.Leave(group, this)
+}
+
+func (this *websocketConnImplement) Done() <-chan struct{} {
+	return this.done
+}
+
+// 不再接受新的消息，由writeLoop发送完缓冲后关闭连接
+func (this *websocketConnImplement) shutdown() {
+	this.closeOnce.Do(func() {
+		close(this.done)
+		this.hub.LeaveAll(this)
+	})
+}
+
+// 等待缓冲中的消息发送完成，最多等待WriteWait
+func (this *websocketConnImplement) Close() error {
+	this.shutdown()
+	<-this.closed
+	return this.closeError
+}
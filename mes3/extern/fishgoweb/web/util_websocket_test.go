@@ -0,0 +1,133 @@
+package web
+
+import (
+	"github.com/gorilla/websocket"
+	"github.com/milkbobo/fishgoweb/assert"
+	"github.com/milkbobo/fishgoweb/language"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type websocketTestController struct {
+	Controller
+}
+
+func (this *websocketTestController) Echo_Websocket(conn WebsocketConn) {
+	conn.Join("websocketTest")
+	conn.ReadLoop(func(messageType int, data []byte) {
+		conn.Write(messageType, append([]byte("echo:"), data...))
+	})
+}
+
+func (this *websocketTestController) Last_Websocket(conn WebsocketConn) {
+	for i := 0; i != 100; i++ {
+		conn.Write(WebsocketTextMessage, []byte(strings.Repeat("a", 1024)))
+	}
+	conn.Write(WebsocketTextMessage, []byte("bye"))
+}
+
+func (this *websocketTestController) AutoRender(data interface{}, viewName string) {
+	if exception, ok := data.(language.Exception); ok {
+		this.Ctx.Write([]byte(exception.GetMessage()))
+	}
+}
+
+func TestWebsocket(t *testing.T) {
+	oldRouteTree := handler.routeTree
+	defer func() {
+		handler.routeTree = oldRouteTree
+	}()
+	handler.routeTree = nil
+	handler.addRoute("/ws", &websocketTestController{}, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		handler.handleRequest(request, response)
+	}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/echo"
+	client, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.AssertEqual(t, err, nil)
+
+	//读写消息
+	err = client.WriteMessage(websocket.TextMessage, []byte("hello"))
+	assert.AssertEqual(t, err, nil)
+	messageType, data, err := client.ReadMessage()
+	assert.AssertEqual(t, err, nil)
+	assert.AssertEqual(t, messageType, websocket.TextMessage)
+	assert.AssertEqual(t, string(data), "echo:hello")
+
+	//分组广播
+	hub := globalBasic.Websocket
+	assert.AssertEqual(t, hub.GetGroupSize("websocketTest"), 1)
+	hub.BroadcastJson("websocketTest", map[string]int{"orderId": 1})
+	_, data, err = client.ReadMessage()
+	assert.AssertEqual(t, err, nil)
+	assert.AssertEqual(t, string(data), `{"orderId":1}`)
+	hub.BroadcastJson("otherGroup", map[string]int{"orderId": 2})
+
+	//关闭后离开分组
+	client.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	client.Close()
+	for i := 0; i != 100 && hub.GetGroupSize("websocketTest") != 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.AssertEqual(t, hub.GetGroupSize("websocketTest"), 0)
+
+	//方法返回时先发送完缓冲中的消息，再发送关闭帧
+	client, _, err = websocket.DefaultDialer.Dial(strings.TrimSuffix(url, "/echo")+"/last", nil)
+	assert.AssertEqual(t, err, nil)
+	for i := 0; i != 100; i++ {
+		_, data, err = client.ReadMessage()
+		assert.AssertEqual(t, err, nil)
+		assert.AssertEqual(t, len(data), 1024)
+	}
+	_, data, err = client.ReadMessage()
+	assert.AssertEqual(t, err, nil)
+	assert.AssertEqual(t, string(data), "bye")
+	_, _, err = client.ReadMessage()
+	assert.AssertEqual(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), true)
+	client.Close()
+
+	//只允许同源或Cors允许的来源
+	oldCors := globalBasic.Cors
+	defer func() {
+		globalBasic.Cors = oldCors
+	}()
+	globalBasic.Cors, err = NewCors(CorsConfig{AllowOrigins: []string{"http://allow.example.com"}})
+	assert.AssertEqual(t, err, nil)
+	testCase := []struct {
+		origin  string
+		isAllow bool
+	}{
+		{"", true},
+		{server.URL, true},
+		{"http://allow.example.com", true},
+		{"http://evil.example.com", false},
+	}
+	for singleIndex, singleTestCase := range testCase {
+		header := http.Header{}
+		if singleTestCase.origin != "" {
+			header.Set("Origin", singleTestCase.origin)
+		}
+		client, response, err := websocket.DefaultDialer.Dial(strings.TrimSuffix(url, "/echo")+"/last", header)
+		assert.AssertEqual(t, err == nil, singleTestCase.isAllow, singleIndex)
+		if err == nil {
+			client.Close()
+		} else {
+			body, _ := ioutil.ReadAll(response.Body)
+			response.Body.Close()
+			assert.AssertEqual(t, strings.Contains(string(body), "origin not allowed"), true, singleIndex)
+		}
+	}
+
+	//不是websocket握手时交由AutoRender输出错误
+	response, err := http.Get(server.URL + "/ws/echo")
+	assert.AssertEqual(t, err, nil)
+	body, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	assert.AssertEqual(t, strings.HasPrefix(string(body), "Not a websocket handshake"), true)
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	. "github.com/milkbobo/fishgoweb/web"
+)
+
+// 基线迁移，与data/mysql/BakeWeb.sql的表结构一致
+// 已有的部署中表与索引都已存在，索引写在建表语句中，IF NOT EXISTS时整体跳过
+// 基线不能回滚，避免误删线上的数据
+func init() {
+	AddMigration("db", AppMigration{
+		Version: "00000000000000",
+		Name:    "baseline",
+		Up: func(sess DatabaseSession) {
+			_, err := sess.Exec("create table if not exists t_config(" +
+				"configId integer not null auto_increment," +
+				"name varchar(128) not null," +
+				"value varchar(10240) not null," +
+				"createTime timestamp not null default CURRENT_TIMESTAMP," +
+				"modifyTime timestamp not null default CURRENT_TIMESTAMP on update CURRENT_TIMESTAMP," +
+				"primary key( configId )," +
+				"index nameIndex(name)" +
+				")engine=innodb default charset=utf8mb4 auto_increment = 10001")
+			if err != nil {
+				panic(err)
+			}
+		},
+	})
+}
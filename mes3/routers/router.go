@@ -8,4 +8,10 @@ import (
 func init() {
 	//前端路由
 	InitRoute("/index", &IndexController{})
+	AddMethodApiDoc(&IndexController{}, "Test_Json", AppRouterApiDoc{
+		Summary: "获取test配置",
+	})
+
+	//接口文档，prod环境只允许[debug]的ipwhite访问
+	InitApiDocRoute("/openapi.json", "1.0.0")
 }